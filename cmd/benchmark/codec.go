@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/rupamthxt/vectradb/internal/cluster"
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// codecFormat is one raft log encoding under comparison
+type codecFormat struct {
+	name   string
+	encode func(cluster.Command) ([]byte, error)
+}
+
+var codecFormats = []codecFormat{
+	{"json", func(cmd cluster.Command) ([]byte, error) { return json.Marshal(cmd) }},
+	{"binary", cluster.EncodeCommand},
+}
+
+// runCodecBench compares the legacy JSON and the binary raft command formats:
+// entry size, encode and decode throughput, and FSM.Apply throughput into a
+// fresh collection, which is what a follower does when it replays the log
+func runCodecBench(collection store.CollectionConfig, n int) error {
+	fmt.Printf("\n--- Raft command encoding: %d inserts, dim %d ---\n", n, dimension)
+
+	cmds := make([]cluster.Command, n)
+	for i := range cmds {
+		cmds[i] = cluster.Command{
+			Op:     cluster.OpInsert,
+			Id:     fmt.Sprintf("vec-%d", i),
+			Vector: randomVector(dimension),
+			Data:   json.RawMessage(`{"source":"benchmark"}`),
+		}
+	}
+
+	for _, format := range codecFormats {
+		entries := make([][]byte, n)
+		start := time.Now()
+		for i, cmd := range cmds {
+			entry, err := format.encode(cmd)
+			if err != nil {
+				return fmt.Errorf("%s encode: %w", format.name, err)
+			}
+			entries[i] = entry
+		}
+		encode := time.Since(start)
+
+		start = time.Now()
+		for _, entry := range entries {
+			if _, err := cluster.DecodeCommand(entry); err != nil {
+				return fmt.Errorf("%s decode: %w", format.name, err)
+			}
+		}
+		decode := time.Since(start)
+
+		apply, err := applyEntries(collection, entries)
+		if err != nil {
+			return fmt.Errorf("%s apply: %w", format.name, err)
+		}
+
+		fmt.Printf("📦 %-6s entry %5d bytes | encode %10.0f/s | decode %10.0f/s | FSM.Apply %8.0f/s\n",
+			format.name, len(entries[0]), rate(n, encode), rate(n, decode), rate(n, apply))
+	}
+	return nil
+}
+
+// applyEntries replays log entries into an FSM over an empty collection
+func applyEntries(collection store.CollectionConfig, entries [][]byte) (time.Duration, error) {
+	dir, err := os.MkdirTemp(".", "codec-bench")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := store.NewVectraDBWithConfig(dimension, dir, collection)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	fsm := cluster.NewFSM(0, db)
+
+	start := time.Now()
+	for i, entry := range entries {
+		if resp := fsm.Apply(&raft.Log{Index: uint64(i + 1), Data: entry}); resp != nil {
+			if err, ok := resp.(error); ok {
+				return 0, err
+			}
+		}
+	}
+	return time.Since(start), nil
+}
+
+func rate(n int, d time.Duration) float64 {
+	return float64(n) / d.Seconds()
+}
@@ -30,41 +30,6 @@ var (
 	metricsPort  = 9091
 )
 
-type shardGroup struct {
-	nodes []*cluster.RaftNode
-}
-
-func (s *shardGroup) Insert(id string, vector []float32, data any) error {
-	for _, n := range s.nodes {
-		if n.Raft.State() == raft.Leader {
-			return n.Insert(id, vector, data)
-		}
-	}
-	return fmt.Errorf("no leader for shard")
-}
-
-func (s *shardGroup) Search(query []float32, topK int) []store.VectroRecord {
-	// Read from the first available node (may be eventual) or the leader if known.
-	for _, n := range s.nodes {
-		if n.Raft.State() == raft.Leader {
-			return n.Search(query, topK)
-		}
-	}
-	if len(s.nodes) > 0 {
-		return s.nodes[0].Search(query, topK)
-	}
-	return nil
-}
-
-func (s *shardGroup) Delete(id string) error {
-	for _, n := range s.nodes {
-		if n.Raft.State() == raft.Leader {
-			return n.Delete(id)
-		}
-	}
-	return fmt.Errorf("no leader for shard")
-}
-
 func main() {
 	// allow customization via flags
 	dimPtr := flag.Int("dim", dimension, "vector dimension")
@@ -72,16 +37,45 @@ func main() {
 	queriesPtr := flag.Int("queries", numQueries, "number of search queries")
 	shardsPtr := flag.Int("shards", numShards, "number of raft shards")
 	metricsPtr := flag.Int("metrics-port", metricsPort, "port for Prometheus metrics")
+	indexFlag := flag.String("index", "hnsw", "index type (hnsw, ivf, flat, vamana)")
+	quantFlag := flag.String("quantization", "int8", "vector encoding (none, fp16, bf16, int8, pq, binary)")
+	rerankPtr := flag.Bool("rerank", false, "re-rank quantized candidates against float32 vectors")
+	oversamplePtr := flag.Int("oversample", 0, "candidates fetched per result when re-ranking (0 = collection default)")
+	pqMPtr := flag.Int("pq-m", 0, "PQ sub-quantizers (0 = one per ~16 dims)")
+	pqBitsPtr := flag.Int("pq-bits", 8, "PQ bits per sub-quantizer code")
+	nprobePtr := flag.Int("nprobe", 0, "IVF clusters scanned per query (0 = collection default)")
+	codecPtr := flag.Bool("codec", false, "only compare the JSON and binary raft command encodings and exit")
 	flag.Parse()
 
+	indexType, err := store.ParseIndexType(*indexFlag)
+	if err != nil {
+		log.Fatalf("invalid -index: %v", err)
+	}
+	collection := store.DefaultCollectionConfig()
+	collection.Index = indexType
+	collection.Quantization, err = store.ParseQuantizationType(*quantFlag)
+	if err != nil {
+		log.Fatalf("invalid -quantization: %v", err)
+	}
+	collection.PQ.M = *pqMPtr
+	collection.PQ.Bits = *pqBitsPtr
+	collection.Rerank = *rerankPtr
+
 	dimension = *dimPtr
 	totalVectors = *itemsPtr
 	numQueries = *queriesPtr
 	numShards = *shardsPtr
 	metricsPort = *metricsPtr
 
+	if *codecPtr {
+		if err := runCodecBench(collection, totalVectors); err != nil {
+			log.Fatalf("codec benchmark failed: %v", err)
+		}
+		return
+	}
+
 	fmt.Println("🔥 Starting VectraDB Distributed Benchmark (Raft + IVF)")
-	fmt.Printf("Config: Dim=%d | Items=%d | Shards=%d\n", dimension, totalVectors, numShards)
+	fmt.Printf("Config: Dim=%d | Items=%d | Shards=%d | Kernels=%s\n", dimension, totalVectors, numShards, store.Kernels())
 
 	baseDir := "data_bench"
 	// os.RemoveAll(baseDir)
@@ -111,7 +105,7 @@ func main() {
 			nodeDir := fmt.Sprintf("%s/shard_%d/node_%d", baseDir, i, n)
 			os.MkdirAll(nodeDir, 0755)
 
-			db, err := store.NewVectraDB(dimension, nodeDir)
+			db, err := store.NewVectraDBWithConfig(dimension, nodeDir, collection)
 			if err != nil {
 				log.Fatalf("failed to create db for shard %d node %d: %v", i, n, err)
 			}
@@ -176,10 +170,13 @@ func main() {
 			}
 		}
 
-		shards = append(shards, &shardGroup{nodes: nodes})
+		shards = append(shards, cluster.NewShardGroup(nodes))
 	}
 
-	time.Sleep(3 * time.Second) // Wait for elections
+	// Wait for elections and log replay before serving traffic
+	if err := cluster.WaitReady(shards, 30*time.Second); err != nil {
+		log.Printf("warning: cluster not ready: %v", err)
+	}
 	c := store.NewCluster(shards)
 
 	// --- Phase 1: Ingestion ---
@@ -209,8 +206,13 @@ func main() {
 	iqps := float64(totalVectors) / time.Since(start).Seconds()
 	fmt.Printf("🚀 Ingestion QPS: %.2f\n", iqps)
 
+	// Raft log entry size and throughput, binary vs legacy JSON
+	if err := runCodecBench(collection, min(totalVectors, 10_000)); err != nil {
+		log.Printf("warning: codec benchmark failed: %v", err)
+	}
+
 	// --- Phase 2: Search ---
-	fmt.Println("\n--- Phase 2: Search (HNSW) ---")
+	fmt.Printf("\n--- Phase 2: Search (%s) ---\n", indexType)
 	startSearch := time.Now()
 	wgSearch := sync.WaitGroup{}
 	wgSearch.Add(numQueries)
@@ -220,14 +222,14 @@ func main() {
 			defer wgSearch.Done()
 			metrics.SearchRequests.Inc()
 			startSearchLoop := time.Now()
-			c.Search(randomVector(dimension), 10)
+			c.Search(randomVector(dimension), 10, store.SearchOptions{NProbe: *nprobePtr, Oversample: *oversamplePtr})
 			metrics.SearchDuration.Observe(time.Since(startSearchLoop).Seconds())
 		}()
 	}
 	wgSearch.Wait()
 
 	qps := float64(numQueries) / time.Since(startSearch).Seconds()
-	fmt.Printf("🚀 HNSW QPS: %.2f\n", qps)
+	fmt.Printf("🚀 %s QPS: %.2f\n", indexType, qps)
 
 	// keep process running so prometheus can scrape metrics after benchmark completes
 	fmt.Println("🔋 benchmark complete – metrics remain available at :9091/metrics until you stop the program")
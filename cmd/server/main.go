@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/raft"
@@ -17,54 +18,11 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/logger"
 
 	vectorHttp "github.com/rupamthxt/vectradb/internal/http"
+	"github.com/rupamthxt/vectradb/internal/rpc"
 )
 
 const SnapshotPath = "./vectradb.snap"
 
-type shardGroup struct {
-	nodes []*cluster.RaftNode
-}
-
-func (s *shardGroup) Insert(id string, vector []float32, data any) error {
-	for _, n := range s.nodes {
-		if n.Raft.State() == raft.Leader {
-			return n.Insert(id, vector, data)
-		}
-	}
-	return fmt.Errorf("no leader for shard")
-}
-
-func (s *shardGroup) Search(query []float32, topK int) []store.VectroRecord {
-	// Read from the first available node (may be eventual) or the leader if known.
-	for _, n := range s.nodes {
-		if n.Raft.State() == raft.Leader {
-			return n.Search(query, topK)
-		}
-	}
-	if len(s.nodes) > 0 {
-		return s.nodes[0].Search(query, topK)
-	}
-	return nil
-}
-
-func (s *shardGroup) Delete(id string) error {
-	for _, n := range s.nodes {
-		if n.Raft.State() == raft.Leader {
-			return n.Delete(id)
-		}
-	}
-	return fmt.Errorf("no leader for shard")
-}
-
-func (s *shardGroup) Leader() *cluster.RaftNode {
-	for _, n := range s.nodes {
-		if n.Raft.State() == raft.Leader {
-			return n
-		}
-	}
-	return nil
-}
-
 func main() {
 	fmt.Println("Initializing VectraDB (High-Perf) mode...")
 
@@ -74,9 +32,37 @@ func main() {
 	// joinAddr := flag.String("join", "", "Address of the already running service to join to")
 	// nodeID := flag.String("node-id", "node1", "Unique ID for this node")
 	numShards := flag.Int("shards", 3, "The total number of shards of the database")
+	indexFlag := flag.String("index", "hnsw", "Index type of every shard (hnsw, ivf, flat, vamana)")
+	quantFlag := flag.String("quantization", "int8", "Vector encoding of every shard (none, fp16, bf16, int8, pq, binary)")
+	rerank := flag.Bool("rerank", false, "Keep float32 vectors and re-rank quantized search results against them")
+	oversample := flag.Int("oversample", 4, "Candidates fetched per requested result when re-ranking")
+	pqM := flag.Int("pq-m", 0, "PQ sub-quantizers, must divide the dimension (0 = one per ~16 dims)")
+	pqBits := flag.Int("pq-bits", 8, "PQ bits per sub-quantizer code (1-8)")
+	textFields := flag.String("text-fields", "", "Comma separated metadata fields indexed for keyword and hybrid search")
+	grpcPort := flag.Int("grpc-port", 50051, "Port for the gRPC change stream (0 disables it)")
 
 	flag.Parse()
 
+	indexType, err := store.ParseIndexType(*indexFlag)
+	if err != nil {
+		log.Fatalf("invalid -index: %v", err)
+	}
+	log.Printf("Distance kernels: %s", store.Kernels())
+
+	collection := store.DefaultCollectionConfig()
+	collection.Index = indexType
+	collection.Quantization, err = store.ParseQuantizationType(*quantFlag)
+	if err != nil {
+		log.Fatalf("invalid -quantization: %v", err)
+	}
+	collection.PQ.M = *pqM
+	collection.PQ.Bits = *pqBits
+	collection.Rerank = *rerank
+	collection.Oversample = *oversample
+	if *textFields != "" {
+		collection.TextFields = strings.Split(*textFields, ",")
+	}
+
 	const baseDir = "app/data"
 	os.MkdirAll(baseDir, 0755)
 
@@ -91,7 +77,7 @@ func main() {
 			nodeDir := fmt.Sprintf("%s/shard_%d/node_%d", baseDir, i, n)
 			os.MkdirAll(nodeDir, 0755)
 
-			db, err := store.NewVectraDB(128, nodeDir)
+			db, err := store.NewVectraDBWithConfig(128, nodeDir, collection)
 			if err != nil {
 				log.Fatalf("failed to create db for shard %d node %d: %v", i, n, err)
 			}
@@ -156,10 +142,13 @@ func main() {
 			}
 		}
 
-		shards = append(shards, &shardGroup{nodes: nodes})
+		shards = append(shards, cluster.NewShardGroup(nodes))
 	}
 
-	time.Sleep(3 * time.Second) // Wait for elections
+	// Wait for elections and log replay before serving traffic
+	if err := cluster.WaitReady(shards, 30*time.Second); err != nil {
+		log.Printf("warning: cluster not ready: %v", err)
+	}
 	c := store.NewCluster(shards)
 
 	app := fiber.New()
@@ -167,12 +156,34 @@ func main() {
 
 	handler := vectorHttp.NewHandler(c)
 	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+	app.Get("/healthz", handler.Healthz)
+	app.Get("/readyz", handler.Readyz)
 
 	api := app.Group("/api/v1")
 	api.Post("/insert", handler.Insert)
 	api.Post("/search", handler.Search)
+	api.Post("/search/batch", handler.SearchBatch)
+	api.Post("/recommend", handler.Recommend)
 	api.Post("/delete", handler.Delete)
-
+	api.Post("/payload", handler.UpdatePayload)
+	api.Get("/cluster", handler.ClusterStatus)
+	api.Get("/changes", handler.Changes)
+	api.Get("/export", handler.Export)
+
+	admin := api.Group("/admin")
+	admin.Get("/shards", handler.Shards)
+	admin.Post("/learner", handler.AddLearner)
+	admin.Post("/promote", handler.Promote)
+	admin.Post("/remove", handler.RemoveMember)
+	admin.Post("/transfer", handler.TransferLeadership)
+	admin.Get("/index", handler.IndexStats)
+	admin.Post("/retrain", handler.Retrain)
+
+	if *grpcPort > 0 {
+		go func() {
+			log.Fatal(rpc.Serve(fmt.Sprintf(":%d", *grpcPort), c))
+		}()
+	}
 	log.Println("VectraDB listening on port : 8080")
 	log.Fatal(app.Listen(":8080"))
 }
@@ -0,0 +1,138 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/rupamthxt/vectradb/internal/metrics"
+)
+
+const (
+	// BatchWindow is how long the batcher waits for more writes after the first one arrives
+	BatchWindow = 500 * time.Microsecond
+	// MaxBatchSize caps how many commands go into one raft log entry
+	MaxBatchSize = 256
+)
+
+// pendingWrite is a single caller waiting for its encoded command to be applied
+type pendingWrite struct {
+	data []byte
+	done chan error
+}
+
+// applyBatcher implements group commit for a shard: writes that arrive within
+// BatchWindow of each other (up to MaxBatchSize) are replicated as one log
+// entry, and every caller gets back the result of its own command.
+type applyBatcher struct {
+	raft  *raft.Raft
+	queue chan *pendingWrite
+}
+
+func newApplyBatcher(r *raft.Raft) *applyBatcher {
+	b := &applyBatcher{
+		raft:  r,
+		queue: make(chan *pendingWrite, MaxBatchSize),
+	}
+	go b.run()
+	return b
+}
+
+// Apply queues a command and blocks until the FSM has applied it. The command
+// is encoded first, so one that cannot be encoded fails alone instead of
+// failing the batch it would have joined.
+func (b *applyBatcher) Apply(cmd Command) error {
+	if cmd.Op == OpBatch {
+		return errors.New("batches are built by the batcher")
+	}
+	data, err := EncodeCommand(cmd)
+	if err != nil {
+		return err
+	}
+	w := &pendingWrite{data: data, done: make(chan error, 1)}
+	b.queue <- w
+	return <-w.done
+}
+
+func (b *applyBatcher) run() {
+	timer := time.NewTimer(BatchWindow)
+	timer.Stop()
+
+	for first := range b.queue {
+		batch := []*pendingWrite{first}
+
+		timer.Reset(BatchWindow)
+	collect:
+		for len(batch) < MaxBatchSize {
+			select {
+			case w := <-b.queue:
+				batch = append(batch, w)
+			case <-timer.C:
+				break collect
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+
+		b.submit(batch)
+	}
+}
+
+// submit hands the batch to raft and resolves the callers asynchronously, so
+// the next batch can be collected while this one is being replicated. Raft
+// keeps the entries in submission order.
+func (b *applyBatcher) submit(batch []*pendingWrite) {
+	metrics.RaftBatchSize.Observe(float64(len(batch)))
+
+	data := batch[0].data
+	if len(batch) > 1 {
+		entries := make([][]byte, len(batch))
+		for i, w := range batch {
+			entries[i] = w.data
+		}
+		data = appendBatch(nil, entries)
+	}
+
+	future := b.raft.Apply(data, RaftTimeout)
+	go func() {
+		if err := future.Error(); err != nil {
+			for _, w := range batch {
+				w.done <- err
+			}
+			return
+		}
+
+		resp := future.Response()
+		if len(batch) == 1 {
+			batch[0].done <- responseError(resp)
+			return
+		}
+
+		responses, ok := resp.([]interface{})
+		if !ok || len(responses) != len(batch) {
+			err := responseError(resp)
+			if err == nil {
+				err = fmt.Errorf("unexpected batch response %T", resp)
+			}
+			for _, w := range batch {
+				w.done <- err
+			}
+			return
+		}
+		for i, w := range batch {
+			w.done <- responseError(responses[i])
+		}
+	}()
+}
+
+func responseError(resp interface{}) error {
+	if err, ok := resp.(error); ok {
+		return err
+	}
+	return nil
+}
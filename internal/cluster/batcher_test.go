@@ -0,0 +1,47 @@
+package cluster
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// TestBatcherResolvesEachCaller sends good writes together with one that
+// cannot be encoded and one the db rejects, only those two may fail
+func TestBatcherResolvesEachCaller(t *testing.T) {
+	rn := newTestNode(t)
+
+	cmds := make([]Command, 64)
+	for i := range cmds {
+		cmds[i] = Command{Op: OpInsert, Id: fmt.Sprintf("id-%d", i), Vector: []float32{float32(i), 1, 2, 3}}
+	}
+	const unencodable, rejected = 10, 20
+	cmds[unencodable].Sparse = &store.SparseVector{Indices: []uint32{1}}
+	cmds[rejected].Vector = []float32{1}
+
+	errs := make([]error, len(cmds))
+	var wg sync.WaitGroup
+	for i, cmd := range cmds {
+		wg.Add(1)
+		go func(i int, cmd Command) {
+			defer wg.Done()
+			errs[i] = rn.batcher.Apply(cmd)
+		}(i, cmd)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		failed := i == unencodable || i == rejected
+		if failed != (err != nil) {
+			t.Errorf("write %d: err = %v", i, err)
+		}
+		if !failed && !rn.DB.Contains(cmds[i].Id) {
+			t.Errorf("write %d was not applied", i)
+		}
+	}
+	if rn.DB.Contains(cmds[unencodable].Id) || rn.DB.Contains(cmds[rejected].Id) {
+		t.Error("a failed write was applied")
+	}
+}
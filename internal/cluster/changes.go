@@ -0,0 +1,310 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/raft"
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// ChangeBufferSize is how many events a live subscriber may fall behind
+// before it is disconnected and has to resume from its last index.
+const ChangeBufferSize = 1024
+
+var (
+	ErrSubscriberLagged = errors.New("change subscriber fell behind, resume from the last received index")
+	ErrLogCompacted     = errors.New("requested index has been compacted into a snapshot")
+)
+
+// ChangeEvent describes one mutation applied by the FSM. Every command of a
+// batched log entry shares the entry's raft index, Pos numbers the events of
+// an entry and Last marks the final one.
+type ChangeEvent struct {
+	Shard  int
+	Index  uint64
+	Pos    int
+	Last   bool
+	Op     string
+	ID     string
+	Vector []float32
+	Sparse *store.SparseVector
+	Data   json.RawMessage
+}
+
+// ChangeCursor is a position in the change stream of one shard: every event
+// of the entries up to Index has been seen, and so have the first Seen events
+// of the entry after it when a client stopped in the middle of a batch
+type ChangeCursor struct {
+	Index uint64
+	Seen  int
+}
+
+// Cursor returns the position right after the event
+func (ev ChangeEvent) Cursor() ChangeCursor {
+	if ev.Last {
+		return ChangeCursor{Index: ev.Index}
+	}
+	return ChangeCursor{Index: ev.Index - 1, Seen: ev.Pos + 1}
+}
+
+// covers reports whether the event is at or before the cursor
+func (c ChangeCursor) covers(ev ChangeEvent) bool {
+	return ev.Index <= c.Index || (ev.Index == c.Index+1 && ev.Pos < c.Seen)
+}
+
+// changeFeed fans FSM mutations out to live subscribers
+type changeFeed struct {
+	mu   sync.Mutex
+	subs map[chan ChangeEvent]struct{}
+	last uint64 // raft index of the last published entry
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{subs: make(map[chan ChangeEvent]struct{})}
+}
+
+// subscribe registers a live subscriber. Every entry after the returned
+// index will be delivered on the channel.
+func (f *changeFeed) subscribe() (chan ChangeEvent, uint64) {
+	ch := make(chan ChangeEvent, ChangeBufferSize)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subs[ch] = struct{}{}
+	return ch, f.last
+}
+
+func (f *changeFeed) unsubscribe(ch chan ChangeEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subs[ch]; ok {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+// publish never blocks the FSM: a subscriber whose buffer is full is dropped.
+func (f *changeFeed) publish(index uint64, events []ChangeEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.last = index
+	for ch := range f.subs {
+		if !trySend(ch, events) {
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func trySend(ch chan ChangeEvent, events []ChangeEvent) bool {
+	for _, ev := range events {
+		select {
+		case ch <- ev:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ChangeStream delivers the change events of one shard, first replayed from
+// the raft log and then live as the FSM applies them.
+type ChangeStream struct {
+	C <-chan ChangeEvent
+	// Start is the position the stream continues from, the first event
+	// delivered comes after it
+	Start ChangeCursor
+
+	err error
+
+	feed *changeFeed
+	live chan ChangeEvent
+	done chan struct{}
+	once sync.Once
+}
+
+// Err reports why the stream ended once C has been closed.
+func (s *ChangeStream) Err() error {
+	return s.err
+}
+
+// Close stops the stream and releases the live subscription.
+func (s *ChangeStream) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.feed.unsubscribe(s.live)
+	})
+}
+
+// Changes streams every mutation applied after the given position. The zero
+// cursor only follows new changes. Older entries are read back from the log
+// store, so resuming only works while they have not been compacted.
+func (rn *RaftNode) Changes(from ChangeCursor) (*ChangeStream, error) {
+	after := from.Index
+	resume := from != ChangeCursor{}
+	if resume {
+		first, err := rn.logs.FirstIndex()
+		if err != nil {
+			return nil, err
+		}
+		if first > 0 && after+1 < first {
+			return nil, fmt.Errorf("%w: first available index is %d", ErrLogCompacted, first)
+		}
+	}
+
+	// Everything up to published has already gone out to live subscribers,
+	// so it is replayed from the log and the live channel covers the rest.
+	live, published := rn.FSM.changes.subscribe()
+	out := make(chan ChangeEvent)
+	start := from
+	if !resume || published > after {
+		start = ChangeCursor{Index: published}
+	}
+	stream := &ChangeStream{
+		C:     out,
+		Start: start,
+		feed:  rn.FSM.changes,
+		live:  live,
+		done:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(out)
+
+		send := func(ev ChangeEvent) bool {
+			select {
+			case out <- ev:
+				return true
+			case <-stream.done:
+				return false
+			}
+		}
+
+		if resume {
+			for idx := after + 1; idx <= published; idx++ {
+				var entry raft.Log
+				if err := rn.logs.GetLog(idx, &entry); err != nil {
+					stream.err = fmt.Errorf("reading log index %d: %w", idx, err)
+					return
+				}
+				if entry.Type != raft.LogCommand {
+					continue
+				}
+				cmd, err := DecodeCommand(entry.Data)
+				if err != nil {
+					stream.err = err
+					return
+				}
+				for _, ev := range rn.FSM.events(idx, cmd) {
+					if from.covers(ev) {
+						continue
+					}
+					if !send(ev) {
+						return
+					}
+				}
+			}
+		}
+
+		for {
+			select {
+			case ev, ok := <-live:
+				if !ok {
+					select {
+					case <-stream.done:
+					default:
+						stream.err = ErrSubscriberLagged
+					}
+					return
+				}
+				if stream.Start.covers(ev) {
+					continue
+				}
+				if !send(ev) {
+					return
+				}
+			case <-stream.done:
+				return
+			}
+		}
+	}()
+
+	return stream, nil
+}
+
+// Changes follows the node that serves the shard's reads. Every replica
+// applies the same log, so indexes are comparable across leadership changes.
+func (s *ShardGroup) Changes(from ChangeCursor) (*ChangeStream, error) {
+	n := s.reader()
+	if n == nil {
+		return nil, errors.New("shard has no nodes")
+	}
+	return n.Changes(from)
+}
+
+// ErrChangesUnsupported is returned for shards that cannot stream changes
+var ErrChangesUnsupported = errors.New("shard does not support change streams")
+
+// ChangeSource is a shard that can stream its changes, ShardGroup is one
+type ChangeSource interface {
+	Changes(from ChangeCursor) (*ChangeStream, error)
+}
+
+// ClusterChanges follows the change streams of every shard of a cluster
+type ClusterChanges struct {
+	// Start is the position each shard's stream continues from
+	Start   map[int]ChangeCursor
+	streams []*ChangeStream
+}
+
+// FollowChanges opens a change stream on every shard, resuming each one from
+// its cursor in from. Shards missing from from only follow new changes.
+func FollowChanges(c *store.Cluster, from map[int]ChangeCursor) (*ClusterChanges, error) {
+	cc := &ClusterChanges{Start: make(map[int]ChangeCursor, c.NumShards())}
+	for i := 0; i < c.NumShards(); i++ {
+		source, ok := c.GetShardByID(i).(ChangeSource)
+		if !ok {
+			cc.Close()
+			return nil, fmt.Errorf("shard %d: %w", i, ErrChangesUnsupported)
+		}
+		stream, err := source.Changes(from[i])
+		if err != nil {
+			cc.Close()
+			return nil, fmt.Errorf("shard %d: %w", i, err)
+		}
+		cc.streams = append(cc.streams, stream)
+		cc.Start[i] = stream.Start
+	}
+	return cc, nil
+}
+
+// Events merges the shard streams until quit is closed. The error channel
+// reports the first shard stream that ended on its own.
+func (cc *ClusterChanges) Events(quit <-chan struct{}) (<-chan ChangeEvent, <-chan error) {
+	merged := make(chan ChangeEvent)
+	failed := make(chan error, len(cc.streams))
+	for _, s := range cc.streams {
+		go func(s *ChangeStream) {
+			for ev := range s.C {
+				select {
+				case merged <- ev:
+				case <-quit:
+					return
+				}
+			}
+			if err := s.Err(); err != nil {
+				failed <- err
+			}
+		}(s)
+	}
+	return merged, failed
+}
+
+// Close stops every shard stream
+func (cc *ClusterChanges) Close() {
+	for _, s := range cc.streams {
+		s.Close()
+	}
+}
@@ -0,0 +1,177 @@
+package cluster
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// nextEvents reads n events from the stream
+func nextEvents(t *testing.T, stream *ChangeStream, n int) []ChangeEvent {
+	t.Helper()
+	var events []ChangeEvent
+	timeout := time.After(5 * time.Second)
+	for len(events) < n {
+		select {
+		case ev, ok := <-stream.C:
+			if !ok {
+				t.Fatalf("stream ended after %d events: %v", len(events), stream.Err())
+			}
+			events = append(events, ev)
+		case <-timeout:
+			t.Fatalf("got %d events, want %d", len(events), n)
+		}
+	}
+	return events
+}
+
+// expectNoEvent checks that the stream has nothing more to deliver
+func expectNoEvent(t *testing.T, stream *ChangeStream) {
+	t.Helper()
+	select {
+	case ev := <-stream.C:
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func eventOps(events []ChangeEvent) []string {
+	ops := make([]string, len(events))
+	for i, ev := range events {
+		ops[i] = ev.Op + " " + ev.ID
+	}
+	return ops
+}
+
+func TestChangeEventOps(t *testing.T) {
+	rn := newTestNode(t)
+	start := rn.Raft.AppliedIndex()
+
+	live, err := rn.Changes(ChangeCursor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+
+	vec := []float32{1, 2, 3, 4}
+	writes := []struct {
+		cmd     Command
+		wantErr error
+	}{
+		{Command{Op: OpInsert, Id: "a", Vector: vec}, nil},
+		{Command{Op: OpInsert, Id: "a", Vector: vec, Data: []byte(`{"v":2}`)}, nil},
+		{Command{Op: OpUpdatePayload, Id: "a", Data: []byte(`{"v":3}`)}, nil},
+		{Command{Op: OpUpdatePayload, Id: "b", Data: []byte(`{"v":1}`)}, store.ErrRecordNotFound},
+		{Command{Op: OpDelete, Id: "a"}, nil},
+		{Command{Op: OpDelete, Id: "a"}, nil},
+		{Command{Op: OpInsert, Id: "a", Vector: vec}, nil},
+	}
+	for i, w := range writes {
+		if err := rn.batcher.Apply(w.cmd); !errors.Is(err, w.wantErr) {
+			t.Fatalf("write %d: err = %v, want %v", i, err, w.wantErr)
+		}
+	}
+	want := []string{"insert a", "upsert a", "payload_update a", "delete a", "insert a"}
+
+	if got := eventOps(nextEvents(t, live, len(want))); !slices.Equal(got, want) {
+		t.Fatalf("live events %v, want %v", got, want)
+	}
+	expectNoEvent(t, live)
+
+	replay, err := rn.Changes(ChangeCursor{Index: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	if got := eventOps(nextEvents(t, replay, len(want))); !slices.Equal(got, want) {
+		t.Fatalf("replayed events %v, want %v", got, want)
+	}
+	expectNoEvent(t, replay)
+}
+
+func TestChangeCursor(t *testing.T) {
+	mid := ChangeEvent{Index: 10, Pos: 1}
+	last := ChangeEvent{Index: 10, Pos: 2, Last: true}
+	if got := mid.Cursor(); got != (ChangeCursor{Index: 9, Seen: 2}) {
+		t.Fatalf("cursor of a mid batch event = %+v", got)
+	}
+	if got := last.Cursor(); got != (ChangeCursor{Index: 10}) {
+		t.Fatalf("cursor of the last event = %+v", got)
+	}
+
+	tests := []struct {
+		cursor ChangeCursor
+		ev     ChangeEvent
+		covers bool
+	}{
+		{ChangeCursor{Index: 10}, ChangeEvent{Index: 10, Pos: 5}, true},
+		{ChangeCursor{Index: 10}, ChangeEvent{Index: 11}, false},
+		{ChangeCursor{Index: 9, Seen: 2}, ChangeEvent{Index: 9}, true},
+		{ChangeCursor{Index: 9, Seen: 2}, ChangeEvent{Index: 10, Pos: 1}, true},
+		{ChangeCursor{Index: 9, Seen: 2}, ChangeEvent{Index: 10, Pos: 2}, false},
+		{ChangeCursor{Index: 9, Seen: 2}, ChangeEvent{Index: 11}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.cursor.covers(tt.ev); got != tt.covers {
+			t.Errorf("%+v covers %+v = %v, want %v", tt.cursor, tt.ev, got, tt.covers)
+		}
+	}
+}
+
+// TestChangesResumeInsideBatch stops in the middle of a batched entry whose
+// second command is rejected and resumes from the cursor of the last event seen
+func TestChangesResumeInsideBatch(t *testing.T) {
+	rn := newTestNode(t)
+	start := rn.Raft.AppliedIndex()
+
+	vec := []float32{1, 2, 3, 4}
+	data, err := EncodeBatch([]Command{
+		{Op: OpInsert, Id: "a", Vector: vec},
+		{Op: OpInsert, Id: "bad", Vector: []float32{1}},
+		{Op: OpInsert, Id: "b", Vector: vec},
+		{Op: OpInsert, Id: "c", Vector: vec},
+		{Op: OpInsert, Id: "a", Vector: vec},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rn.Raft.Apply(data, time.Second).Error(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rn.batcher.Apply(Command{Op: OpDelete, Id: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := rn.Changes(ChangeCursor{Index: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := nextEvents(t, all, 5)
+	all.Close()
+	want := []string{"insert a", "insert b", "insert c", "upsert a", "delete b"}
+	if got := eventOps(events); !slices.Equal(got, want) {
+		t.Fatalf("events %v, want %v", got, want)
+	}
+	for i, ev := range events[:4] {
+		if ev.Pos != i || ev.Last != (i == 3) {
+			t.Fatalf("event %d: pos %d last %v", i, ev.Pos, ev.Last)
+		}
+	}
+
+	// Resuming after every event delivers exactly the events after it
+	for i, ev := range events {
+		stream, err := rn.Changes(ev.Cursor())
+		if err != nil {
+			t.Fatal(err)
+		}
+		rest := nextEvents(t, stream, len(events)-i-1)
+		if got := eventOps(rest); !slices.Equal(got, want[i+1:]) {
+			t.Fatalf("resumed after %q at %+v: got %v, want %v", want[i], ev.Cursor(), got, want[i+1:])
+		}
+		expectNoEvent(t, stream)
+		stream.Close()
+	}
+}
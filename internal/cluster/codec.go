@@ -0,0 +1,287 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// Raft log entries start with a header byte that identifies their encoding.
+// Entries written before the binary format existed are plain JSON objects,
+// so their first byte is always '{'.
+const (
+	formatJSON     byte = '{'
+	formatBinaryV1 byte = 0x01
+)
+
+const (
+	OpInsert        = "insert"
+	OpDelete        = "delete"
+	OpUpdatePayload = "payload_update"
+	OpRetrain       = "retrain"
+	OpBatch         = "batch"
+
+	// OpUpsert is only used by change events, for an insert that replaced
+	// an existing record
+	OpUpsert = "upsert"
+)
+
+// Op codes used by the binary format
+const (
+	opCodeInsert        byte = 1
+	opCodeDelete        byte = 2
+	opCodeBatch         byte = 3
+	opCodeUpdatePayload byte = 4
+	opCodeRetrain       byte = 5
+)
+
+var (
+	errShortCommand  = errors.New("truncated command")
+	errTrailingBytes = errors.New("unexpected bytes after command")
+)
+
+// EncodeCommand serializes a command using the compact binary layout:
+//
+//	[header][op][uvarint len(id)][id][uvarint dim][dim x float32 LE][uvarint len(data)][data]
+//
+// A command with a sparse vector appends it after the data:
+//
+//	[uvarint nnz][nnz x uint32 LE][nnz x float32 LE]
+//
+// Entries without it end after the data, as they did before sparse vectors existed.
+func EncodeCommand(cmd Command) ([]byte, error) {
+	if cmd.Op == OpBatch {
+		return EncodeBatch(cmd.Batch)
+	}
+
+	op, err := opCode(cmd.Op)
+	if err != nil {
+		return nil, err
+	}
+
+	size := 2 + 3*binary.MaxVarintLen64 + len(cmd.Id) + 4*len(cmd.Vector) + len(cmd.Data)
+	if cmd.Sparse != nil {
+		size += binary.MaxVarintLen64 + 8*len(cmd.Sparse.Indices)
+	}
+	buf := make([]byte, 0, size)
+
+	buf = append(buf, formatBinaryV1, op)
+	buf = binary.AppendUvarint(buf, uint64(len(cmd.Id)))
+	buf = append(buf, cmd.Id...)
+	buf = binary.AppendUvarint(buf, uint64(len(cmd.Vector)))
+	for _, v := range cmd.Vector {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(cmd.Data)))
+	buf = append(buf, cmd.Data...)
+
+	if cmd.Sparse != nil {
+		if len(cmd.Sparse.Indices) != len(cmd.Sparse.Values) {
+			return nil, errors.New("sparse vector indices and values differ in length")
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(cmd.Sparse.Indices)))
+		for _, i := range cmd.Sparse.Indices {
+			buf = binary.LittleEndian.AppendUint32(buf, i)
+		}
+		for _, v := range cmd.Sparse.Values {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+		}
+	}
+
+	return buf, nil
+}
+
+// EncodeBatch packs several commands into a single log entry:
+//
+//	[header][batch op][uvarint count]([uvarint len][encoded command])...
+func EncodeBatch(cmds []Command) ([]byte, error) {
+	entries := make([][]byte, len(cmds))
+	for i, cmd := range cmds {
+		if cmd.Op == OpBatch {
+			return nil, errors.New("batches cannot be nested")
+		}
+		entry, err := EncodeCommand(cmd)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = entry
+	}
+	return appendBatch(nil, entries), nil
+}
+
+// appendBatch packs already encoded commands into a batch entry
+func appendBatch(buf []byte, entries [][]byte) []byte {
+	buf = append(buf, formatBinaryV1, opCodeBatch)
+	buf = binary.AppendUvarint(buf, uint64(len(entries)))
+	for _, entry := range entries {
+		buf = binary.AppendUvarint(buf, uint64(len(entry)))
+		buf = append(buf, entry...)
+	}
+	return buf
+}
+
+// DecodeCommand parses a raft log entry in either the binary or the legacy JSON format.
+func DecodeCommand(b []byte) (Command, error) {
+	if len(b) == 0 {
+		return Command{}, errShortCommand
+	}
+
+	switch b[0] {
+	case formatJSON:
+		var cmd Command
+		if err := json.Unmarshal(b, &cmd); err != nil {
+			return Command{}, err
+		}
+		return cmd, nil
+	case formatBinaryV1:
+		return decodeBinaryV1(b[1:])
+	default:
+		return Command{}, fmt.Errorf("unknown command format 0x%02x", b[0])
+	}
+}
+
+func decodeBinaryV1(b []byte) (Command, error) {
+	var cmd Command
+
+	if len(b) < 1 {
+		return cmd, errShortCommand
+	}
+	op, err := opName(b[0])
+	if err != nil {
+		return cmd, err
+	}
+	cmd.Op = op
+	b = b[1:]
+
+	if op == OpBatch {
+		return decodeBatchV1(b)
+	}
+
+	id, b, err := readBytes(b, 1)
+	if err != nil {
+		return cmd, err
+	}
+	cmd.Id = string(id)
+
+	vec, b, err := readBytes(b, 4)
+	if err != nil {
+		return cmd, err
+	}
+	if len(vec) > 0 {
+		cmd.Vector = make([]float32, len(vec)/4)
+		for i := range cmd.Vector {
+			cmd.Vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(vec[i*4:]))
+		}
+	}
+
+	data, b, err := readBytes(b, 1)
+	if err != nil {
+		return cmd, err
+	}
+	if len(data) > 0 {
+		// copy so the command does not pin the raft log buffer
+		cmd.Data = append(json.RawMessage(nil), data...)
+	}
+
+	if len(b) > 0 {
+		// indices and values, 4 bytes each per non-zero
+		sparse, rest, err := readBytes(b, 8)
+		if err != nil {
+			return cmd, err
+		}
+		if len(rest) > 0 {
+			return cmd, errTrailingBytes
+		}
+		nnz := len(sparse) / 8
+		cmd.Sparse = &store.SparseVector{
+			Indices: make([]uint32, nnz),
+			Values:  make([]float32, nnz),
+		}
+		for i := 0; i < nnz; i++ {
+			cmd.Sparse.Indices[i] = binary.LittleEndian.Uint32(sparse[i*4:])
+			cmd.Sparse.Values[i] = math.Float32frombits(binary.LittleEndian.Uint32(sparse[(nnz+i)*4:]))
+		}
+	}
+
+	return cmd, nil
+}
+
+func decodeBatchV1(b []byte) (Command, error) {
+	count, read := binary.Uvarint(b)
+	if read <= 0 || count > uint64(len(b)) {
+		return Command{}, errShortCommand
+	}
+	b = b[read:]
+
+	cmd := Command{Op: OpBatch, Batch: make([]Command, 0, count)}
+	for i := uint64(0); i < count; i++ {
+		var entry []byte
+		var err error
+		entry, b, err = readBytes(b, 1)
+		if err != nil {
+			return Command{}, err
+		}
+		sub, err := DecodeCommand(entry)
+		if err != nil {
+			return Command{}, err
+		}
+		if sub.Op == OpBatch {
+			return Command{}, errors.New("batches cannot be nested")
+		}
+		cmd.Batch = append(cmd.Batch, sub)
+	}
+	return cmd, nil
+}
+
+// readBytes reads a uvarint element count followed by count*width bytes
+func readBytes(b []byte, width int) ([]byte, []byte, error) {
+	n, read := binary.Uvarint(b)
+	if read <= 0 {
+		return nil, nil, errShortCommand
+	}
+	b = b[read:]
+	if n > uint64(len(b)) {
+		return nil, nil, errShortCommand
+	}
+	size := n * uint64(width)
+	if size > uint64(len(b)) {
+		return nil, nil, errShortCommand
+	}
+	return b[:size], b[size:], nil
+}
+
+func opCode(op string) (byte, error) {
+	switch op {
+	case OpInsert:
+		return opCodeInsert, nil
+	case OpDelete:
+		return opCodeDelete, nil
+	case OpUpdatePayload:
+		return opCodeUpdatePayload, nil
+	case OpRetrain:
+		return opCodeRetrain, nil
+	default:
+		return 0, fmt.Errorf("unknown command: %s", op)
+	}
+}
+
+func opName(code byte) (string, error) {
+	switch code {
+	case opCodeInsert:
+		return OpInsert, nil
+	case opCodeDelete:
+		return OpDelete, nil
+	case opCodeBatch:
+		return OpBatch, nil
+	case opCodeUpdatePayload:
+		return OpUpdatePayload, nil
+	case opCodeRetrain:
+		return OpRetrain, nil
+	default:
+		return "", fmt.Errorf("unknown command op code %d", code)
+	}
+}
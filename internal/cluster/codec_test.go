@@ -0,0 +1,149 @@
+package cluster
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+func TestCommandRoundTrip(t *testing.T) {
+	insert := Command{Op: OpInsert, Id: "a", Vector: []float32{1, -2.5, 3e-8}, Data: json.RawMessage(`{"k":1}`)}
+	sparse := Command{
+		Op:     OpInsert,
+		Id:     "s",
+		Vector: []float32{0.5},
+		Sparse: &store.SparseVector{Indices: []uint32{3, 70000}, Values: []float32{0.25, -1}},
+		Data:   json.RawMessage(`"text"`),
+	}
+	tests := []struct {
+		name string
+		cmd  Command
+	}{
+		{"insert", insert},
+		{"insert without data", Command{Op: OpInsert, Id: "b", Vector: []float32{1}}},
+		{"unicode id", Command{Op: OpInsert, Id: "ünï-✓", Vector: []float32{2}}},
+		{"delete", Command{Op: OpDelete, Id: "a"}},
+		{"payload update", Command{Op: OpUpdatePayload, Id: "a", Data: json.RawMessage(`{"k":2}`)}},
+		{"sparse", sparse},
+		{"empty sparse", Command{Op: OpInsert, Id: "e", Vector: []float32{1}, Sparse: &store.SparseVector{Indices: []uint32{}, Values: []float32{}}}},
+		{"batch", Command{Op: OpBatch, Batch: []Command{insert, {Op: OpDelete, Id: "x"}, sparse}}},
+		{"empty batch", Command{Op: OpBatch, Batch: []Command{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := EncodeCommand(tt.cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeCommand(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.cmd) {
+				t.Fatalf("got %+v want %+v", got, tt.cmd)
+			}
+		})
+	}
+}
+
+// TestDecodeLegacyJSON reads entries written before the binary format
+func TestDecodeLegacyJSON(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  Command
+	}{
+		{
+			`{"op":"insert","id":"a","vector":[1,2.5],"data":{"k":"v"}}`,
+			Command{Op: OpInsert, Id: "a", Vector: []float32{1, 2.5}, Data: json.RawMessage(`{"k":"v"}`)},
+		},
+		{
+			`{"op":"delete","id":"a","vector":null,"data":null}`,
+			Command{Op: OpDelete, Id: "a", Data: json.RawMessage(`null`)},
+		},
+	}
+	for _, tt := range tests {
+		got, err := DecodeCommand([]byte(tt.entry))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.entry, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: got %+v want %+v", tt.entry, got, tt.want)
+		}
+	}
+}
+
+// TestDecodeRejectsCorruptInput makes sure a damaged entry is reported instead
+// of being applied as a different command
+func TestDecodeRejectsCorruptInput(t *testing.T) {
+	cmd := Command{Op: OpInsert, Id: "abc", Vector: []float32{1, 2, 3}, Data: json.RawMessage(`{"k":1}`)}
+	dense, err := EncodeCommand(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Sparse = &store.SparseVector{Indices: []uint32{1, 2}, Values: []float32{1, 2}}
+	insert, err := EncodeCommand(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := EncodeBatch([]Command{{Op: OpDelete, Id: "a"}, {Op: OpDelete, Id: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested := []byte{formatBinaryV1, opCodeBatch, 1, byte(len(batch))}
+	nested = append(nested, batch...)
+
+	tests := []struct {
+		name  string
+		entry []byte
+	}{
+		{"empty", nil},
+		{"unknown format", []byte{0x7f, opCodeInsert}},
+		{"unknown op", []byte{formatBinaryV1, 9, 0, 0, 0}},
+		{"header only", []byte{formatBinaryV1}},
+		{"broken json", []byte(`{"op":"insert","id":`)},
+		{"trailing byte", append(append([]byte(nil), insert...), 0)},
+		{"nested batch", nested},
+		{"batch count too large", []byte{formatBinaryV1, opCodeBatch, 5, 1}},
+	}
+	// Every truncation of a valid entry must fail. Cutting the sparse vector
+	// off entirely leaves a valid entry written before sparse vectors existed.
+	for n := 1; n < len(insert); n++ {
+		if n == len(dense) {
+			continue
+		}
+		tests = append(tests, struct {
+			name  string
+			entry []byte
+		}{"truncated insert", insert[:n]})
+	}
+	for n := 2; n < len(batch); n++ {
+		tests = append(tests, struct {
+			name  string
+			entry []byte
+		}{"truncated batch", batch[:n]})
+	}
+
+	for _, tt := range tests {
+		if cmd, err := DecodeCommand(tt.entry); err == nil {
+			t.Errorf("%s %x: decoded %+v, want an error", tt.name, tt.entry, cmd)
+		}
+	}
+}
+
+func TestEncodeRejectsInvalidCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  Command
+	}{
+		{"unknown op", Command{Op: "upsert"}},
+		{"sparse length mismatch", Command{Op: OpInsert, Sparse: &store.SparseVector{Indices: []uint32{1}}}},
+		{"nested batch", Command{Op: OpBatch, Batch: []Command{{Op: OpBatch}}}},
+	}
+	for _, tt := range tests {
+		if _, err := EncodeCommand(tt.cmd); err == nil {
+			t.Errorf("%s: encoded without an error", tt.name)
+		}
+	}
+}
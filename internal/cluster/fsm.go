@@ -1,87 +1,356 @@
 package cluster
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
+	"sync"
 
 	"github.com/hashicorp/raft"
 	"github.com/rupamthxt/vectradb/internal/store"
 )
 
-// Command is what we replicate across the network
+// Command is what we replicate across the network.
+// New entries are written with EncodeCommand, the JSON tags are kept
+// so log entries from older versions can still be decoded.
 type Command struct {
-	Op     string          `json:"op"` // Insert, Delete
-	Id     string          `json:"id"`
-	Vector []float32       `json:"vector"`
-	Data   json.RawMessage `json:"data"`
+	Op     string              `json:"op"` // Insert, Delete, UpdatePayload, Retrain
+	Id     string              `json:"id"`
+	Vector []float32           `json:"vector"`
+	Sparse *store.SparseVector `json:"sparse,omitempty"`
+	Data   json.RawMessage     `json:"data"`
+	Batch  []Command           `json:"batch,omitempty"` // only set for OpBatch
 }
 
 type FSM struct {
-	db *store.VectraDB
+	shardID int
+	db      *store.VectraDB
+	changes *changeFeed
+
+	// applied is the last log index the db holds the effect of. Entries up
+	// to skipUntil are already part of the checkpoint or snapshot the db was
+	// loaded from and are not applied again when raft replays them. mu is
+	// held while an entry is applied, a snapshot being persisted takes it to
+	// checkpoint the db at a known index.
+	mu        sync.Mutex
+	applied   uint64
+	skipUntil uint64
+
+	// outcomes holds, by raft index, what the commands of recent entries did
+	// when the log alone cannot tell: commands that changed nothing produce
+	// no change event and inserts that replaced a record are upserts. The
+	// same events come out live and when the entry is replayed from the log.
+	// It is kept in the stable store because entries inside a checkpoint are
+	// not applied again.
+	outcomesMu sync.Mutex
+	outcomes   map[uint64]entryOutcome
+	stable     raft.StableStore
+	logs       raft.LogStore
 }
 
-func NewFSM(db *store.VectraDB) *FSM {
-	return &FSM{db: db}
+// entryOutcome lists, by position in the entry, the commands that changed
+// nothing, because the db rejected them or they deleted an unknown id, and
+// the inserts of ids that already existed
+type entryOutcome struct {
+	Failed  []int `json:"failed,omitempty"`
+	Upserts []int `json:"upserts,omitempty"`
 }
 
-// Apply applies a Raft Log Entry to the FSM.
-func (f *FSM) Apply(log *raft.Log) interface{} {
-	var cmd Command
-	if err := json.Unmarshal(log.Data, &cmd); err != nil {
-		return fmt.Errorf("failed to unmarshal command: %w", err)
+// outcomesKey is the stable store key of FSM.outcomes
+var outcomesKey = []byte("vectradb_entry_outcomes")
+
+func NewFSM(shardID int, db *store.VectraDB) *FSM {
+	return &FSM{
+		shardID:   shardID,
+		db:        db,
+		changes:   newChangeFeed(),
+		applied:   db.CheckpointIndex(),
+		skipUntil: db.CheckpointIndex(),
+		outcomes:  make(map[uint64]entryOutcome),
 	}
+}
 
-	switch cmd.Op {
-	case "insert":
-		return f.db.Insert(cmd.Id, cmd.Vector, cmd.Data)
-	case "delete":
-		f.db.HNSW.Delete(cmd.Id)
+// attach gives the FSM the node's stores and loads the entry outcomes
+// recorded before a restart. It must run before raft starts applying.
+func (f *FSM) attach(logs raft.LogStore, stable raft.StableStore) error {
+	f.logs, f.stable = logs, stable
+
+	data, err := stable.Get(outcomesKey)
+	if err != nil || len(data) == 0 {
+		// Missing keys are reported as errors by some stores
 		return nil
-	default:
-		return fmt.Errorf("unknown command: %s", cmd.Op)
 	}
+	return json.Unmarshal(data, &f.outcomes)
 }
 
-func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
-	// Obtain a read lock on the HNSW index to ensure consistency during snapshot
-	f.db.HNSW.RLock()
-	defer f.db.HNSW.RUnlock()
+// outcomeAt returns what the commands of an entry did
+func (f *FSM) outcomeAt(index uint64) entryOutcome {
+	f.outcomesMu.Lock()
+	defer f.outcomesMu.Unlock()
+	return f.outcomes[index]
+}
+
+// recordOutcome remembers the outcome of an entry and forgets those of entries
+// that have been compacted out of the log
+func (f *FSM) recordOutcome(index uint64, outcome entryOutcome) error {
+	f.outcomesMu.Lock()
+	defer f.outcomesMu.Unlock()
+
+	f.outcomes[index] = outcome
+	if f.logs != nil {
+		if first, err := f.logs.FirstIndex(); err == nil {
+			for idx := range f.outcomes {
+				if idx < first {
+					delete(f.outcomes, idx)
+				}
+			}
+		}
+	}
+	return f.saveOutcomes()
+}
+
+func (f *FSM) saveOutcomes() error {
+	if f.stable == nil {
+		return nil
+	}
+	data, err := json.Marshal(f.outcomes)
+	if err != nil {
+		return err
+	}
+	return f.stable.Set(outcomesKey, data)
+}
 
-	var records []VectorRecord
+// Apply applies a Raft Log Entry to the FSM.
+func (f *FSM) Apply(log *raft.Log) interface{} {
+	cmd, err := DecodeCommand(log.Data)
+	if err != nil {
+		return fmt.Errorf("failed to decode command: %w", err)
+	}
 
-	for id, nodes := range f.db.HNSW.Nodes {
+	f.mu.Lock()
+	// A batch answers with one response per command, in order
+	var resp interface{}
+	if log.Index <= f.skipUntil {
+		// Replayed on boot, the checkpoint already holds its effect and
+		// its outcome was recorded when it was first applied
+	} else {
+		var outcome entryOutcome
+		note := func(i int, op string) {
+			switch op {
+			case "":
+				outcome.Failed = append(outcome.Failed, i)
+			case OpUpsert:
+				outcome.Upserts = append(outcome.Upserts, i)
+			}
+		}
+		if cmd.Op == OpBatch {
+			responses := make([]interface{}, len(cmd.Batch))
+			for i, sub := range cmd.Batch {
+				var op string
+				responses[i], op = f.apply(sub)
+				note(i, op)
+			}
+			resp = responses
+		} else {
+			var op string
+			resp, op = f.apply(cmd)
+			note(0, op)
+		}
+		if len(outcome.Failed) > 0 || len(outcome.Upserts) > 0 {
+			// A failed write only loses the outcome across a restart, the
+			// in-memory copy keeps live events and replays right until then
+			_ = f.recordOutcome(log.Index, outcome)
+		}
+	}
+	f.applied = max(f.applied, log.Index)
+	f.mu.Unlock()
 
-		// If node is tombstone, just skip it. We won't write it in snapshot.
-		if f.db.HNSW.Tombstones[id] {
+	f.changes.publish(log.Index, f.events(log.Index, cmd))
+	return resp
+}
+
+// events converts an applied entry into the change events it produced.
+// Commands that changed nothing or no record, like a retrain, are left out
+// and inserts of existing ids are reported as upserts.
+func (f *FSM) events(index uint64, cmd Command) []ChangeEvent {
+	cmds := []Command{cmd}
+	if cmd.Op == OpBatch {
+		cmds = cmd.Batch
+	}
+	outcome := f.outcomeAt(index)
+
+	events := make([]ChangeEvent, 0, len(cmds))
+	for i, c := range cmds {
+		if c.Op == OpRetrain || slices.Contains(outcome.Failed, i) {
 			continue
 		}
-		vec, err := f.db.Arena.Get(nodes.ArenaOffset)
-		if err == nil {
-			records = append(records, VectorRecord{
-				ID:     id,
-				Vector: vec.Dequantize(),
-			})
+		op := c.Op
+		if slices.Contains(outcome.Upserts, i) {
+			op = OpUpsert
+		}
+		events = append(events, ChangeEvent{
+			Shard:  f.shardID,
+			Index:  index,
+			Pos:    len(events),
+			Op:     op,
+			ID:     c.Id,
+			Vector: c.Vector,
+			Sparse: c.Sparse,
+			Data:   c.Data,
+		})
+	}
+	if len(events) > 0 {
+		events[len(events)-1].Last = true
+	}
+	return events
+}
+
+// apply runs one command against the db and returns the op of its change
+// event. op is empty when the command was rejected or, like a delete of an
+// unknown id, had no effect.
+func (f *FSM) apply(cmd Command) (resp interface{}, op string) {
+	// FSM.Apply is the only writer, nothing can change the id in between
+	existed := f.db.Contains(cmd.Id)
+	switch cmd.Op {
+	case OpInsert:
+		if err := f.db.InsertWithSparse(cmd.Id, cmd.Vector, cmd.Sparse, cmd.Data); err != nil {
+			return err, ""
+		}
+		if existed {
+			return nil, OpUpsert
+		}
+		return nil, OpInsert
+	case OpDelete:
+		if err := f.db.Delete(cmd.Id); err != nil || !existed {
+			return err, ""
+		}
+		return nil, OpDelete
+	case OpUpdatePayload:
+		if err := f.db.UpdatePayload(cmd.Id, cmd.Data); err != nil {
+			return err, ""
+		}
+		return nil, OpUpdatePayload
+	case OpRetrain:
+		// Training is seeded and samples in apply order, so every replica
+		// ends up with the same centroids
+		if err := f.db.Retrain(); err != nil {
+			return err, ""
 		}
+		return nil, OpRetrain
+	default:
+		return fmt.Errorf("unknown command: %s", cmd.Op), ""
 	}
+}
 
-	return &fsmSnapshot{records: records}, nil
+// Snapshot hands raft a snapshot that is written in Persist, off the FSM
+// goroutine. It holds the state as of the entry applied when Persist runs,
+// which can be later than the index raft records for the snapshot.
+func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
+	return &fsmSnapshot{fsm: f}, nil
+}
+
+// persist checkpoints the collection and writes the snapshot: a header, then
+// one record per live id. Entries are not applied meanwhile, so the checkpoint
+// and the records hold the same state.
+func (f *FSM) persist(w io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// On restart the checkpoint is mapped from disk and raft only replays
+	// the log after it
+	if err := f.db.Checkpoint(f.applied); err != nil {
+		return fmt.Errorf("failed to checkpoint: %w", err)
+	}
+
+	f.outcomesMu.Lock()
+	header := snapshotHeader{Applied: f.applied, Outcomes: maps.Clone(f.outcomes)}
+	f.outcomesMu.Unlock()
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(header); err != nil {
+		return err
+	}
+	// Deleted records are no longer known to the db, so they are not written in the snapshot
+	return f.db.Records(func(rec store.ExportedRecord) error {
+		return encoder.Encode(VectorRecord{
+			ID:     rec.ID,
+			Vector: rec.Vector,
+			Sparse: rec.Sparse,
+			Data:   rec.Data,
+		})
+	})
 }
 
 func (f *FSM) Restore(rc io.ReadCloser) error {
 	defer rc.Close()
-	var records []VectorRecord
-	if err := json.NewDecoder(rc).Decode(&records); err != nil {
+	decoder := json.NewDecoder(rc)
+	var first json.RawMessage
+	if err := decoder.Decode(&first); err != nil {
+		return err
+	}
+
+	// Snapshots from older versions are a single array of records
+	var header snapshotHeader
+	var legacy []VectorRecord
+	if bytes.HasPrefix(bytes.TrimSpace(first), []byte("[")) {
+		if err := json.Unmarshal(first, &legacy); err != nil {
+			return err
+		}
+	} else if err := json.Unmarshal(first, &header); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// A snapshot replaces all previous state
+	if err := f.db.Reset(); err != nil {
+		return err
+	}
+	// The entries between the snapshot's index and the state it holds are
+	// replayed next, they must not be applied twice
+	f.applied = header.Applied
+	f.skipUntil = header.Applied
+
+	// The entries before the snapshot are gone from the log
+	f.outcomesMu.Lock()
+	f.outcomes = header.Outcomes
+	if f.outcomes == nil {
+		f.outcomes = make(map[uint64]entryOutcome)
+	}
+	err := f.saveOutcomes()
+	f.outcomesMu.Unlock()
+	if err != nil {
 		return err
 	}
 
-	for _, record := range records {
-		// arenaOffset, err := f.db.Arena.Add(record.Vector)
-		arenaOffset, err := f.db.InsertInMemory(record.ID, record.Vector)
-		if err != nil {
+	for _, record := range legacy {
+		if err := f.restore(record); err != nil {
 			return err
 		}
-		f.db.HNSW.Add(record.Vector, record.ID, arenaOffset)
 	}
-	return nil
+	for {
+		var record VectorRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := f.restore(record); err != nil {
+			return err
+		}
+	}
+}
+
+// restore inserts a snapshot record. Its metadata is written out again and
+// indexed for text search, records of older snapshots carry none.
+func (f *FSM) restore(record VectorRecord) error {
+	if len(record.Data) == 0 {
+		_, err := f.db.InsertInMemory(record.ID, record.Vector, record.Sparse)
+		return err
+	}
+	return f.db.InsertWithSparse(record.ID, record.Vector, record.Sparse, record.Data)
 }
@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// applyLog feeds the entries to the FSM as raft would, starting at index 1
+func applyLog(t *testing.T, f *FSM, entries []Command) {
+	t.Helper()
+	for i, cmd := range entries {
+		data, err := EncodeCommand(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp := f.Apply(&raft.Log{Index: uint64(i + 1), Type: raft.LogCommand, Data: data}); resp != nil {
+			if err, ok := resp.(error); ok {
+				t.Fatalf("entry %d: %v", i+1, err)
+			}
+		}
+	}
+}
+
+func randomVector(rng *rand.Rand) []float32 {
+	v := make([]float32, testDim)
+	for i := range v {
+		v[i] = rng.Float32()
+	}
+	return v
+}
+
+// TestRetrainIsReplicated applies the same log with a retrain to two replicas,
+// they must end up with the same IVF lists
+func TestRetrainIsReplicated(t *testing.T) {
+	collection := store.DefaultCollectionConfig()
+	collection.Index = store.IndexIVF
+	collection.IVF.NList = 4
+	collection.IVF.NProbe = 1
+	collection.IVF.TrainSize = 50
+
+	rng := rand.New(rand.NewSource(1))
+	var entries []Command
+	for i := 0; i < 200; i++ {
+		entries = append(entries, Command{Op: OpInsert, Id: fmt.Sprintf("id-%d", i), Vector: randomVector(rng)})
+		if i%4 == 0 {
+			entries = append(entries, Command{Op: OpDelete, Id: fmt.Sprintf("id-%d", i/2)})
+		}
+	}
+	entries = append(entries, Command{Op: OpRetrain})
+
+	var results [][][]store.VectroRecord
+	for replica := 0; replica < 2; replica++ {
+		db, err := store.NewVectraDBWithConfig(testDim, t.TempDir(), collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		f := NewFSM(0, db)
+		applyLog(t, f, entries)
+
+		if stats := db.IndexStats(); stats.Deleted != 0 {
+			t.Fatalf("replica %d kept %d tombstones after the retrain", replica, stats.Deleted)
+		}
+		queries := rand.New(rand.NewSource(2))
+		var got [][]store.VectroRecord
+		for q := 0; q < 20; q++ {
+			got = append(got, db.Search(randomVector(queries), 5, store.SearchOptions{}))
+		}
+		results = append(results, got)
+	}
+	for q := range results[0] {
+		if !slices.EqualFunc(results[0][q], results[1][q], func(a, b store.VectroRecord) bool { return a.ID == b.ID }) {
+			t.Fatalf("query %d: replicas returned %v and %v", q, results[0][q], results[1][q])
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/raft"
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// ShardGroup is the set of local raft nodes replicating one shard.
+// It implements store.ShardHandler by routing writes to the leader.
+type ShardGroup struct {
+	nodes []*RaftNode
+}
+
+func NewShardGroup(nodes []*RaftNode) *ShardGroup {
+	return &ShardGroup{nodes: nodes}
+}
+
+func (s *ShardGroup) Insert(id string, vector []float32, data any) error {
+	return s.InsertWithSparse(id, vector, nil, data)
+}
+
+func (s *ShardGroup) InsertWithSparse(id string, vector []float32, sparse *store.SparseVector, data any) error {
+	for _, n := range s.nodes {
+		if n.Raft.State() == raft.Leader {
+			return n.InsertWithSparse(id, vector, sparse, data)
+		}
+	}
+	return fmt.Errorf("no leader for shard")
+}
+
+func (s *ShardGroup) Search(query []float32, topK int, opts store.SearchOptions) []store.VectroRecord {
+	if n := s.reader(); n != nil {
+		return n.Search(query, topK, opts)
+	}
+	return nil
+}
+
+func (s *ShardGroup) SearchBatch(queries []store.BatchQuery) [][]store.VectroRecord {
+	if n := s.reader(); n != nil {
+		return n.SearchBatch(queries)
+	}
+	return nil
+}
+
+func (s *ShardGroup) SearchGroups(query []float32, opts store.SearchOptions, group store.GroupOptions) []store.RecordGroup {
+	if n := s.reader(); n != nil {
+		return n.SearchGroups(query, opts, group)
+	}
+	return nil
+}
+
+func (s *ShardGroup) HybridRankings(query store.HybridQuery, fetch int, opts store.SearchOptions) store.HybridRankings {
+	if n := s.reader(); n != nil {
+		return n.HybridRankings(query, fetch, opts)
+	}
+	return store.HybridRankings{}
+}
+
+func (s *ShardGroup) Get(id string) ([]float32, []byte, bool) {
+	if n := s.reader(); n != nil {
+		return n.DB.Get(id)
+	}
+	return nil, nil, false
+}
+
+func (s *ShardGroup) Export(fn func(rec store.ExportedRecord) error) error {
+	if n := s.reader(); n != nil {
+		return n.DB.Export(fn)
+	}
+	return fmt.Errorf("no node for shard")
+}
+
+func (s *ShardGroup) Delete(id string) error {
+	for _, n := range s.nodes {
+		if n.Raft.State() == raft.Leader {
+			return n.Delete(id)
+		}
+	}
+	return fmt.Errorf("no leader for shard")
+}
+
+func (s *ShardGroup) UpdatePayload(id string, data any) error {
+	for _, n := range s.nodes {
+		if n.Raft.State() == raft.Leader {
+			return n.UpdatePayload(id, data)
+		}
+	}
+	return fmt.Errorf("no leader for shard")
+}
+
+// Leader returns the local node currently leading the shard, or nil.
+func (s *ShardGroup) Leader() *RaftNode {
+	for _, n := range s.nodes {
+		if n.Raft.State() == raft.Leader {
+			return n
+		}
+	}
+	return nil
+}
+
+// Nodes returns every local node of the shard.
+func (s *ShardGroup) Nodes() []*RaftNode {
+	return s.nodes
+}
+
+// reader picks the node that serves reads: the leader if known,
+// otherwise the first available node (may be eventual).
+func (s *ShardGroup) reader() *RaftNode {
+	if n := s.Leader(); n != nil {
+		return n
+	}
+	if len(s.nodes) > 0 {
+		return s.nodes[0]
+	}
+	return nil
+}
+
+// Retrain rebuilds learned index structures on every replica of the shard
+// through the raft log.
+func (s *ShardGroup) Retrain() error {
+	for _, n := range s.nodes {
+		if n.Raft.State() == raft.Leader {
+			return n.Retrain()
+		}
+	}
+	return fmt.Errorf("no leader for shard")
+}
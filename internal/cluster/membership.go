@@ -0,0 +1,104 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+var (
+	ErrServerNotFound = errors.New("server is not a member of this shard")
+	ErrAlreadyVoter   = errors.New("server is already a voter")
+)
+
+// Member describes one server in a shard's raft configuration
+type Member struct {
+	ID       string
+	Address  string
+	Suffrage string
+	Leader   bool
+}
+
+// Members returns the latest raft configuration as seen by this node.
+func (rn *RaftNode) Members() ([]Member, error) {
+	future := rn.Raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+
+	_, leaderID := rn.Raft.LeaderWithID()
+	servers := future.Configuration().Servers
+	members := make([]Member, 0, len(servers))
+	for _, srv := range servers {
+		members = append(members, Member{
+			ID:       string(srv.ID),
+			Address:  string(srv.Address),
+			Suffrage: srv.Suffrage.String(),
+			Leader:   srv.ID == leaderID,
+		})
+	}
+	return members, nil
+}
+
+// AddVoter adds a server to the shard as a full voting member.
+func (rn *RaftNode) AddVoter(id, addr string) error {
+	return rn.Raft.AddVoter(raft.ServerID(id), raft.ServerAddress(addr), 0, RaftTimeout).Error()
+}
+
+// AddLearner adds a server to the shard as a non-voter. It receives the log
+// but does not count towards quorum until it is promoted.
+func (rn *RaftNode) AddLearner(id, addr string) error {
+	return rn.Raft.AddNonvoter(raft.ServerID(id), raft.ServerAddress(addr), 0, RaftTimeout).Error()
+}
+
+// Promote turns an existing learner into a voter, keeping its address.
+func (rn *RaftNode) Promote(id string) error {
+	srv, err := rn.server(id)
+	if err != nil {
+		return err
+	}
+	if srv.Suffrage == raft.Voter {
+		return ErrAlreadyVoter
+	}
+	return rn.Raft.AddVoter(srv.ID, srv.Address, 0, RaftTimeout).Error()
+}
+
+// RemoveServer drops a server from the shard configuration.
+func (rn *RaftNode) RemoveServer(id string) error {
+	if _, err := rn.server(id); err != nil {
+		return err
+	}
+	return rn.Raft.RemoveServer(raft.ServerID(id), 0, RaftTimeout).Error()
+}
+
+// TransferLeadership hands leadership to the given server. An empty id lets
+// raft pick the most up to date follower.
+func (rn *RaftNode) TransferLeadership(id string) error {
+	if id == "" {
+		return rn.Raft.LeadershipTransfer().Error()
+	}
+
+	srv, err := rn.server(id)
+	if err != nil {
+		return err
+	}
+	if srv.Suffrage != raft.Voter {
+		return fmt.Errorf("cannot transfer leadership to %s: server is a %s", id, srv.Suffrage)
+	}
+	return rn.Raft.LeadershipTransferToServer(srv.ID, srv.Address).Error()
+}
+
+// server looks up a single member of the latest configuration
+func (rn *RaftNode) server(id string) (raft.Server, error) {
+	future := rn.Raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return raft.Server{}, err
+	}
+	for _, srv := range future.Configuration().Servers {
+		if srv.ID == raft.ServerID(id) {
+			return srv, nil
+		}
+	}
+	return raft.Server{}, ErrServerNotFound
+}
@@ -19,14 +19,23 @@ const (
 )
 
 type RaftNode struct {
+	ID   string
+	Addr string
 	Raft *raft.Raft
 	FSM  *FSM
 	// we keep a reference to the database for read only operations
 	DB *store.VectraDB
+
+	batcher *applyBatcher
+	logs    raft.LogStore
+
+	// last log index found in stable storage at boot, the node has
+	// caught up on replay once it has applied up to here
+	bootIndex uint64
 }
 
 func NewRaftNode(shardID int, nodeID string, baseDir string, raftPort int, db *store.VectraDB) (*RaftNode, error) {
-	fsm := NewFSM(db)
+	fsm := NewFSM(shardID, db)
 
 	raftDir := filepath.Join(baseDir, fmt.Sprintf("shard_%d", shardID), nodeID, "raft")
 	os.MkdirAll(raftDir, 0755)
@@ -35,9 +44,11 @@ func NewRaftNode(shardID int, nodeID string, baseDir string, raftPort int, db *s
 	config.LocalID = raft.ServerID(nodeID)
 
 	// LOG COMPACTION SETTINGS:
-	// Take a snapshot every 500 operations!
+	// Every snapshot checkpoints the whole collection and writes out all of
+	// its records, with writes blocked meanwhile. Take one every 8192
+	// entries, raft's default, so that cost is spread over many writes.
 	config.SnapshotInterval = 30 * time.Second
-	config.SnapshotThreshold = 500
+	config.SnapshotThreshold = 8192
 	// Keep the last 2 snapshots on disk, delete older ones
 	config.TrailingLogs = 100
 
@@ -65,6 +76,19 @@ func NewRaftNode(shardID int, nodeID string, baseDir string, raftPort int, db *s
 	if err != nil {
 		return nil, err
 	}
+	if err := fsm.attach(logStore, stableStore); err != nil {
+		return nil, fmt.Errorf("failed to load rejected commands: %w", err)
+	}
+
+	// A checkpoint at least as recent as the latest snapshot already holds its
+	// state, mapping it replaces the slow restore of the snapshot records
+	if checkpoint := db.CheckpointIndex(); checkpoint > 0 {
+		snapshots, err := snapshotStore.List()
+		if err != nil {
+			return nil, err
+		}
+		config.NoSnapshotRestoreOnStart = len(snapshots) == 0 || checkpoint >= snapshots[0].Index
+	}
 
 	raftNode, err := raft.NewRaft(config, fsm, logStore, stableStore, snapshotStore, transport)
 	if err != nil {
@@ -72,9 +96,15 @@ func NewRaftNode(shardID int, nodeID string, baseDir string, raftPort int, db *s
 	}
 
 	rn := &RaftNode{
+		ID:   nodeID,
+		Addr: addr,
 		Raft: raftNode,
 		FSM:  fsm,
 		DB:   db,
+
+		bootIndex: raftNode.LastIndex(),
+		batcher:   newApplyBatcher(raftNode),
+		logs:      logStore,
 	}
 
 	// periodically reflect raft state in telemetry gauge
@@ -94,6 +124,11 @@ func NewRaftNode(shardID int, nodeID string, baseDir string, raftPort int, db *s
 }
 
 func (rn *RaftNode) Insert(id string, vector []float32, data interface{}) error {
+	return rn.InsertWithSparse(id, vector, nil, data)
+}
+
+// InsertWithSparse replicates an insert carrying a sparse vector, sparse may be nil
+func (rn *RaftNode) InsertWithSparse(id string, vector []float32, sparse *store.SparseVector, data interface{}) error {
 	if rn.Raft.State() != raft.Leader {
 		return fmt.Errorf("not the leader of this shard")
 	}
@@ -103,30 +138,58 @@ func (rn *RaftNode) Insert(id string, vector []float32, data interface{}) error
 		return fmt.Errorf("failed to marshal data: %v", err)
 	}
 	cmd := Command{
-		Op:     "insert",
+		Op:     OpInsert,
 		Id:     id,
 		Vector: vector,
+		Sparse: sparse,
 		Data:   json.RawMessage(jsonData),
 	}
 
-	b, err := json.Marshal(cmd)
-	if err != nil {
-		return err
+	return rn.batcher.Apply(cmd)
+}
+
+// UpdatePayload replicates a metadata update of an existing record
+func (rn *RaftNode) UpdatePayload(id string, data interface{}) error {
+	if rn.Raft.State() != raft.Leader {
+		return fmt.Errorf("not the leader of this shard")
 	}
 
-	future := rn.Raft.Apply(b, RaftTimeout)
-	if err := future.Error(); err != nil {
-		return err
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %v", err)
 	}
+	cmd := Command{
+		Op:   OpUpdatePayload,
+		Id:   id,
+		Data: json.RawMessage(jsonData),
+	}
+
+	return rn.batcher.Apply(cmd)
+}
 
-	if fsmErr, ok := future.Response().(error); ok {
-		return fsmErr
+// Retrain replicates a retrain of the shard's index, so every replica
+// rebuilds it at the same point of the log
+func (rn *RaftNode) Retrain() error {
+	if rn.Raft.State() != raft.Leader {
+		return fmt.Errorf("not the leader of this shard")
 	}
-	return nil
+	return rn.batcher.Apply(Command{Op: OpRetrain})
+}
+
+func (rn *RaftNode) Search(query []float32, topK int, opts store.SearchOptions) []store.VectroRecord {
+	return rn.DB.Search(query, topK, opts)
+}
+
+func (rn *RaftNode) SearchBatch(queries []store.BatchQuery) [][]store.VectroRecord {
+	return rn.DB.SearchBatch(queries)
 }
 
-func (rn *RaftNode) Search(query []float32, topK int) []store.VectroRecord {
-	return rn.DB.Search(query, topK)
+func (rn *RaftNode) SearchGroups(query []float32, opts store.SearchOptions, group store.GroupOptions) []store.RecordGroup {
+	return rn.DB.SearchGroups(query, opts, group)
+}
+
+func (rn *RaftNode) HybridRankings(query store.HybridQuery, fetch int, opts store.SearchOptions) store.HybridRankings {
+	return rn.DB.HybridRankings(query, fetch, opts)
 }
 
 func (rn *RaftNode) Delete(id string) error {
@@ -135,22 +198,9 @@ func (rn *RaftNode) Delete(id string) error {
 	}
 
 	cmd := Command{
-		Op: "delete",
+		Op: OpDelete,
 		Id: id,
 	}
 
-	b, err := json.Marshal(cmd)
-	if err != nil {
-		return err
-	}
-
-	future := rn.Raft.Apply(b, RaftTimeout)
-	if err := future.Error(); err != nil {
-		return err
-	}
-
-	if fsmErr, ok := future.Response().(error); ok {
-		return fsmErr
-	}
-	return nil
+	return rn.batcher.Apply(cmd)
 }
@@ -0,0 +1,85 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+const testDim = 4
+
+// newTestNode runs a single voter raft node on in-memory stores and waits
+// until it leads. The db lives in a temporary directory.
+func newTestNode(t *testing.T) *RaftNode {
+	t.Helper()
+	db, err := store.NewVectraDB(testDim, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startTestNode(t, db, raft.NewInmemStore(), raft.NewInmemStore(), raft.NewInmemSnapshotStore())
+}
+
+func startTestNode(t *testing.T, db *store.VectraDB, logs, stable *raft.InmemStore, snaps raft.SnapshotStore) *RaftNode {
+	t.Helper()
+	fsm := NewFSM(0, db)
+	if err := fsm.attach(logs, stable); err != nil {
+		t.Fatal(err)
+	}
+
+	config := raft.DefaultConfig()
+	config.LocalID = "node"
+	config.HeartbeatTimeout = 50 * time.Millisecond
+	config.ElectionTimeout = 50 * time.Millisecond
+	config.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.CommitTimeout = time.Millisecond
+	config.LogOutput = testWriter{t}
+	// Snapshots are only taken when a test asks for one
+	config.SnapshotThreshold = 1 << 30
+	config.SnapshotInterval = time.Hour
+	config.NoSnapshotRestoreOnStart = db.CheckpointIndex() > 0
+
+	addr, transport := raft.NewInmemTransport("")
+	if last, _ := logs.LastIndex(); last == 0 {
+		configuration := raft.Configuration{Servers: []raft.Server{{ID: config.LocalID, Address: addr}}}
+		if err := raft.BootstrapCluster(config, logs, stable, snaps, transport, configuration); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := raft.NewRaft(config, fsm, logs, stable, snaps, transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Shutdown().Error() })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for r.State() != raft.Leader {
+		if time.Now().After(deadline) {
+			t.Fatal("node did not become leader")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Wait for the entries of a previous run to be applied
+	if err := r.Barrier(5 * time.Second).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &RaftNode{
+		ID:      "node",
+		Addr:    string(addr),
+		Raft:    r,
+		FSM:     fsm,
+		DB:      db,
+		batcher: newApplyBatcher(r),
+		logs:    logs,
+	}
+}
+
+// testWriter sends raft's log lines to the test log
+type testWriter struct{ t *testing.T }
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Log(string(p))
+	return len(p), nil
+}
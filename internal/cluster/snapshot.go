@@ -4,23 +4,35 @@ import (
 	"encoding/json"
 
 	"github.com/hashicorp/raft"
+	"github.com/rupamthxt/vectradb/internal/store"
 )
 
+// snapshotHeader is the first value of a snapshot, the records follow it one
+// JSON value each
+type snapshotHeader struct {
+	// Applied is the last log index the records hold the effect of
+	Applied uint64 `json:"applied"`
+	// Outcomes of the entries still in the log, see FSM.outcomes
+	Outcomes map[uint64]entryOutcome `json:"outcomes,omitempty"`
+}
+
 // Represents the data we are saving
 type VectorRecord struct {
-	ID     string    `json:"id"`
-	Vector []float32 `json:"vector"`
+	ID     string              `json:"id"`
+	Vector []float32           `json:"vector"`
+	Sparse *store.SparseVector `json:"sparse,omitempty"`
+	Data   json.RawMessage     `json:"data,omitempty"`
 }
 
-// Implements raft.FSMSnapshot interface
+// Implements raft.FSMSnapshot interface. The records are read from the db
+// when raft persists the snapshot, nothing is copied when it is taken.
 type fsmSnapshot struct {
-	records []VectorRecord
+	fsm *FSM
 }
 
 func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
 	err := func() error {
-		encoder := json.NewEncoder(sink)
-		if err := encoder.Encode(s.records); err != nil {
+		if err := s.fsm.persist(sink); err != nil {
 			return err
 		}
 		return sink.Close()
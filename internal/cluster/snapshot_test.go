@@ -0,0 +1,250 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// searchIDs runs a fixed set of queries and returns the ids each one found
+func searchIDs(db *store.VectraDB) [][]string {
+	rng := rand.New(rand.NewSource(7))
+	var ids [][]string
+	for q := 0; q < 20; q++ {
+		var found []string
+		for _, rec := range db.Search(randomVector(rng), 5, store.SearchOptions{}) {
+			found = append(found, rec.ID)
+		}
+		ids = append(ids, found)
+	}
+	return ids
+}
+
+// title is the text indexed for record i, one word of its own
+func title(i int, updated bool) string {
+	if updated {
+		return fmt.Sprintf("updated%d", i)
+	}
+	return fmt.Sprintf("word%d", i)
+}
+
+// TestSnapshotSurvivesRestart takes a snapshot, writes past it and restarts
+// the node, once from the checkpoint on disk and once with an empty db that
+// raft restores from the snapshot. Both must end up where the first run left,
+// metadata and text search included.
+func TestSnapshotSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	collection := store.DefaultCollectionConfig()
+	collection.TextFields = []string{"title"}
+	db, err := store.NewVectraDBWithConfig(testDim, dir, collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, stable, snaps := raft.NewInmemStore(), raft.NewInmemStore(), raft.NewInmemSnapshotStore()
+	rn := startTestNode(t, db, logs, stable, snaps)
+
+	rng := rand.New(rand.NewSource(1))
+	write := func(from, to int) {
+		for i := from; i < to; i++ {
+			if err := rn.Insert(fmt.Sprintf("id-%d", i), randomVector(rng), map[string]any{"title": title(i, false)}); err != nil {
+				t.Fatal(err)
+			}
+			if i%10 == 3 {
+				if err := rn.UpdatePayload(fmt.Sprintf("id-%d", i), map[string]any{"title": title(i, true)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if i%5 == 0 {
+				if err := rn.Delete(fmt.Sprintf("id-%d", i/2)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	write(0, 100)
+	if err := rn.Raft.Snapshot().Error(); err != nil {
+		t.Fatal(err)
+	}
+	if db.CheckpointIndex() == 0 {
+		t.Fatal("the snapshot did not checkpoint the db")
+	}
+	// Entries after the snapshot are replayed from the log
+	write(100, 150)
+
+	want := searchIDs(db)
+	var live []string
+	for i := 0; i < 150; i++ {
+		if id := fmt.Sprintf("id-%d", i); db.Contains(id) {
+			live = append(live, id)
+		}
+	}
+	if len(live) == 150 {
+		t.Fatal("no record was deleted")
+	}
+	if err := rn.Raft.Shutdown().Error(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		dir  string
+	}{
+		{"checkpoint", dir},
+		{"snapshot restore", t.TempDir()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := store.NewVectraDBWithConfig(testDim, tc.dir, collection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			rn := startTestNode(t, db, logs, stable, snaps)
+			defer rn.Raft.Shutdown().Error()
+
+			keyword := func(text string) []string {
+				var ids []string
+				for _, rec := range db.HybridRankings(store.HybridQuery{Text: text}, 5, store.SearchOptions{}).Keyword {
+					ids = append(ids, rec.ID)
+				}
+				return ids
+			}
+			for i := 0; i < 150; i++ {
+				id := fmt.Sprintf("id-%d", i)
+				if !slices.Contains(live, id) {
+					if db.Contains(id) {
+						t.Errorf("deleted %s came back", id)
+					}
+					if got := keyword(title(i, false)); len(got) != 0 {
+						t.Errorf("text search for deleted %s found %v", id, got)
+					}
+					continue
+				}
+				if !db.Contains(id) {
+					t.Errorf("%s is missing", id)
+					continue
+				}
+				updated := i%10 == 3
+				_, meta, _ := db.Get(id)
+				if want := fmt.Sprintf(`{"title":%q}`, title(i, updated)); string(meta) != want {
+					t.Errorf("%s metadata %s, want %s", id, meta, want)
+				}
+				if got := keyword(title(i, updated)); !slices.Equal(got, []string{id}) {
+					t.Errorf("text search for %s found %v", id, got)
+				}
+				if updated {
+					if got := keyword(title(i, false)); len(got) != 0 {
+						t.Errorf("text search for the old title of %s found %v", id, got)
+					}
+				}
+			}
+			if got := searchIDs(db); !slices.EqualFunc(got, want, slices.Equal) {
+				t.Errorf("search results changed:\ngot  %v\nwant %v", got, want)
+			}
+		})
+	}
+}
+
+// TestRestoreSkipsEntriesInSnapshot persists a snapshot holding more entries
+// than the index raft took it at, the entries in between are replayed after
+// the restore and must not be applied twice
+func TestRestoreSkipsEntriesInSnapshot(t *testing.T) {
+	entries := []Command{
+		{Op: OpInsert, Id: "a", Vector: []float32{1, 0, 0, 0}},
+		{Op: OpInsert, Id: "b", Vector: []float32{0, 1, 0, 0}},
+		{Op: OpInsert, Id: "b", Vector: []float32{0, 0, 1, 0}},
+		{Op: OpDelete, Id: "a"},
+		{Op: OpInsert, Id: "c", Vector: []float32{0, 0, 0, 1}},
+	}
+	db, err := store.NewVectraDB(testDim, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	f := NewFSM(0, db)
+	applyLog(t, f, entries[:4])
+
+	var buf bytes.Buffer
+	if err := f.persist(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := store.NewVectraDB(testDim, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	g := NewFSM(0, restored)
+	if err := g.Restore(io.NopCloser(&buf)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Raft took the snapshot at index 2 and replays from 3 on
+	live, _ := g.changes.subscribe()
+	defer g.changes.unsubscribe(live)
+	for i := 2; i < len(entries); i++ {
+		data, err := EncodeCommand(entries[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err, ok := g.Apply(&raft.Log{Index: uint64(i + 1), Type: raft.LogCommand, Data: data}).(error); ok {
+			t.Fatalf("entry %d: %v", i+1, err)
+		}
+	}
+
+	if restored.Contains("a") || !restored.Contains("b") || !restored.Contains("c") {
+		t.Fatal("the restored db does not hold b and c only")
+	}
+	vec, _, _ := restored.Get("b")
+	if !slices.Equal(vec, []float32{0, 0, 1, 0}) {
+		t.Fatalf("b = %v", vec)
+	}
+	// The skipped upsert keeps the outcome recorded when it was first applied
+	var events []ChangeEvent
+	for len(live) > 0 {
+		events = append(events, <-live)
+	}
+	if got, want := eventOps(events), []string{"upsert b", "delete a", "insert c"}; !slices.Equal(got, want) {
+		t.Fatalf("replayed events %v, want %v", got, want)
+	}
+}
+
+// TestRestoreLegacySnapshot restores a snapshot written as a single array of
+// records by older versions
+func TestRestoreLegacySnapshot(t *testing.T) {
+	records := []VectorRecord{
+		{ID: "a", Vector: []float32{1, 0, 0, 0}},
+		{ID: "b", Vector: []float32{0, 1, 0, 0}, Sparse: &store.SparseVector{Indices: []uint32{3}, Values: []float32{1}}},
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := store.NewVectraDB(testDim, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	f := NewFSM(0, db)
+	if err := f.Restore(io.NopCloser(bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records {
+		if !db.Contains(rec.ID) {
+			t.Errorf("%s was not restored", rec.ID)
+		}
+	}
+	if f.skipUntil != 0 {
+		t.Errorf("skipUntil = %d", f.skipUntil)
+	}
+}
@@ -0,0 +1,127 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// NodeStatus is a typed view over raft.Raft.Stats() for one local node
+type NodeStatus struct {
+	ID                string
+	Address           string
+	State             string
+	Term              uint64
+	LastLogIndex      uint64
+	CommitIndex       uint64
+	AppliedIndex      uint64
+	FSMPending        uint64
+	LastContact       string
+	LastSnapshotIndex uint64
+	LastSnapshotTerm  uint64
+	NumPeers          uint64
+	CaughtUp          bool
+}
+
+// ShardStatus reports every local node of a shard and who leads it
+type ShardStatus struct {
+	Leader string
+	Nodes  []NodeStatus
+}
+
+// Status returns the current raft statistics of the node.
+func (rn *RaftNode) Status() NodeStatus {
+	stats := rn.Raft.Stats()
+	return NodeStatus{
+		ID:                rn.ID,
+		Address:           rn.Addr,
+		State:             stats["state"],
+		Term:              statUint(stats, "term"),
+		LastLogIndex:      statUint(stats, "last_log_index"),
+		CommitIndex:       statUint(stats, "commit_index"),
+		AppliedIndex:      statUint(stats, "applied_index"),
+		FSMPending:        statUint(stats, "fsm_pending"),
+		LastContact:       stats["last_contact"],
+		LastSnapshotIndex: statUint(stats, "last_snapshot_index"),
+		LastSnapshotTerm:  statUint(stats, "last_snapshot_term"),
+		NumPeers:          statUint(stats, "num_peers"),
+		CaughtUp:          rn.CaughtUp(),
+	}
+}
+
+// CaughtUp reports whether the node has applied everything that was in its
+// log when it started, i.e. replay after a restart is finished.
+func (rn *RaftNode) CaughtUp() bool {
+	return rn.Raft.AppliedIndex() >= rn.bootIndex
+}
+
+// Status collects the raft statistics of every local node of the shard.
+func (s *ShardGroup) Status() ShardStatus {
+	status := ShardStatus{Nodes: make([]NodeStatus, 0, len(s.nodes))}
+	for _, n := range s.nodes {
+		if _, id := n.Raft.LeaderWithID(); id != "" {
+			status.Leader = string(id)
+		}
+		status.Nodes = append(status.Nodes, n.Status())
+	}
+	return status
+}
+
+// IndexStats reports the index of every local node of the shard, keyed by node id.
+func (s *ShardGroup) IndexStats() map[string]store.IndexStats {
+	stats := make(map[string]store.IndexStats, len(s.nodes))
+	for _, n := range s.nodes {
+		stats[n.ID] = n.DB.IndexStats()
+	}
+	return stats
+}
+
+// Ready returns nil once the shard has an elected leader and the node serving
+// its reads has caught up on replay.
+func (s *ShardGroup) Ready() error {
+	reader := s.reader()
+	if reader == nil {
+		return errors.New("shard has no nodes")
+	}
+	if _, id := reader.Raft.LeaderWithID(); id == "" {
+		return errors.New("shard has no leader")
+	}
+	if !reader.CaughtUp() {
+		return fmt.Errorf("node %s is replaying the log (applied %d of %d)", reader.ID, reader.Raft.AppliedIndex(), reader.bootIndex)
+	}
+	return nil
+}
+
+// WaitReady blocks until every shard reports ready or the timeout expires.
+// Shards that do not expose readiness are treated as ready.
+func WaitReady(shards []store.ShardHandler, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var notReady []string
+		for i, sh := range shards {
+			group, ok := sh.(*ShardGroup)
+			if !ok {
+				continue
+			}
+			if err := group.Ready(); err != nil {
+				notReady = append(notReady, fmt.Sprintf("shard %d: %v", i, err))
+			}
+		}
+		if len(notReady) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.New(strings.Join(notReady, "; "))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func statUint(stats map[string]string, key string) uint64 {
+	v, _ := strconv.ParseUint(stats[key], 10, 64)
+	return v
+}
@@ -0,0 +1,216 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/hashicorp/raft"
+	"github.com/rupamthxt/vectradb/internal/cluster"
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// Shards lists the raft configuration of every shard together with the state of the local nodes.
+func (h *Handler) Shards(c *fiber.Ctx) error {
+	resp := ShardMembersResponse{Shards: make([]ShardMembers, 0, h.cluster.NumShards())}
+
+	for i := 0; i < h.cluster.NumShards(); i++ {
+		entry := ShardMembers{ShardID: i, Members: []MemberInfo{}, LocalNodes: []LocalNodeInfo{}}
+
+		shard, ok := h.cluster.GetShardByID(i).(leaderAwareShard)
+		if !ok {
+			entry.Error = "shard does not support membership lookup"
+			resp.Shards = append(resp.Shards, entry)
+			continue
+		}
+
+		nodes := shard.Nodes()
+		for _, n := range nodes {
+			entry.LocalNodes = append(entry.LocalNodes, LocalNodeInfo{
+				ServerID: n.ID,
+				Address:  n.Addr,
+				State:    n.Raft.State().String(),
+			})
+		}
+
+		// Any local node can report the configuration, the leader has the freshest one.
+		source := shard.Leader()
+		if source == nil && len(nodes) > 0 {
+			source = nodes[0]
+		}
+		if source != nil {
+			members, err := source.Members()
+			if err != nil {
+				entry.Error = err.Error()
+			}
+			for _, m := range members {
+				if m.Leader {
+					entry.Leader = m.ID
+				}
+				entry.Members = append(entry.Members, MemberInfo{
+					ServerID: m.ID,
+					Address:  m.Address,
+					Suffrage: m.Suffrage,
+					Leader:   m.Leader,
+				})
+			}
+		}
+		resp.Shards = append(resp.Shards, entry)
+	}
+
+	return c.JSON(resp)
+}
+
+// AddLearner adds a non-voting member to a shard so it can catch up before promotion.
+func (h *Handler) AddLearner(c *fiber.Ctx) error {
+	var req JoinRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse json"})
+	}
+	if req.ServerID == "" || req.Address == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "raft_id and raft_addr are required"})
+	}
+
+	leader, err := h.shardLeader(req.ShardID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	if err := leader.AddLearner(req.ServerID, req.Address); err != nil {
+		return errorResponse(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "learner added successfully"})
+}
+
+// Promote turns a learner of a shard into a voter.
+func (h *Handler) Promote(c *fiber.Ctx) error {
+	return h.memberOp(c, "node promoted successfully", (*cluster.RaftNode).Promote)
+}
+
+// RemoveMember removes a server from a shard's configuration.
+func (h *Handler) RemoveMember(c *fiber.Ctx) error {
+	return h.memberOp(c, "node removed successfully", (*cluster.RaftNode).RemoveServer)
+}
+
+// TransferLeadership moves a shard's leadership to the requested server, or to any
+// up to date follower when raft_id is empty.
+func (h *Handler) TransferLeadership(c *fiber.Ctx) error {
+	var req MemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse json"})
+	}
+
+	leader, err := h.shardLeader(req.ShardID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	if err := leader.TransferLeadership(req.ServerID); err != nil {
+		return errorResponse(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "leadership transferred successfully"})
+}
+
+// Retrain rebuilds learned index structures (IVF centroids) on every replica.
+func (h *Handler) Retrain(c *fiber.Ctx) error {
+	for i := 0; i < h.cluster.NumShards(); i++ {
+		shard, ok := h.cluster.GetShardByID(i).(interface{ Retrain() error })
+		if !ok {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "shard does not support retraining"})
+		}
+		if err := shard.Retrain(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("shard %d: %v", i, err)})
+		}
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "index retrained successfully"})
+}
+
+// IndexStats reports the index type and size of every local node.
+func (h *Handler) IndexStats(c *fiber.Ctx) error {
+	resp := IndexStatsResponse{Shards: make([]ShardIndexStats, 0, h.cluster.NumShards())}
+
+	for i := 0; i < h.cluster.NumShards(); i++ {
+		entry := ShardIndexStats{ShardID: i, Nodes: []NodeIndexStats{}}
+		if shard, ok := h.cluster.GetShardByID(i).(interface {
+			IndexStats() map[string]store.IndexStats
+		}); ok {
+			stats := shard.IndexStats()
+			ids := make([]string, 0, len(stats))
+			for id := range stats {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			for _, id := range ids {
+				st := stats[id]
+				entry.Nodes = append(entry.Nodes, NodeIndexStats{
+					ServerID: id,
+					Type:     string(st.Type),
+					Vectors:  st.Vectors,
+					Deleted:  st.Deleted,
+					MaxLayer: st.MaxLayer,
+					Lists:    st.Lists,
+					Trained:  st.Trained,
+				})
+			}
+		}
+		resp.Shards = append(resp.Shards, entry)
+	}
+
+	return c.JSON(resp)
+}
+
+// memberOp runs a membership change that targets a single existing server on the shard leader.
+func (h *Handler) memberOp(c *fiber.Ctx, message string, op func(*cluster.RaftNode, string) error) error {
+	var req MemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse json"})
+	}
+	if req.ServerID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "raft_id is required"})
+	}
+
+	leader, err := h.shardLeader(req.ShardID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	if err := op(leader, req.ServerID); err != nil {
+		return errorResponse(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": message})
+}
+
+// shardLeader resolves the local leader node of a shard.
+func (h *Handler) shardLeader(shardID int) (*cluster.RaftNode, error) {
+	shard := h.cluster.GetShardByID(shardID)
+	if shard == nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "shard not found")
+	}
+	leaderShard, ok := shard.(leaderAwareShard)
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "shard does not support leader lookup")
+	}
+	leader := leaderShard.Leader()
+	if leader == nil {
+		return nil, fiber.NewError(fiber.StatusConflict, "no leader available for shard")
+	}
+	return leader, nil
+}
+
+// errorResponse maps cluster and raft errors onto HTTP status codes.
+func errorResponse(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+
+	var fe *fiber.Error
+	switch {
+	case errors.As(err, &fe):
+		status = fe.Code
+		err = errors.New(fe.Message)
+	case errors.Is(err, cluster.ErrServerNotFound),
+		errors.Is(err, store.ErrRecordNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, cluster.ErrAlreadyVoter),
+		errors.Is(err, raft.ErrNotLeader),
+		errors.Is(err, raft.ErrLeadershipTransferInProgress):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+}
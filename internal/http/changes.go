@@ -0,0 +1,150 @@
+package http
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rupamthxt/vectradb/internal/cluster"
+)
+
+const changesKeepAlive = 15 * time.Second
+
+// Changes streams every mutation applied to the cluster as Server-Sent Events.
+// Each event id is a cursor of the last raft index seen per shard ("0:120,1:55"),
+// passing it back as ?after= or Last-Event-ID resumes the stream without gaps.
+// A shard stopped in the middle of a batched entry reads "1:56.3": three of the
+// events of entry 56 have been seen.
+func (h *Handler) Changes(c *fiber.Ctx) error {
+	cursorStr := c.Query("after")
+	if cursorStr == "" {
+		cursorStr = c.Get("Last-Event-ID")
+	}
+	cursor, err := parseCursor(cursorStr, h.cluster.NumShards())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	includeVectors := c.QueryBool("include_vectors", false)
+
+	changes, err := cluster.FollowChanges(h.cluster, cursor)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, cluster.ErrLogCompacted) {
+			status = fiber.StatusGone
+		}
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	for i, start := range changes.Start {
+		if cursor[i] == (cluster.ChangeCursor{}) {
+			cursor[i] = start
+		}
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		quit := make(chan struct{})
+		defer func() {
+			close(quit)
+			changes.Close()
+		}()
+
+		merged, failed := changes.Events(quit)
+
+		ticker := time.NewTicker(changesKeepAlive)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case ev := <-merged:
+				cursor[ev.Shard] = ev.Cursor()
+				item := ChangeEventResponse{
+					Shard: ev.Shard,
+					Index: ev.Index,
+					Op:    ev.Op,
+					ID:    ev.ID,
+					Data:  ev.Data,
+				}
+				if includeVectors {
+					item.Vector = ev.Vector
+					item.Sparse = ev.Sparse
+				}
+				payload, _ := json.Marshal(item)
+				fmt.Fprintf(w, "id: %s\nevent: change\ndata: %s\n\n", formatCursor(cursor), payload)
+			case err := <-failed:
+				payload, _ := json.Marshal(fiber.Map{"error": err.Error()})
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", payload)
+				w.Flush()
+				return
+			case <-ticker.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+			}
+
+			// A failed flush means the client went away
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// parseCursor reads "shard:index" or "shard:index.seen" pairs separated by commas
+func parseCursor(s string, numShards int) (map[int]cluster.ChangeCursor, error) {
+	cursor := make(map[int]cluster.ChangeCursor, numShards)
+	if s == "" {
+		return cursor, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		shardStr, indexStr, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid cursor %q, expected shard:index", part)
+		}
+		shard, err := strconv.Atoi(shardStr)
+		if err != nil || shard < 0 || shard >= numShards {
+			return nil, fmt.Errorf("invalid shard in cursor %q", part)
+		}
+		indexStr, seenStr, partial := strings.Cut(indexStr, ".")
+		index, err := strconv.ParseUint(indexStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid index in cursor %q", part)
+		}
+		if !partial {
+			cursor[shard] = cluster.ChangeCursor{Index: index}
+			continue
+		}
+		seen, err := strconv.Atoi(seenStr)
+		if err != nil || seen <= 0 || index == 0 {
+			return nil, fmt.Errorf("invalid position in cursor %q", part)
+		}
+		cursor[shard] = cluster.ChangeCursor{Index: index - 1, Seen: seen}
+	}
+	return cursor, nil
+}
+
+func formatCursor(cursor map[int]cluster.ChangeCursor) string {
+	shards := make([]int, 0, len(cursor))
+	for shard := range cursor {
+		shards = append(shards, shard)
+	}
+	sort.Ints(shards)
+
+	parts := make([]string, 0, len(shards))
+	for _, shard := range shards {
+		c := cursor[shard]
+		if c.Seen > 0 {
+			parts = append(parts, fmt.Sprintf("%d:%d.%d", shard, c.Index+1, c.Seen))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d:%d", shard, c.Index))
+		}
+	}
+	return strings.Join(parts, ",")
+}
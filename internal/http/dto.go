@@ -1,20 +1,113 @@
 package http
 
+import (
+	"encoding/json"
+
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
 type InsertRequest struct {
-	ID     string         `json:"id"`
-	Vector []float32      `json:"vector"`
-	Data   map[string]any `json:"metadata"`
+	ID     string              `json:"id"`
+	Vector []float32           `json:"vector"`
+	Sparse *store.SparseVector `json:"sparse,omitempty"`
+	Data   map[string]any      `json:"metadata"`
 }
 
 type SearchRequest struct {
-	Vector []float32 `json:"vector"`
-	TopK   int       `json:"k"`
+	Vector     []float32 `json:"vector"`
+	TopK       int       `json:"k"`
+	NProbe     int       `json:"nprobe"`     // IVF collections only
+	Oversample int       `json:"oversample"` // re-ranked collections only
+	Ef         int       `json:"ef"`         // HNSW and Vamana candidate list size
+
+	// Range search: every match within radius (squared euclidean distance),
+	// capped at max_results. k is ignored when radius is set.
+	Radius     float32 `json:"radius"`
+	MaxResults int     `json:"max_results"`
+
+	// Drop weak matches inside each shard, max_distance d is min_score 1 - d.
+	// When both are set the stricter one applies.
+	MinScore    *float32 `json:"min_score"`
+	MaxDistance *float32 `json:"max_distance"`
+
+	// Grouped search: the best group_size hits (default 1) of the best limit
+	// groups (default k), grouped by a top level metadata field
+	GroupBy   string `json:"group_by"`
+	GroupSize int    `json:"group_size"`
+	Limit     int    `json:"limit"`
+
+	// Diversify the results with maximal marginal relevance
+	MMR *MMRRequest `json:"mmr"`
+
+	// Keyword query over the collection's text fields. With a vector the two
+	// searches are fused, without one it is a plain BM25 search.
+	Text string `json:"text"`
+	// Sparse query scored by dot product against the records' sparse vectors,
+	// fused with the text and vector searches like text is
+	Sparse *store.SparseVector `json:"sparse"`
+	Hybrid *HybridRequest      `json:"hybrid"`
+
+	// Metadata filters are not supported yet. The field only exists so that a
+	// request carrying one is rejected instead of silently returning unfiltered
+	// results, filter on the client or with group_by meanwhile.
+	Filter json.RawMessage `json:"filter,omitempty"`
+}
+
+// HybridRequest tunes the fusion of keyword, sparse and vector results: "rrf"
+// (default) or "weighted" with alpha (default 0.5) as the weight of the vector
+// score, the keyword and sparse scores share the rest.
+// candidates (default 4*k) results of each search are fused.
+type HybridRequest struct {
+	Fusion     string   `json:"fusion"`
+	Alpha      *float32 `json:"alpha"`
+	Candidates int      `json:"candidates"`
+}
+
+// MMRRequest enables MMR: lambda (default 0.5) trades query similarity (1)
+// against diversity (0), candidates (default 4*k) is the pool picked from
+type MMRRequest struct {
+	Lambda     *float32 `json:"lambda"`
+	Candidates int      `json:"candidates"`
+}
+
+// BatchSearchRequest carries many searches, each with its own k and options.
+// A per-query metadata filter is not supported, see SearchRequest.Filter.
+type BatchSearchRequest struct {
+	Queries []SearchRequest `json:"queries"`
+}
+
+// BatchSearchResponse holds one result list per query, in query order
+type BatchSearchResponse struct {
+	Results []SearchResponse `json:"results"`
+}
+
+// RecommendRequest searches by stored ids. Strategy is "average" (default) or
+// "best_score", the example ids are left out of the results.
+type RecommendRequest struct {
+	Positive    []string `json:"positive"`
+	Negative    []string `json:"negative"`
+	Strategy    string   `json:"strategy"`
+	TopK        int      `json:"k"`
+	NProbe      int      `json:"nprobe"`
+	Oversample  int      `json:"oversample"`
+	Ef          int      `json:"ef"`
+	MinScore    *float32 `json:"min_score"`
+	MaxDistance *float32 `json:"max_distance"`
 }
 
 type SearchResponse struct {
 	Results []SearchResult `json:"results"`
 }
 
+type GroupedSearchResponse struct {
+	Groups []SearchGroup `json:"groups"`
+}
+
+type SearchGroup struct {
+	Key  any            `json:"key"`
+	Hits []SearchResult `json:"hits"`
+}
+
 type SearchResult struct {
 	ID    string  `json:"id"`
 	Score float32 `json:"score"`
@@ -25,8 +118,110 @@ type DeleteRequest struct {
 	ID string `json:"id"`
 }
 
+// UpdatePayloadRequest replaces the metadata of a stored record
+type UpdatePayloadRequest struct {
+	ID   string         `json:"id"`
+	Data map[string]any `json:"metadata"`
+}
+
 type JoinRequest struct {
 	ShardID  int    `json:"shard_id"`
 	ServerID string `json:"raft_id"`
 	Address  string `json:"raft_addr"`
 }
+
+type MemberRequest struct {
+	ShardID  int    `json:"shard_id"`
+	ServerID string `json:"raft_id"`
+}
+
+type ShardMembersResponse struct {
+	Shards []ShardMembers `json:"shards"`
+}
+
+type ShardMembers struct {
+	ShardID    int             `json:"shard_id"`
+	Leader     string          `json:"leader"`
+	Members    []MemberInfo    `json:"members"`
+	LocalNodes []LocalNodeInfo `json:"local_nodes"`
+	Error      string          `json:"error,omitempty"`
+}
+
+type MemberInfo struct {
+	ServerID string `json:"raft_id"`
+	Address  string `json:"raft_addr"`
+	Suffrage string `json:"suffrage"`
+	Leader   bool   `json:"leader"`
+}
+
+type LocalNodeInfo struct {
+	ServerID string `json:"raft_id"`
+	Address  string `json:"raft_addr"`
+	State    string `json:"state"`
+}
+
+type ClusterStatusResponse struct {
+	Shards []ShardStatus `json:"shards"`
+}
+
+type ShardStatus struct {
+	ShardID int          `json:"shard_id"`
+	Leader  string       `json:"leader"`
+	Ready   bool         `json:"ready"`
+	Reason  string       `json:"reason,omitempty"`
+	Nodes   []NodeStatus `json:"nodes"`
+}
+
+type NodeStatus struct {
+	ServerID          string `json:"raft_id"`
+	Address           string `json:"raft_addr"`
+	State             string `json:"state"`
+	Term              uint64 `json:"term"`
+	LastLogIndex      uint64 `json:"last_log_index"`
+	CommitIndex       uint64 `json:"commit_index"`
+	AppliedIndex      uint64 `json:"applied_index"`
+	FSMPending        uint64 `json:"fsm_pending"`
+	LastContact       string `json:"last_contact"`
+	LastSnapshotIndex uint64 `json:"last_snapshot_index"`
+	LastSnapshotTerm  uint64 `json:"last_snapshot_term"`
+	NumPeers          uint64 `json:"num_peers"`
+	CaughtUp          bool   `json:"caught_up"`
+}
+
+type ChangeEventResponse struct {
+	Shard  int                 `json:"shard"`
+	Index  uint64              `json:"index"`
+	Op     string              `json:"op"`
+	ID     string              `json:"id"`
+	Vector []float32           `json:"vector,omitempty"`
+	Sparse *store.SparseVector `json:"sparse,omitempty"`
+	Data   json.RawMessage     `json:"metadata,omitempty"`
+}
+
+// ExportRecord is one line of GET /api/v1/export, shaped like an insert
+// request so that a line can be posted back to /api/v1/insert as is
+type ExportRecord struct {
+	ID     string              `json:"id"`
+	Vector []float32           `json:"vector"`
+	Sparse *store.SparseVector `json:"sparse,omitempty"`
+	Data   json.RawMessage     `json:"metadata,omitempty"`
+}
+
+type IndexStatsResponse struct {
+	Shards []ShardIndexStats `json:"shards"`
+}
+
+type ShardIndexStats struct {
+	ShardID int              `json:"shard_id"`
+	Nodes   []NodeIndexStats `json:"nodes"`
+}
+
+type NodeIndexStats struct {
+	ServerID string `json:"raft_id"`
+	Type     string `json:"type"`
+	Vectors  int    `json:"vectors"`
+	Deleted  int    `json:"deleted"`
+	MaxLayer int    `json:"max_layer,omitempty"`
+	Lists    int    `json:"lists,omitempty"`
+	Trained  bool   `json:"trained,omitempty"`
+}
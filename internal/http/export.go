@@ -0,0 +1,35 @@
+package http
+
+import (
+	"bufio"
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// Export streams every record of the cluster as newline delimited JSON, one
+// insert request per line. Vectors are written as the float32 values they
+// decode to, which convert back to fp16 and bf16 exactly, so re-inserting an
+// export into a collection with the same encoding restores it bit for bit.
+// A failure half way through ends the stream with an {"error": ...} line.
+func (h *Handler) Export(c *fiber.Ctx) error {
+	c.Set("Content-Type", "application/x-ndjson")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		enc := json.NewEncoder(w)
+		err := h.cluster.Export(func(rec store.ExportedRecord) error {
+			return enc.Encode(ExportRecord{
+				ID:     rec.ID,
+				Vector: rec.Vector,
+				Sparse: rec.Sparse,
+				Data:   rec.Data,
+			})
+		})
+		if err != nil {
+			enc.Encode(fiber.Map{"error": err.Error()})
+		}
+		w.Flush()
+	})
+	return nil
+}
@@ -2,23 +2,30 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/hashicorp/raft"
 	"github.com/rupamthxt/vectradb/internal/cluster"
 	"github.com/rupamthxt/vectradb/internal/metrics"
 	"github.com/rupamthxt/vectradb/internal/store"
 )
 
+const (
+	// defaultMaxResults caps a range search that does not set max_results
+	defaultMaxResults = 1000
+	// maxBatchQueries bounds the size of a batch search request
+	maxBatchQueries = 1024
+)
+
 type Handler struct {
 	cluster *store.Cluster
 }
 
 type leaderAwareShard interface {
 	Leader() *cluster.RaftNode
+	Nodes() []*cluster.RaftNode
 }
 
 func NewHandler(cluster *store.Cluster) *Handler {
@@ -37,9 +44,14 @@ func (h *Handler) Insert(c *fiber.Ctx) error {
 	if req.ID == "" || len(req.Vector) == 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id and vector are required"})
 	}
+	if req.Sparse != nil {
+		if _, err := req.Sparse.Normalize(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
 
 	timeNow := time.Now()
-	err := h.cluster.Insert(req.ID, req.Vector, req.Data)
+	err := h.cluster.InsertWithSparse(req.ID, req.Vector, req.Sparse, req.Data)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -58,17 +70,257 @@ func (h *Handler) Search(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse json"})
 	}
 
-	if len(req.Vector) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "vector is required"})
+	query, err := batchQuery(&req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if req.Text != "" || req.Sparse != nil {
+		if req.GroupBy != "" || req.MMR != nil || req.Radius > 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "text and sparse cannot be combined with group_by, mmr or radius"})
+		}
+		return h.searchHybrid(c, &req, query)
+	}
+	if req.GroupBy != "" {
+		if req.MMR != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "group_by cannot be combined with mmr"})
+		}
+		return h.searchGroups(c, &req, query)
+	}
+	if req.MMR != nil {
+		return h.searchMMR(c, req.MMR, query)
+	}
+
+	timeNow := time.Now()
+	results := h.cluster.Search(query.Vector, query.TopK, query.Opts)
+	metrics.SearchDuration.Observe(time.Since(timeNow).Seconds())
+
+	return c.JSON(searchResponse(results))
+}
+
+// searchHybrid answers a search with text or a sparse vector set
+func (h *Handler) searchHybrid(c *fiber.Ctx, req *SearchRequest, query store.BatchQuery) error {
+	hybrid := store.HybridOptions{Alpha: 0.5}
+	if req.Hybrid != nil {
+		fusion, err := store.ParseFusionType(req.Hybrid.Fusion)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		hybrid.Fusion = fusion
+		if req.Hybrid.Alpha != nil {
+			hybrid.Alpha = *req.Hybrid.Alpha
+		}
+		hybrid.Candidates = req.Hybrid.Candidates
+	}
+	if hybrid.Alpha < 0 || hybrid.Alpha > 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "hybrid alpha must be between 0 and 1"})
+	}
+	if hybrid.Candidates < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "hybrid candidates cannot be negative"})
+	}
+	if hybrid.Candidates == 0 {
+		hybrid.Candidates = 4 * query.TopK
+	}
+
+	timeNow := time.Now()
+	hq := store.HybridQuery{Vector: query.Vector, Text: req.Text, Sparse: req.Sparse}
+	results := h.cluster.SearchHybrid(hq, query.TopK, query.Opts, hybrid)
+	metrics.SearchDuration.Observe(time.Since(timeNow).Seconds())
+
+	return c.JSON(searchResponse(results))
+}
+
+// searchMMR answers a search with mmr set
+func (h *Handler) searchMMR(c *fiber.Ctx, req *MMRRequest, query store.BatchQuery) error {
+	mmr := store.MMROptions{Lambda: 0.5, Candidates: req.Candidates}
+	if req.Lambda != nil {
+		mmr.Lambda = *req.Lambda
+	}
+	if mmr.Lambda < 0 || mmr.Lambda > 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mmr lambda must be between 0 and 1"})
+	}
+	if mmr.Candidates < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mmr candidates cannot be negative"})
+	}
+	if mmr.Candidates == 0 {
+		mmr.Candidates = 4 * query.TopK
+	}
+
+	timeNow := time.Now()
+	results := h.cluster.SearchMMR(query.Vector, query.TopK, query.Opts, mmr)
+	metrics.SearchDuration.Observe(time.Since(timeNow).Seconds())
+
+	return c.JSON(searchResponse(results))
+}
+
+// searchGroups answers a search with group_by set
+func (h *Handler) searchGroups(c *fiber.Ctx, req *SearchRequest, query store.BatchQuery) error {
+	if req.Radius > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "group_by cannot be combined with radius"})
+	}
+	if req.GroupSize < 0 || req.Limit < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "group_size and limit cannot be negative"})
+	}
+	group := store.GroupOptions{Field: req.GroupBy, Size: req.GroupSize, Limit: req.Limit}
+	if group.Size == 0 {
+		group.Size = 1
+	}
+	if group.Limit == 0 {
+		group.Limit = query.TopK
+	}
+
+	timeNow := time.Now()
+	groups := h.cluster.SearchGroups(query.Vector, query.Opts, group)
+	metrics.SearchDuration.Observe(time.Since(timeNow).Seconds())
+
+	response := GroupedSearchResponse{Groups: make([]SearchGroup, 0, len(groups))}
+	for _, g := range groups {
+		var key any
+		_ = json.Unmarshal([]byte(g.Key), &key)
+		response.Groups = append(response.Groups, SearchGroup{
+			Key:  key,
+			Hits: searchResponse(g.Hits).Results,
+		})
+	}
+	return c.JSON(response)
+}
+
+// SearchBatch runs many queries with one fan-out per shard, results come back
+// in the order of the queries
+func (h *Handler) SearchBatch(c *fiber.Ctx) error {
+	var req BatchSearchRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse json"})
+	}
+	metrics.SearchRequests.Add(float64(len(req.Queries)))
+
+	if len(req.Queries) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "queries are required"})
+	}
+	if len(req.Queries) > maxBatchQueries {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("at most %d queries per batch", maxBatchQueries)})
+	}
+
+	queries := make([]store.BatchQuery, len(req.Queries))
+	for i := range req.Queries {
+		query, err := batchQuery(&req.Queries[i])
+		q := &req.Queries[i]
+		if err == nil && (q.GroupBy != "" || q.MMR != nil || q.Text != "" || q.Sparse != nil) {
+			err = errors.New("group_by, mmr, text and sparse are not supported in batches")
+		}
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("query %d: %v", i, err)})
+		}
+		queries[i] = query
+	}
+
+	timeNow := time.Now()
+	results := h.cluster.SearchBatch(queries)
+	metrics.SearchDuration.Observe(time.Since(timeNow).Seconds())
+
+	response := BatchSearchResponse{Results: make([]SearchResponse, len(results))}
+	for i, r := range results {
+		response.Results[i] = searchResponse(r)
+	}
+	return c.JSON(response)
+}
+
+// batchQuery validates a search request and fills in its defaults
+func batchQuery(req *SearchRequest) (store.BatchQuery, error) {
+	if len(req.Vector) == 0 && req.Text == "" && req.Sparse == nil {
+		return store.BatchQuery{}, errors.New("vector, text or sparse is required")
+	}
+	if len(req.Filter) > 0 && string(req.Filter) != "null" {
+		return store.BatchQuery{}, errors.New("metadata filters are not supported")
+	}
+	if req.Sparse != nil {
+		if _, err := req.Sparse.Normalize(); err != nil {
+			return store.BatchQuery{}, err
+		}
+	}
+
+	if req.TopK <= 0 {
+		req.TopK = 5 // Default TopK
+	}
+
+	if req.Radius < 0 || req.MaxResults < 0 || (req.MaxDistance != nil && *req.MaxDistance < 0) {
+		return store.BatchQuery{}, errors.New("radius, max_results and max_distance cannot be negative")
+	}
+	if req.Radius > 0 {
+		// Range search returns everything within the radius up to max_results
+		req.TopK = req.MaxResults
+		if req.TopK == 0 {
+			req.TopK = defaultMaxResults
+		}
+	}
+
+	return store.BatchQuery{
+		Vector: req.Vector,
+		TopK:   req.TopK,
+		Opts: store.SearchOptions{
+			NProbe:     req.NProbe,
+			Oversample: req.Oversample,
+			Ef:         req.Ef,
+			Radius:     req.Radius,
+			MinScore:   minScore(req.MinScore, req.MaxDistance),
+		},
+	}, nil
+}
+
+// Recommend searches by stored example ids instead of a raw vector
+func (h *Handler) Recommend(c *fiber.Ctx) error {
+	var req RecommendRequest
+
+	metrics.SearchRequests.Inc()
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse json"})
+	}
+
+	if len(req.Positive) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "at least one positive id is required"})
+	}
+	strategy, err := store.ParseRecommendStrategy(req.Strategy)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if req.MaxDistance != nil && *req.MaxDistance < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "max_distance cannot be negative"})
 	}
 
 	if req.TopK <= 0 {
 		req.TopK = 5 // Default TopK
 	}
 
+	opts := store.SearchOptions{
+		NProbe:     req.NProbe,
+		Oversample: req.Oversample,
+		Ef:         req.Ef,
+		MinScore:   minScore(req.MinScore, req.MaxDistance),
+	}
+
 	timeNow := time.Now()
-	results := h.cluster.Search(req.Vector, req.TopK)
+	results, err := h.cluster.Recommend(req.Positive, req.Negative, req.TopK, strategy, opts)
+	if err != nil {
+		return errorResponse(c, err)
+	}
 	metrics.SearchDuration.Observe(time.Since(timeNow).Seconds())
+
+	return c.JSON(searchResponse(results))
+}
+
+// minScore merges the min_score and max_distance thresholds, the stricter wins
+func minScore(score, maxDistance *float32) *float32 {
+	if maxDistance == nil {
+		return score
+	}
+	fromDistance := 1 - *maxDistance
+	if score == nil || fromDistance > *score {
+		return &fromDistance
+	}
+	return score
+}
+
+func searchResponse(results []store.VectroRecord) SearchResponse {
 	responseItems := make([]SearchResult, 0, len(results))
 	for _, res := range results {
 		var metaMap map[string]any
@@ -82,8 +334,7 @@ func (h *Handler) Search(c *fiber.Ctx) error {
 			Data:  metaMap,
 		})
 	}
-
-	return c.JSON(SearchResponse{Results: responseItems})
+	return SearchResponse{Results: responseItems}
 }
 
 // Delete handles delete requests and flags a vector with tombstone for deletion
@@ -104,37 +355,38 @@ func (h *Handler) Delete(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "data deleted successfully"})
 }
 
+// UpdatePayload replaces the metadata of a record without touching its vectors
+func (h *Handler) UpdatePayload(c *fiber.Ctx) error {
+	var req UpdatePayloadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse json"})
+	}
+
+	if req.ID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id is missing"})
+	}
+	if err := h.cluster.UpdatePayload(req.ID, req.Data); err != nil {
+		return errorResponse(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "metadata updated successfully"})
+}
+
 // Join handles join requests and returns a shard for the specific ID to be used by a new node for joining a cluster.
 func (h *Handler) Join(c *fiber.Ctx) error {
-	log.Printf("Reached1\n")
 	var req JoinRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse json"})
 	}
-	shard := h.cluster.GetShardByID(req.ShardID)
-	if shard == nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "shard not found"})
-	}
-	fmt.Printf("reached2")
-	leaderShard, ok := shard.(leaderAwareShard)
-	if !ok {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "shard does not support leader lookup"})
-	}
-	leader := leaderShard.Leader()
-	if leader == nil {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "no leader available for shard"})
-	}
-	fmt.Printf("reached3")
-	configFuture := leader.Raft.AddVoter(
-		raft.ServerID(req.ServerID),
-		raft.ServerAddress(req.Address),
-		0,
-		0,
-	)
-	fmt.Printf("reached4")
-	if err := configFuture.Error(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if req.ServerID == "" || req.Address == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "raft_id and raft_addr are required"})
+	}
+
+	leader, err := h.shardLeader(req.ShardID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	if err := leader.AddVoter(req.ServerID, req.Address); err != nil {
+		return errorResponse(c, err)
 	}
-	fmt.Printf("reached5")
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "node joined successfully"})
 }
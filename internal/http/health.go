@@ -0,0 +1,81 @@
+package http
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rupamthxt/vectradb/internal/cluster"
+)
+
+type statusAwareShard interface {
+	Status() cluster.ShardStatus
+	Ready() error
+}
+
+// Healthz reports that the process is alive and serving HTTP.
+func (h *Handler) Healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// Readyz reports 200 only when every shard has a leader and has caught up on replay.
+func (h *Handler) Readyz(c *fiber.Ctx) error {
+	reasons := fiber.Map{}
+	for i := 0; i < h.cluster.NumShards(); i++ {
+		shard, ok := h.cluster.GetShardByID(i).(statusAwareShard)
+		if !ok {
+			continue
+		}
+		if err := shard.Ready(); err != nil {
+			reasons[strconv.Itoa(i)] = err.Error()
+		}
+	}
+
+	if len(reasons) > 0 {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "not ready", "shards": reasons})
+	}
+	return c.JSON(fiber.Map{"status": "ready"})
+}
+
+// ClusterStatus returns the raft state of every local node, grouped by shard.
+func (h *Handler) ClusterStatus(c *fiber.Ctx) error {
+	resp := ClusterStatusResponse{Shards: make([]ShardStatus, 0, h.cluster.NumShards())}
+
+	for i := 0; i < h.cluster.NumShards(); i++ {
+		entry := ShardStatus{ShardID: i, Nodes: []NodeStatus{}}
+
+		shard, ok := h.cluster.GetShardByID(i).(statusAwareShard)
+		if !ok {
+			entry.Reason = "shard does not report status"
+			resp.Shards = append(resp.Shards, entry)
+			continue
+		}
+
+		status := shard.Status()
+		entry.Leader = status.Leader
+		if err := shard.Ready(); err != nil {
+			entry.Reason = err.Error()
+		} else {
+			entry.Ready = true
+		}
+		for _, n := range status.Nodes {
+			entry.Nodes = append(entry.Nodes, NodeStatus{
+				ServerID:          n.ID,
+				Address:           n.Address,
+				State:             n.State,
+				Term:              n.Term,
+				LastLogIndex:      n.LastLogIndex,
+				CommitIndex:       n.CommitIndex,
+				AppliedIndex:      n.AppliedIndex,
+				FSMPending:        n.FSMPending,
+				LastContact:       n.LastContact,
+				LastSnapshotIndex: n.LastSnapshotIndex,
+				LastSnapshotTerm:  n.LastSnapshotTerm,
+				NumPeers:          n.NumPeers,
+				CaughtUp:          n.CaughtUp,
+			})
+		}
+		resp.Shards = append(resp.Shards, entry)
+	}
+
+	return c.JSON(resp)
+}
@@ -30,6 +30,12 @@ var (
 		Buckets: []float64{.01, .05, .1, .5, 1, 2.5, 5}, // Slower buckets for Raft writes
 	})
 
+	RaftBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "vectradb_raft_batch_size",
+		Help:    "Number of writes group-committed into a single raft log entry",
+		Buckets: []float64{1, 2, 4, 8, 16, 32, 64, 128, 256},
+	})
+
 	// 3. State (Gauges)
 	TotalVectors = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "vectradb_vectors_total",
@@ -0,0 +1,92 @@
+package rpc
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rupamthxt/vectradb/internal/cluster"
+	"github.com/rupamthxt/vectradb/internal/rpc/changespb"
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// ChangesServer serves the change stream over gRPC, it carries the same
+// events and resumes from the same cursors as GET /api/v1/changes
+type ChangesServer struct {
+	changespb.UnimplementedChangesServer
+	cluster *store.Cluster
+}
+
+func NewChangesServer(c *store.Cluster) *ChangesServer {
+	return &ChangesServer{cluster: c}
+}
+
+// Stream sends every change applied after the request's cursors until the
+// client goes away or a shard stream fails
+func (s *ChangesServer) Stream(req *changespb.StreamRequest, stream changespb.Changes_StreamServer) error {
+	from := make(map[int]cluster.ChangeCursor, len(req.After))
+	for _, c := range req.After {
+		if int(c.Shard) >= s.cluster.NumShards() {
+			return status.Errorf(codes.InvalidArgument, "unknown shard %d in cursor", c.Shard)
+		}
+		from[int(c.Shard)] = cluster.ChangeCursor{Index: c.Index, Seen: int(c.Seen)}
+	}
+
+	changes, err := cluster.FollowChanges(s.cluster, from)
+	if err != nil {
+		switch {
+		case errors.Is(err, cluster.ErrLogCompacted):
+			return status.Error(codes.OutOfRange, err.Error())
+		case errors.Is(err, cluster.ErrChangesUnsupported):
+			return status.Error(codes.Unimplemented, err.Error())
+		default:
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+	defer changes.Close()
+
+	quit := make(chan struct{})
+	defer close(quit)
+	events, failed := changes.Events(quit)
+
+	for {
+		select {
+		case ev := <-events:
+			if err := stream.Send(changeEvent(ev, req.IncludeVectors)); err != nil {
+				return err
+			}
+		case err := <-failed:
+			if errors.Is(err, cluster.ErrSubscriberLagged) {
+				return status.Error(codes.ResourceExhausted, err.Error())
+			}
+			return status.Error(codes.Internal, err.Error())
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func changeEvent(ev cluster.ChangeEvent, includeVectors bool) *changespb.ChangeEvent {
+	cursor := ev.Cursor()
+	out := &changespb.ChangeEvent{
+		Shard:    uint32(ev.Shard),
+		Index:    ev.Index,
+		Pos:      uint32(ev.Pos),
+		Op:       ev.Op,
+		Id:       ev.ID,
+		Metadata: ev.Data,
+		Cursor: &changespb.ShardCursor{
+			Shard: uint32(ev.Shard),
+			Index: cursor.Index,
+			Seen:  uint32(cursor.Seen),
+		},
+	}
+	if includeVectors {
+		out.Vector = ev.Vector
+		if ev.Sparse != nil {
+			out.Sparse = &changespb.SparseVector{Indices: ev.Sparse.Indices, Values: ev.Sparse.Values}
+		}
+	}
+	return out
+}
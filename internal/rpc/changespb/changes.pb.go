@@ -0,0 +1,388 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        (unknown)
+// source: internal/rpc/changespb/changes.proto
+
+package changespb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ShardCursor is a position in the change stream of one shard: every event of
+// the raft entries up to index, and the first seen events of the entry after
+// it when a batched entry was cut off midway
+type ShardCursor struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Shard         uint32                 `protobuf:"varint,1,opt,name=shard,proto3" json:"shard,omitempty"`
+	Index         uint64                 `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
+	Seen          uint32                 `protobuf:"varint,3,opt,name=seen,proto3" json:"seen,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShardCursor) Reset() {
+	*x = ShardCursor{}
+	mi := &file_internal_rpc_changespb_changes_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShardCursor) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShardCursor) ProtoMessage() {}
+
+func (x *ShardCursor) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_rpc_changespb_changes_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShardCursor.ProtoReflect.Descriptor instead.
+func (*ShardCursor) Descriptor() ([]byte, []int) {
+	return file_internal_rpc_changespb_changes_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ShardCursor) GetShard() uint32 {
+	if x != nil {
+		return x.Shard
+	}
+	return 0
+}
+
+func (x *ShardCursor) GetIndex() uint64 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *ShardCursor) GetSeen() uint32 {
+	if x != nil {
+		return x.Seen
+	}
+	return 0
+}
+
+type StreamRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Where each shard resumes, shards left out only follow new changes
+	After []*ShardCursor `protobuf:"bytes,1,rep,name=after,proto3" json:"after,omitempty"`
+	// Send the dense and sparse vectors of inserts
+	IncludeVectors bool `protobuf:"varint,2,opt,name=include_vectors,json=includeVectors,proto3" json:"include_vectors,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *StreamRequest) Reset() {
+	*x = StreamRequest{}
+	mi := &file_internal_rpc_changespb_changes_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamRequest) ProtoMessage() {}
+
+func (x *StreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_rpc_changespb_changes_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamRequest.ProtoReflect.Descriptor instead.
+func (*StreamRequest) Descriptor() ([]byte, []int) {
+	return file_internal_rpc_changespb_changes_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StreamRequest) GetAfter() []*ShardCursor {
+	if x != nil {
+		return x.After
+	}
+	return nil
+}
+
+func (x *StreamRequest) GetIncludeVectors() bool {
+	if x != nil {
+		return x.IncludeVectors
+	}
+	return false
+}
+
+type SparseVector struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Indices       []uint32               `protobuf:"varint,1,rep,packed,name=indices,proto3" json:"indices,omitempty"`
+	Values        []float32              `protobuf:"fixed32,2,rep,packed,name=values,proto3" json:"values,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SparseVector) Reset() {
+	*x = SparseVector{}
+	mi := &file_internal_rpc_changespb_changes_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SparseVector) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SparseVector) ProtoMessage() {}
+
+func (x *SparseVector) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_rpc_changespb_changes_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SparseVector.ProtoReflect.Descriptor instead.
+func (*SparseVector) Descriptor() ([]byte, []int) {
+	return file_internal_rpc_changespb_changes_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SparseVector) GetIndices() []uint32 {
+	if x != nil {
+		return x.Indices
+	}
+	return nil
+}
+
+func (x *SparseVector) GetValues() []float32 {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+type ChangeEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Shard uint32                 `protobuf:"varint,1,opt,name=shard,proto3" json:"shard,omitempty"`
+	// Raft index of the entry, shared by the commands of a batch
+	Index uint64 `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
+	// Position of the event within its entry
+	Pos uint32 `protobuf:"varint,3,opt,name=pos,proto3" json:"pos,omitempty"`
+	// insert, upsert, delete or payload_update
+	Op     string        `protobuf:"bytes,4,opt,name=op,proto3" json:"op,omitempty"`
+	Id     string        `protobuf:"bytes,5,opt,name=id,proto3" json:"id,omitempty"`
+	Vector []float32     `protobuf:"fixed32,6,rep,packed,name=vector,proto3" json:"vector,omitempty"`
+	Sparse *SparseVector `protobuf:"bytes,7,opt,name=sparse,proto3" json:"sparse,omitempty"`
+	// JSON metadata of inserts, upserts and payload updates
+	Metadata []byte `protobuf:"bytes,8,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	// Position right after this event, pass it back in StreamRequest.after
+	Cursor        *ShardCursor `protobuf:"bytes,9,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChangeEvent) Reset() {
+	*x = ChangeEvent{}
+	mi := &file_internal_rpc_changespb_changes_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangeEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangeEvent) ProtoMessage() {}
+
+func (x *ChangeEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_rpc_changespb_changes_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangeEvent.ProtoReflect.Descriptor instead.
+func (*ChangeEvent) Descriptor() ([]byte, []int) {
+	return file_internal_rpc_changespb_changes_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ChangeEvent) GetShard() uint32 {
+	if x != nil {
+		return x.Shard
+	}
+	return 0
+}
+
+func (x *ChangeEvent) GetIndex() uint64 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *ChangeEvent) GetPos() uint32 {
+	if x != nil {
+		return x.Pos
+	}
+	return 0
+}
+
+func (x *ChangeEvent) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *ChangeEvent) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ChangeEvent) GetVector() []float32 {
+	if x != nil {
+		return x.Vector
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetSparse() *SparseVector {
+	if x != nil {
+		return x.Sparse
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetMetadata() []byte {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetCursor() *ShardCursor {
+	if x != nil {
+		return x.Cursor
+	}
+	return nil
+}
+
+var File_internal_rpc_changespb_changes_proto protoreflect.FileDescriptor
+
+const file_internal_rpc_changespb_changes_proto_rawDesc = "" +
+	"\n" +
+	"$internal/rpc/changespb/changes.proto\x12\vvectradb.v1\"M\n" +
+	"\vShardCursor\x12\x14\n" +
+	"\x05shard\x18\x01 \x01(\rR\x05shard\x12\x14\n" +
+	"\x05index\x18\x02 \x01(\x04R\x05index\x12\x12\n" +
+	"\x04seen\x18\x03 \x01(\rR\x04seen\"h\n" +
+	"\rStreamRequest\x12.\n" +
+	"\x05after\x18\x01 \x03(\v2\x18.vectradb.v1.ShardCursorR\x05after\x12'\n" +
+	"\x0finclude_vectors\x18\x02 \x01(\bR\x0eincludeVectors\"@\n" +
+	"\fSparseVector\x12\x18\n" +
+	"\aindices\x18\x01 \x03(\rR\aindices\x12\x16\n" +
+	"\x06values\x18\x02 \x03(\x02R\x06values\"\x84\x02\n" +
+	"\vChangeEvent\x12\x14\n" +
+	"\x05shard\x18\x01 \x01(\rR\x05shard\x12\x14\n" +
+	"\x05index\x18\x02 \x01(\x04R\x05index\x12\x10\n" +
+	"\x03pos\x18\x03 \x01(\rR\x03pos\x12\x0e\n" +
+	"\x02op\x18\x04 \x01(\tR\x02op\x12\x0e\n" +
+	"\x02id\x18\x05 \x01(\tR\x02id\x12\x16\n" +
+	"\x06vector\x18\x06 \x03(\x02R\x06vector\x121\n" +
+	"\x06sparse\x18\a \x01(\v2\x19.vectradb.v1.SparseVectorR\x06sparse\x12\x1a\n" +
+	"\bmetadata\x18\b \x01(\fR\bmetadata\x120\n" +
+	"\x06cursor\x18\t \x01(\v2\x18.vectradb.v1.ShardCursorR\x06cursor2K\n" +
+	"\aChanges\x12@\n" +
+	"\x06Stream\x12\x1a.vectradb.v1.StreamRequest\x1a\x18.vectradb.v1.ChangeEvent0\x01B6Z4github.com/rupamthxt/vectradb/internal/rpc/changespbb\x06proto3"
+
+var (
+	file_internal_rpc_changespb_changes_proto_rawDescOnce sync.Once
+	file_internal_rpc_changespb_changes_proto_rawDescData []byte
+)
+
+func file_internal_rpc_changespb_changes_proto_rawDescGZIP() []byte {
+	file_internal_rpc_changespb_changes_proto_rawDescOnce.Do(func() {
+		file_internal_rpc_changespb_changes_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_internal_rpc_changespb_changes_proto_rawDesc), len(file_internal_rpc_changespb_changes_proto_rawDesc)))
+	})
+	return file_internal_rpc_changespb_changes_proto_rawDescData
+}
+
+var file_internal_rpc_changespb_changes_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_internal_rpc_changespb_changes_proto_goTypes = []any{
+	(*ShardCursor)(nil),   // 0: vectradb.v1.ShardCursor
+	(*StreamRequest)(nil), // 1: vectradb.v1.StreamRequest
+	(*SparseVector)(nil),  // 2: vectradb.v1.SparseVector
+	(*ChangeEvent)(nil),   // 3: vectradb.v1.ChangeEvent
+}
+var file_internal_rpc_changespb_changes_proto_depIdxs = []int32{
+	0, // 0: vectradb.v1.StreamRequest.after:type_name -> vectradb.v1.ShardCursor
+	2, // 1: vectradb.v1.ChangeEvent.sparse:type_name -> vectradb.v1.SparseVector
+	0, // 2: vectradb.v1.ChangeEvent.cursor:type_name -> vectradb.v1.ShardCursor
+	1, // 3: vectradb.v1.Changes.Stream:input_type -> vectradb.v1.StreamRequest
+	3, // 4: vectradb.v1.Changes.Stream:output_type -> vectradb.v1.ChangeEvent
+	4, // [4:5] is the sub-list for method output_type
+	3, // [3:4] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_internal_rpc_changespb_changes_proto_init() }
+func file_internal_rpc_changespb_changes_proto_init() {
+	if File_internal_rpc_changespb_changes_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_rpc_changespb_changes_proto_rawDesc), len(file_internal_rpc_changespb_changes_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_internal_rpc_changespb_changes_proto_goTypes,
+		DependencyIndexes: file_internal_rpc_changespb_changes_proto_depIdxs,
+		MessageInfos:      file_internal_rpc_changespb_changes_proto_msgTypes,
+	}.Build()
+	File_internal_rpc_changespb_changes_proto = out.File
+	file_internal_rpc_changespb_changes_proto_goTypes = nil
+	file_internal_rpc_changespb_changes_proto_depIdxs = nil
+}
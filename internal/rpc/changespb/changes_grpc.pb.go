@@ -0,0 +1,130 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: internal/rpc/changespb/changes.proto
+
+package changespb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Changes_Stream_FullMethodName = "/vectradb.v1.Changes/Stream"
+)
+
+// ChangesClient is the client API for Changes service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Changes streams every mutation applied to the cluster, the gRPC counterpart
+// of GET /api/v1/changes
+type ChangesClient interface {
+	Stream(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ChangeEvent], error)
+}
+
+type changesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChangesClient(cc grpc.ClientConnInterface) ChangesClient {
+	return &changesClient{cc}
+}
+
+func (c *changesClient) Stream(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ChangeEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Changes_ServiceDesc.Streams[0], Changes_Stream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamRequest, ChangeEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Changes_StreamClient = grpc.ServerStreamingClient[ChangeEvent]
+
+// ChangesServer is the server API for Changes service.
+// All implementations must embed UnimplementedChangesServer
+// for forward compatibility.
+//
+// Changes streams every mutation applied to the cluster, the gRPC counterpart
+// of GET /api/v1/changes
+type ChangesServer interface {
+	Stream(*StreamRequest, grpc.ServerStreamingServer[ChangeEvent]) error
+	mustEmbedUnimplementedChangesServer()
+}
+
+// UnimplementedChangesServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedChangesServer struct{}
+
+func (UnimplementedChangesServer) Stream(*StreamRequest, grpc.ServerStreamingServer[ChangeEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
+}
+func (UnimplementedChangesServer) mustEmbedUnimplementedChangesServer() {}
+func (UnimplementedChangesServer) testEmbeddedByValue()                 {}
+
+// UnsafeChangesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChangesServer will
+// result in compilation errors.
+type UnsafeChangesServer interface {
+	mustEmbedUnimplementedChangesServer()
+}
+
+func RegisterChangesServer(s grpc.ServiceRegistrar, srv ChangesServer) {
+	// If the following call pancis, it indicates UnimplementedChangesServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Changes_ServiceDesc, srv)
+}
+
+func _Changes_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChangesServer).Stream(m, &grpc.GenericServerStream[StreamRequest, ChangeEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Changes_StreamServer = grpc.ServerStreamingServer[ChangeEvent]
+
+// Changes_ServiceDesc is the grpc.ServiceDesc for Changes service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Changes_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "vectradb.v1.Changes",
+	HandlerType: (*ChangesServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _Changes_Stream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "internal/rpc/changespb/changes.proto",
+}
@@ -0,0 +1,21 @@
+package rpc
+
+import (
+	"net"
+
+	"google.golang.org/grpc"
+
+	"github.com/rupamthxt/vectradb/internal/rpc/changespb"
+	"github.com/rupamthxt/vectradb/internal/store"
+)
+
+// Serve listens on addr and serves the gRPC API of the cluster until it fails
+func Serve(addr string, c *store.Cluster) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer()
+	changespb.RegisterChangesServer(srv, NewChangesServer(c))
+	return srv.Serve(lis)
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// adjacencyListsPerPage is how many neighbour lists one slab page holds
+const adjacencyListsPerPage = 4096
+
+// adjacencySlab stores fixed capacity neighbour lists of uint32 node ids in flat
+// pages. Pages are allocated whole and never move, so a list can be read in place.
+// Every list takes 1+capacity words: the neighbour count followed by the ids.
+//
+// Growing is safe while other goroutines read, the page directory is replaced
+// atomically. The slab does not guard the lists themselves, HNSWIndex does that
+// with the lock of the node owning the list.
+type adjacencySlab struct {
+	capacity int
+	stride   int
+
+	mu    sync.Mutex // serializes alloc and grow
+	pages atomic.Pointer[[][]uint32]
+	lists uint32 // lists handed out by alloc
+}
+
+func newAdjacencySlab(capacity int) *adjacencySlab {
+	s := &adjacencySlab{capacity: capacity, stride: 1 + capacity}
+	s.pages.Store(&[][]uint32{})
+	return s
+}
+
+// alloc reserves n consecutive lists and returns the id of the first one
+func (s *adjacencySlab) alloc(n int) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first := s.lists
+	s.growLocked(first + uint32(n))
+	return first
+}
+
+// grow makes sure lists [0, n) exist
+func (s *adjacencySlab) grow(n uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.growLocked(n)
+}
+
+func (s *adjacencySlab) growLocked(n uint32) {
+	pages := *s.pages.Load()
+	if uint32(len(pages))*adjacencyListsPerPage < n {
+		// Copy the directory so readers holding the old one are unaffected
+		next := append([][]uint32(nil), pages...)
+		for uint32(len(next))*adjacencyListsPerPage < n {
+			next = append(next, make([]uint32, adjacencyListsPerPage*s.stride))
+		}
+		s.pages.Store(&next)
+	}
+	if s.lists < n {
+		s.lists = n
+	}
+}
+
+// block returns the count word and the neighbour slots of a list
+func (s *adjacencySlab) block(list uint32) []uint32 {
+	page := (*s.pages.Load())[list/adjacencyListsPerPage]
+	start := int(list%adjacencyListsPerPage) * s.stride
+	return page[start : start+s.stride]
+}
+
+// neighbors returns the ids currently in a list, as a view into the page
+func (s *adjacencySlab) neighbors(list uint32) []uint32 {
+	b := s.block(list)
+	return b[1 : 1+b[0]]
+}
+
+// add appends a neighbour, it reports false when the list is full
+func (s *adjacencySlab) add(list, id uint32) bool {
+	b := s.block(list)
+	if int(b[0]) >= s.capacity {
+		return false
+	}
+	b[1+b[0]] = id
+	b[0]++
+	return true
+}
+
+// set replaces the list, ids beyond capacity are dropped
+func (s *adjacencySlab) set(list uint32, ids []uint32) {
+	b := s.block(list)
+	if len(ids) > s.capacity {
+		ids = ids[:s.capacity]
+	}
+	copy(b[1:], ids)
+	b[0] = uint32(len(ids))
+}
@@ -3,7 +3,6 @@ package store
 import (
 	"fmt"
 	"sync"
-	"unsafe"
 )
 
 const PageSizeBytes = 4 * 1024 * 1024 // 4MB
@@ -14,6 +13,14 @@ type VectorArena struct {
 	dim            int
 	bytesPerVector int
 	pages          [][]byte
+	quantizer      Quantizer
+
+	// Vectors that arrived before a trainable quantizer was trained,
+	// they are encoded into their slots once training has run
+	pending [][]float32
+
+	// File mapping backing the pages of an arena opened with OpenVectorArena
+	mapping []byte
 
 	// Metadata to trace position
 	currentPageIdx int
@@ -22,18 +29,22 @@ type VectorArena struct {
 	totalVectors   uint32
 }
 
-// Initializes arena with a pre allocated capacity
+// Initializes arena with a pre allocated capacity, storing int8 scalar codes
 func NewVectorArena(dim int) *VectorArena {
+	return NewVectorArenaWithQuantizer(dim, NewScalarQuantizer(dim))
+}
 
-	// vecSizeBytes := dim * 4 // 4bytes per float32
+// NewVectorArenaWithQuantizer creates an arena whose slots hold the codes produced by q
+func NewVectorArenaWithQuantizer(dim int, q Quantizer) *VectorArena {
 
-	bytesPerVec := dim + 8 // 1 byter for each vector + 4 bytes Min + 4 bytes Max
+	bytesPerVec := q.CodeSize()
 	count := PageSizeBytes / bytesPerVec
 
 	return &VectorArena{
 
 		dim:            dim,
 		pages:          make([][]byte, 0),
+		quantizer:      q,
 		currentPageIdx: 0,
 		currentVecIdx:  0,
 		totalVectors:   0,
@@ -51,8 +62,6 @@ func (a *VectorArena) Add(vector []float32) (uint32, error) {
 		return 0, fmt.Errorf("vector dimension mismatch expected %d got %d", a.dim, len(vector))
 	}
 
-	qv := Quantize(vector)
-
 	if a.currentVecIdx >= a.vectorsPerPage || len(a.pages) == 0 {
 		// Allocate a new page
 		newPage := make([]byte, a.bytesPerVector*a.vectorsPerPage)
@@ -64,29 +73,6 @@ func (a *VectorArena) Add(vector []float32) (uint32, error) {
 		a.currentVecIdx = 0
 	}
 
-	// Calculate offset in bytes
-	// (index * dim * 4bytes)
-	offset := a.currentVecIdx * a.bytesPerVector
-
-	// Ensure we are writing to the LATEST page
-	// Using len(a.pages)-1 is safer than trusting currentPageIdx if sync gets weird
-	targetPage := a.pages[len(a.pages)-1]
-	destination := targetPage[offset : offset+a.bytesPerVector]
-
-	// Unsafe Copy
-	// Note: This relies on architecture being Little Endian (Standard on x86/ARM)
-	srcPtr := unsafe.Pointer(&qv.Data[0])
-	srcBytes := unsafe.Slice((*byte)(srcPtr), len(qv.Data)) // int8 slice to byte slice
-	copy(destination, srcBytes)
-
-	// Write Min and Max at the end of the vector bytes
-	minPtr := unsafe.Pointer(&qv.Min)
-	srcBytes = unsafe.Slice((*byte)(minPtr), 4) // float32 is 4 bytes
-	copy(targetPage[offset+a.dim:], srcBytes)
-	maxPtr := unsafe.Pointer(&qv.Max)
-	srcBytes = unsafe.Slice((*byte)(maxPtr), 4) // float32 is 4 bytes
-	copy(targetPage[offset+a.dim+4:], srcBytes)
-
 	// Calculate Global ID
 	// Logic: (Completed Pages * Size) + Current Index
 	globalId := uint32((len(a.pages)-1)*a.vectorsPerPage + a.currentVecIdx)
@@ -94,56 +80,56 @@ func (a *VectorArena) Add(vector []float32) (uint32, error) {
 	a.currentVecIdx++
 	a.totalVectors++
 
+	if t, ok := a.quantizer.(trainableQuantizer); ok && !t.Trained() {
+		// Keep the raw vector until there is enough data to train on
+		a.pending = append(a.pending, append([]float32(nil), vector...))
+		if len(a.pending) >= t.TrainSize() {
+			if err := a.trainLocked(t); err != nil {
+				return 0, err
+			}
+		}
+		return globalId, nil
+	}
+
+	a.quantizer.Encode(vector, a.slot(globalId))
 	return globalId, nil
 }
 
-// Retrieves a vector by its global index
-func (a *VectorArena) Get(index uint32) (QuantizedVector, error) {
-	a.mu.RLock()
-	defer a.mu.RUnlock()
-
-	// Calculate page and offset
-	if index >= a.totalVectors {
-		return QuantizedVector{}, fmt.Errorf("Index out of bounds")
+// trainLocked trains the quantizer on the pending vectors and encodes them into their slots.
+// Pending vectors always occupy the first slots of the arena.
+func (a *VectorArena) trainLocked(t trainableQuantizer) error {
+	if err := t.Train(a.pending); err != nil {
+		return err
+	}
+	for i, vec := range a.pending {
+		a.quantizer.Encode(vec, a.slot(uint32(i)))
 	}
+	a.pending = nil
+	return nil
+}
 
+// slot returns the bytes holding the code of a vector
+func (a *VectorArena) slot(index uint32) []byte {
 	pageIdx := int(index) / a.vectorsPerPage
 	vecIdxInPage := int(index) % a.vectorsPerPage
 
 	// Calculate byte offset within the page
 	offset := vecIdxInPage * a.bytesPerVector
-	rawbytes := a.pages[pageIdx][offset : offset+a.dim]
-
-	// Convert bytes to []float32 (Zero copy view)
-	// For safety making a copy now
-
-	out := make([]int8, a.dim)
-
-	ptr := unsafe.Pointer(&rawbytes[0])
-	srcFloats := unsafe.Slice((*int8)(ptr), a.dim)
-	outMax := make([]float32, 1)
-	outMin := make([]float32, 1)
-
-	rawbytes = a.pages[pageIdx][offset+a.dim : offset+a.dim+4]
-	ptr = unsafe.Pointer(&rawbytes[0])
-	srcMin := unsafe.Slice((*float32)(ptr), 4)
-	copy(outMin, srcMin)
-
-	rawbytes = a.pages[pageIdx][offset+a.dim+4 : offset+a.dim+8]
-	ptr = unsafe.Pointer(&rawbytes[0])
-	srcMax := unsafe.Slice((*float32)(ptr), 4)
-	copy(outMax, srcMax)
+	return a.pages[pageIdx][offset : offset+a.bytesPerVector]
+}
 
-	// Convert bytes back to float32 slice
-	copy(out, srcFloats)
+// Retrieves a decoded copy of a vector by its global index
+func (a *VectorArena) Get(index uint32) ([]float32, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 
-	qv := QuantizedVector{
-		Data: out,
-		Min:  outMin[0],
-		Max:  outMax[0],
+	if index >= a.totalVectors {
+		return nil, fmt.Errorf("Index out of bounds")
 	}
-
-	return qv, nil
+	if int(index) < len(a.pending) {
+		return append([]float32(nil), a.pending[index]...), nil
+	}
+	return a.quantizer.Decode(a.slot(index)), nil
 }
 
 // Returns the total number of vectors stored
@@ -152,3 +138,35 @@ func (a *VectorArena) Size() int {
 	defer a.mu.RUnlock()
 	return int(a.totalVectors)
 }
+
+// ArenaDistancer scores arena vectors against one query. The query is prepared
+// once by the quantizer (quantized, distance tables built) and reused for every
+// vector visited, so it should not be shared between goroutines.
+type ArenaDistancer struct {
+	arena    *VectorArena
+	query    []float32
+	prepared Distancer
+}
+
+// Distancer prepares a query for repeated distance computations against the arena
+func (a *VectorArena) Distancer(query []float32) *ArenaDistancer {
+	return &ArenaDistancer{arena: a, query: query}
+}
+
+// Distance returns the approximate squared euclidean distance between the query and a stored vector
+func (d *ArenaDistancer) Distance(index uint32) (float32, error) {
+	a := d.arena
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if index >= a.totalVectors {
+		return 0, fmt.Errorf("Index out of bounds")
+	}
+	if int(index) < len(a.pending) {
+		return dist(d.query, a.pending[index]), nil
+	}
+	if d.prepared == nil {
+		d.prepared = a.quantizer.Prepare(d.query)
+	}
+	return d.prepared.Distance(a.slot(index)), nil
+}
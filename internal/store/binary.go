@@ -0,0 +1,68 @@
+package store
+
+import "unsafe"
+
+// BinaryQuantizer keeps one bit per dimension, set when the value is positive,
+// followed by the mean absolute value of the vector used to decode it. It is meant
+// for large text embedding collections whose values are centered around zero.
+//
+// Distances are Hamming distances between sign bits, so they only produce candidates:
+// collections using it always keep float32 vectors to re-rank against.
+type BinaryQuantizer struct {
+	dim   int
+	words int // bytes of sign bits
+}
+
+func NewBinaryQuantizer(dim int) *BinaryQuantizer {
+	return &BinaryQuantizer{dim: dim, words: (dim + 7) / 8}
+}
+
+func (b *BinaryQuantizer) CodeSize() int {
+	return b.words + 4
+}
+
+func (b *BinaryQuantizer) Encode(vec []float32, dst []byte) {
+	signs := dst[:b.words]
+	for i := range signs {
+		signs[i] = 0
+	}
+	var sum float32
+	for i, v := range vec {
+		if v > 0 {
+			signs[i/8] |= 1 << (i % 8)
+			sum += v
+		} else {
+			sum -= v
+		}
+	}
+	scale := sum / float32(len(vec))
+	copy(dst[b.words:], unsafe.Slice((*byte)(unsafe.Pointer(&scale)), 4))
+}
+
+// Decode maps every bit back to +scale or -scale
+func (b *BinaryQuantizer) Decode(code []byte) []float32 {
+	scale := *(*float32)(unsafe.Pointer(&code[b.words]))
+	out := make([]float32, b.dim)
+	for i := range out {
+		if code[i/8]&(1<<(i%8)) != 0 {
+			out[i] = scale
+		} else {
+			out[i] = -scale
+		}
+	}
+	return out
+}
+
+func (b *BinaryQuantizer) Prepare(query []float32) Distancer {
+	code := make([]byte, b.CodeSize())
+	b.Encode(query, code)
+	return &hammingDistancer{query: code[:b.words]}
+}
+
+type hammingDistancer struct {
+	query []byte
+}
+
+func (d *hammingDistancer) Distance(code []byte) float32 {
+	return float32(hammingBytes(d.query, code[:len(d.query)]))
+}
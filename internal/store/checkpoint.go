@@ -0,0 +1,390 @@
+package store
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkpointPointer names the file holding the directory of the current checkpoint
+const checkpointPointer = "CHECKPOINT"
+
+// persistentIndex is implemented by indexes with a mappable file format of their
+// own, the others are checkpointed with Serialize and rebuilt with LoadIndex
+type persistentIndex interface {
+	Save(path string) error
+	Close() error
+}
+
+type checkpointMeta struct {
+	Applied      uint64
+	Dim          int
+	Index        IndexType
+	Quantization QuantizationType
+	Raw          bool
+
+	RevIndex []string
+	IDs      []string // live ids and their arena offsets
+	Offsets  []uint32
+	MetaLocs map[uint32]FileLocation
+}
+
+// Checkpoint writes the arena, the index and the id mapping under the storage
+// path, so the next NewVectraDBWithConfig maps them instead of rebuilding the
+// collection one insert at a time. applied is an opaque position chosen by the
+// caller, the raft FSM passes the last applied log index.
+//
+// Every checkpoint is written to its own directory and the CHECKPOINT file is
+// switched over last, a crash halfway leaves the previous checkpoint intact.
+func (db *VectraDB) Checkpoint(applied uint64) error {
+	db.checkpointMu.Lock()
+	defer db.checkpointMu.Unlock()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Wait for inserts that already stored their vector to finish indexing it
+	db.indexing.Lock()
+	defer db.indexing.Unlock()
+
+	name := fmt.Sprintf("checkpoint-%020d", applied)
+	dir := filepath.Join(db.path, name)
+	if applied != 0 && applied == db.checkpointed.Load() {
+		if _, err := os.Stat(dir); err == nil {
+			return nil // nothing was applied since
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := db.Arena.Save(filepath.Join(dir, "arena.vec")); err != nil {
+		return fmt.Errorf("failed to save arena: %w", err)
+	}
+	if db.raw != nil {
+		if err := db.raw.Save(filepath.Join(dir, "raw.vec")); err != nil {
+			return fmt.Errorf("failed to save re-rank arena: %w", err)
+		}
+	}
+	if err := db.saveIndex(dir, name); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "sparse.gob"), func(f *os.File) error {
+		return db.sparse.Serialize(f)
+	}); err != nil {
+		return fmt.Errorf("failed to save sparse index: %w", err)
+	}
+	if db.text != nil {
+		if err := writeFileAtomic(filepath.Join(dir, "text.gob"), func(f *os.File) error {
+			return db.text.Serialize(f)
+		}); err != nil {
+			return fmt.Errorf("failed to save text index: %w", err)
+		}
+	}
+
+	meta := checkpointMeta{
+		Applied:      applied,
+		Dim:          db.dim,
+		Index:        db.indexType(),
+		Quantization: db.quantization(),
+		Raw:          db.raw != nil,
+		RevIndex:     db.revIndex,
+		MetaLocs:     db.metaLocs,
+	}
+	for id, idx := range db.index {
+		meta.IDs = append(meta.IDs, id)
+		meta.Offsets = append(meta.Offsets, idx)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "checkpoint.gob"), func(f *os.File) error {
+		return gob.NewEncoder(f).Encode(meta)
+	}); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(filepath.Join(db.path, checkpointPointer), func(f *os.File) error {
+		_, err := f.WriteString(name + "\n")
+		return err
+	}); err != nil {
+		return err
+	}
+	db.checkpointed.Store(applied)
+
+	// Older checkpoints can go, files still mapped stay readable until unmapped
+	old, _ := filepath.Glob(filepath.Join(db.path, "checkpoint-*"))
+	for _, path := range old {
+		if filepath.Base(path) != name {
+			os.RemoveAll(path)
+		}
+	}
+	if db.indexType() == IndexVamana {
+		removeUndoLogs(db.config.Vamana.Path, name)
+	}
+	return nil
+}
+
+func (db *VectraDB) saveIndex(dir, name string) error {
+	if p, ok := db.Index.(persistentIndex); ok {
+		return p.Save(filepath.Join(dir, "index.graph"))
+	}
+	// The state of a disk resident graph only makes sense with the file as it
+	// is now, the sectors rewritten from here on are saved to an undo log
+	if v, ok := db.Index.(*VamanaIndex); ok {
+		if err := v.StartCheckpoint(name); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(filepath.Join(dir, "index.bin"), func(f *os.File) error {
+		return db.Index.Serialize(f)
+	})
+}
+
+// CheckpointIndex returns the position of the checkpoint the collection was opened
+// from or last wrote, 0 when there is none
+func (db *VectraDB) CheckpointIndex() uint64 {
+	return db.checkpointed.Load()
+}
+
+// open maps the checkpoint the CHECKPOINT file points at, or starts empty
+func (db *VectraDB) open() error {
+	name, err := os.ReadFile(filepath.Join(db.path, checkpointPointer))
+	if os.IsNotExist(err) {
+		return db.reset()
+	}
+	if err != nil {
+		return err
+	}
+	return db.openCheckpoint(filepath.Join(db.path, strings.TrimSpace(string(name))))
+}
+
+func (db *VectraDB) openCheckpoint(dir string) error {
+	var meta checkpointMeta
+	f, err := os.Open(filepath.Join(dir, "checkpoint.gob"))
+	if err != nil {
+		return err
+	}
+	err = gob.NewDecoder(f).Decode(&meta)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint %s: %w", dir, err)
+	}
+
+	if meta.Dim != db.dim || meta.Index != db.indexType() || meta.Quantization != db.quantization() || meta.Raw != db.rerankArena() {
+		return fmt.Errorf("checkpoint %s holds a dim %d %s index with %s quantization (re-rank %v), the collection is configured for dim %d %s with %s (re-rank %v)",
+			dir, meta.Dim, meta.Index, meta.Quantization, meta.Raw, db.dim, db.indexType(), db.quantization(), db.rerankArena())
+	}
+
+	quantizer, err := newQuantizer(db.config, db.dim)
+	if err != nil {
+		return err
+	}
+	arena, err := OpenVectorArena(filepath.Join(dir, "arena.vec"), quantizer)
+	if err != nil {
+		return err
+	}
+
+	var raw *VectorArena
+	if meta.Raw {
+		raw, err = OpenVectorArena(filepath.Join(dir, "raw.vec"), NewFloatQuantizer(db.dim))
+		if err != nil {
+			arena.Close()
+			return err
+		}
+	}
+
+	index, err := db.openIndex(dir, db.indexArena(arena, raw))
+	if err != nil {
+		arena.Close()
+		if raw != nil {
+			raw.Close()
+		}
+		return fmt.Errorf("failed to open index: %w", err)
+	}
+
+	db.Arena = arena
+	db.raw = raw
+	db.Index = index
+	db.revIndex = meta.RevIndex
+	db.metaLocs = meta.MetaLocs
+	if db.metaLocs == nil {
+		db.metaLocs = make(map[uint32]FileLocation)
+	}
+	db.index = make(map[string]uint32, len(meta.IDs))
+	for i, id := range meta.IDs {
+		db.index[id] = meta.Offsets[i]
+	}
+	if err := db.openSparse(dir); err != nil {
+		db.release()
+		return err
+	}
+	db.openText(dir)
+	db.checkpointed.Store(meta.Applied)
+	return nil
+}
+
+// openSparse loads the sparse vectors of a checkpoint, checkpoints written before
+// records had sparse vectors have none
+func (db *VectraDB) openSparse(dir string) error {
+	f, err := os.Open(filepath.Join(dir, "sparse.gob"))
+	if os.IsNotExist(err) {
+		db.sparse = NewSparseIndex()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	db.sparse, err = LoadSparseIndex(f)
+	if err != nil {
+		return fmt.Errorf("failed to load sparse index: %w", err)
+	}
+	return nil
+}
+
+// openText loads the text index of a checkpoint. Checkpoints written before the
+// collection indexed text, or over other fields, are reindexed from the metadata.
+func (db *VectraDB) openText(dir string) {
+	db.text = nil
+	if len(db.config.TextFields) == 0 {
+		return
+	}
+
+	if f, err := os.Open(filepath.Join(dir, "text.gob")); err == nil {
+		text, err := LoadTextIndex(f, db.config.TextFields)
+		f.Close()
+		if err == nil {
+			db.text = text
+			return
+		}
+	}
+
+	db.text = NewTextIndex(db.config.TextFields)
+	for _, idx := range db.index {
+		loc, exists := db.metaLocs[idx]
+		if !exists {
+			continue
+		}
+		if meta, err := db.disk.Read(loc); err == nil {
+			db.text.Add(idx, meta)
+		}
+	}
+}
+
+func (db *VectraDB) openIndex(dir string, arena *VectorArena) (Index, error) {
+	switch db.indexType() {
+	case IndexHNSW:
+		return OpenHNSWIndex(filepath.Join(dir, "index.graph"), arena)
+	case IndexVamana:
+		// The working file may hold records rewritten after the checkpoint.
+		// Checkpoints from before undo logs kept a copy of the graph instead.
+		graph := filepath.Join(dir, "vamana.graph")
+		if _, err := os.Stat(graph); err == nil {
+			if err := copyFile(db.config.Vamana.Path, graph); err != nil {
+				return nil, fmt.Errorf("failed to restore vamana graph: %w", err)
+			}
+		}
+		if err := rollbackGraph(db.config.Vamana.Path, filepath.Base(dir)); err != nil {
+			return nil, fmt.Errorf("failed to roll back vamana graph: %w", err)
+		}
+	}
+	f, err := os.Open(filepath.Join(dir, "index.bin"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadIndex(f, db.config, arena)
+}
+
+// Reset drops every record and starts over with an empty arena and index. The
+// metadata file and the last checkpoint on disk are kept. The raft FSM resets
+// before restoring a snapshot.
+func (db *VectraDB) Reset() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.indexing.Lock()
+	defer db.indexing.Unlock()
+
+	db.release()
+	db.checkpointed.Store(0)
+	return db.reset()
+}
+
+// Close releases the metadata file and any mapped checkpoint files
+func (db *VectraDB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.indexing.Lock()
+	defer db.indexing.Unlock()
+
+	db.release()
+	return db.disk.Close()
+}
+
+// release unmaps the arenas and index of a collection opened from a checkpoint
+// and closes the file of a disk resident index
+func (db *VectraDB) release() {
+	if c, ok := db.Index.(io.Closer); ok {
+		c.Close()
+	}
+	db.Arena.Close()
+	if db.raw != nil {
+		db.raw.Close()
+	}
+}
+
+func (db *VectraDB) indexType() IndexType {
+	if db.config.Index == "" {
+		return IndexHNSW
+	}
+	return db.config.Index
+}
+
+func (db *VectraDB) quantization() QuantizationType {
+	if db.config.Quantization == "" {
+		return QuantizationInt8
+	}
+	return db.config.Quantization
+}
+
+// copyFile replaces dst with a copy of src. io.Copy between files uses
+// copy_file_range on Linux, which shares blocks on filesystems with reflinks.
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFileAtomic(dst, func(f *os.File) error {
+		_, err := io.Copy(f, in)
+		return err
+	})
+}
+
+// writeFileAtomic writes a file through a temporary one renamed over path
+func writeFileAtomic(path string, write func(f *os.File) error) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
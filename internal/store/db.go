@@ -3,7 +3,12 @@ package store
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
 )
 
 type VectroRecord struct {
@@ -14,72 +19,230 @@ type VectroRecord struct {
 
 type VectraDB struct {
 	mu       sync.RWMutex
+	indexing sync.RWMutex // held shared by inserts still adding their vector to Index
 	index    map[string]uint32
 	revIndex []string
 
 	// Hot Path Storage
 	Arena *VectorArena
 
+	// Full precision copies of the vectors for re-ranking, nil unless the
+	// collection is quantized with Rerank enabled. Offsets match Arena.
+	raw *VectorArena
+
 	// Cold Path Storage
 	metaLocs map[uint32]FileLocation
 
+	// BM25 index over config.TextFields of the metadata, nil when there are none
+	text *TextIndex
+
+	// Optional sparse vectors of the records
+	sparse *SparseIndex
+
 	disk *DiskStore
+	path string
+
+	// Position passed to the last Checkpoint written or opened, 0 when none
+	checkpointed atomic.Uint64
+	checkpointMu sync.Mutex
 
 	dim int
 
-	HNSW *HNSWIndex
+	config CollectionConfig
+	Index  Index
 }
 
 func NewVectraDB(dim int, storagePath string) (*VectraDB, error) {
+	return NewVectraDBWithConfig(dim, storagePath, DefaultCollectionConfig())
+}
+
+// NewVectraDBWithConfig creates a collection using the index and tuning choices in config.
+// When storagePath holds a checkpoint the collection is reopened from it, see Checkpoint.
+func NewVectraDBWithConfig(dim int, storagePath string, config CollectionConfig) (*VectraDB, error) {
+
+	if config.Index == IndexVamana && config.Vamana.Path == "" {
+		config.Vamana.Path = filepath.Join(storagePath, "vamana.graph")
+	}
 
 	ds, err := NewDiskStore(fmt.Sprintf("%s/data.bin", storagePath))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to init disk store at %s: %w", storagePath, err)
 	}
-	localArena := NewVectorArena(dim)
 
 	db := &VectraDB{
-		index:    make(map[string]uint32),
-		revIndex: make([]string, 10000),
-		Arena:    localArena,
-		metaLocs: make(map[uint32]FileLocation),
-		disk:     ds,
-		dim:      dim,
-		HNSW:     NewHNSWIndex(localArena),
+		disk:   ds,
+		path:   storagePath,
+		dim:    dim,
+		config: config,
+	}
+	if err := db.open(); err != nil {
+		ds.Close()
+		return nil, err
 	}
 
 	return db, nil
 }
 
+// reset sets the collection up with an empty arena and index
+func (db *VectraDB) reset() error {
+	quantizer, err := newQuantizer(db.config, db.dim)
+	if err != nil {
+		return err
+	}
+	localArena := NewVectorArenaWithQuantizer(db.dim, quantizer)
+	var raw *VectorArena
+	if db.rerankArena() {
+		raw = NewVectorArenaWithQuantizer(db.dim, NewFloatQuantizer(db.dim))
+	}
+
+	index, err := newIndex(db.config, db.indexArena(localArena, raw))
+	if err != nil {
+		return err
+	}
+
+	db.index = make(map[string]uint32)
+	db.revIndex = make([]string, 0, 10000)
+	db.metaLocs = make(map[uint32]FileLocation)
+	db.Arena = localArena
+	db.Index = index
+	db.raw = raw
+	db.sparse = NewSparseIndex()
+	db.text = nil
+	if len(db.config.TextFields) > 0 {
+		db.text = NewTextIndex(db.config.TextFields)
+	}
+	return nil
+}
+
+// rerankArena reports whether the config keeps full precision copies, for
+// re-ranking or for the flat index to scan
+func (db *VectraDB) rerankArena() bool {
+	q := db.config.Quantization
+	if q == QuantizationNone {
+		return false
+	}
+	return q == QuantizationBinary || db.config.Rerank || db.indexType() == IndexFlat
+}
+
+// indexArena is the arena the index is built on. The flat index is exact, so
+// it scans the full precision copies when the arena is quantized.
+func (db *VectraDB) indexArena(arena, raw *VectorArena) *VectorArena {
+	if db.indexType() == IndexFlat && raw != nil {
+		return raw
+	}
+	return arena
+}
+
+// exactIndex reports whether the index scores against full precision vectors,
+// its results then need no re-ranking
+func (db *VectraDB) exactIndex() bool {
+	return db.raw == nil || db.indexType() == IndexFlat
+}
+
 func (db *VectraDB) Insert(id string, vector []float32, data any) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+	return db.InsertWithSparse(id, vector, nil, data)
+}
 
+// InsertWithSparse inserts a record that also carries a sparse vector, sparse may be nil
+func (db *VectraDB) InsertWithSparse(id string, vector []float32, sparse *SparseVector, data any) error {
 	bytes, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("Failed to marshal metadata: %w", err)
 	}
+	var sv SparseVector
+	if sparse != nil {
+		if sv, err = sparse.Normalize(); err != nil {
+			return err
+		}
+	}
 
-	idx, err := db.Arena.Add(vector)
+	db.mu.Lock()
+	idx, err := db.addVector(vector)
 	if err != nil {
+		db.mu.Unlock()
 		return err
 	}
 
 	loc, err := db.disk.Write(bytes)
 	if err != nil {
+		db.mu.Unlock()
 		return err
 	}
 
-	db.index[id] = idx
-	db.revIndex = append(db.revIndex, id)
+	db.bind(id, idx)
 
 	db.metaLocs[idx] = loc
+	if db.text != nil {
+		db.text.Add(idx, bytes)
+	}
+	db.sparse.Add(idx, sv)
+	db.indexing.RLock()
+	db.mu.Unlock()
+
+	db.addToIndex(vector, idx)
+
+	return nil
+}
+
+// UpdatePayload replaces the metadata of a record, its vectors stay as they are
+func (db *VectraDB) UpdatePayload(id string, data any) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal metadata: %w", err)
+	}
 
-	db.HNSW.Add(vector, id, idx)
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
+	idx, exists := db.index[id]
+	if !exists {
+		return fmt.Errorf("%w: %q", ErrRecordNotFound, id)
+	}
+	old, _ := db.disk.Read(db.metaLocs[idx])
+	loc, err := db.disk.Write(bytes)
+	if err != nil {
+		return err
+	}
+	db.metaLocs[idx] = loc
+	if db.text != nil {
+		db.text.Update(idx, old, bytes)
+	}
 	return nil
 }
 
+// addToIndex links a stored vector into the index after db.mu is released.
+// Index insertion is the slow part of an insert and the indexes handle
+// concurrent adds themselves, so inserts only serialize on the arena append.
+func (db *VectraDB) addToIndex(vector []float32, idx uint32) {
+	defer db.indexing.RUnlock()
+	db.Index.Add(vector, idx)
+}
+
+// bind points id at a new arena offset. Re-inserting an existing id is an
+// upsert, the old offset is tombstoned so it no longer shows up in searches.
+func (db *VectraDB) bind(id string, idx uint32) {
+	if old, exists := db.index[id]; exists {
+		db.Index.Delete(old)
+		db.sparse.Delete(old)
+		if db.text != nil {
+			db.text.Delete(old)
+		}
+	}
+	db.index[id] = idx
+	for uint32(len(db.revIndex)) <= idx {
+		db.revIndex = append(db.revIndex, "")
+	}
+	db.revIndex[idx] = id
+}
+
+// Contains reports whether a record with the id exists
+func (db *VectraDB) Contains(id string) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	_, exists := db.index[id]
+	return exists
+}
+
 func (db *VectraDB) Get(id string) ([]float32, []byte, bool) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
@@ -89,32 +252,270 @@ func (db *VectraDB) Get(id string) ([]float32, []byte, bool) {
 		return nil, nil, false
 	}
 
-	vec, _ := db.Arena.Get(idx)
+	vec, _ := db.vector(idx)
 	metaLoc := db.metaLocs[idx]
 	meta, err := db.disk.Read(metaLoc)
 	if err != nil {
-		return vec.Dequantize(), nil, true
+		return vec, nil, true
 	}
-	return vec.Dequantize(), meta, true
+	return vec, meta, true
 }
 
-func (db *VectraDB) Search(query []float32, topK int) []VectroRecord {
+func (db *VectraDB) Search(query []float32, topK int, opts SearchOptions) []VectroRecord {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
+	return db.search(query, topK, opts)
+}
 
-	return db.HNSW.Search(query, topK)
+// BatchQuery is one query of a batch search, with its own k and tuning
+type BatchQuery struct {
+	Vector []float32
+	TopK   int
+	Opts   SearchOptions
+}
 
+// SearchBatch runs many queries under a single read lock, spread over the CPUs.
+// The results are in the same order as the queries.
+func (db *VectraDB) SearchBatch(queries []BatchQuery) [][]VectroRecord {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	results := make([][]VectroRecord, len(queries))
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := min(runtime.GOMAXPROCS(0), len(queries)); w > 0; w-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1)) - 1; i < len(queries); i = int(next.Add(1)) - 1 {
+				q := queries[i]
+				results[i] = db.search(q.Vector, q.TopK, q.Opts)
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// search runs one query, the caller holds db.mu. The index breaks ties by
+// offset, so one match more than asked for is fetched: when it ties with the
+// last one, every match of that score is fetched and the cut is made by id
+// instead, like the merge across shards does.
+func (db *VectraDB) search(query []float32, topK int, opts SearchOptions) []VectroRecord {
+	if topK <= 0 {
+		return nil
+	}
+	fetch := topK + 1
+	matches := db.matches(query, fetch, opts)
+	for len(matches) == fetch && matches[fetch-1].Score == matches[topK-1].Score {
+		fetch *= 2
+		matches = db.matches(query, fetch, opts)
+	}
+
+	records := db.records(matches)
+	sortRecords(records)
+	if len(records) > topK {
+		records = records[:topK]
+	}
+	return records
+}
+
+// indexSearch is the signature of Index.Search
+type indexSearch func(query []float32, k int, opts SearchOptions) []Match
+
+// matches searches the index and re-ranks the candidates when it is not exact
+func (db *VectraDB) matches(query []float32, topK int, opts SearchOptions) []Match {
+	return db.matchesWith(db.Index.Search, query, topK, opts)
+}
+
+// matchesWith is matches with another way of searching the index, grouped
+// searches pass one that resumes an HNSW traversal
+func (db *VectraDB) matchesWith(search indexSearch, query []float32, topK int, opts SearchOptions) []Match {
+	if db.exactIndex() {
+		return search(query, topK, opts)
+	}
+	oversample := opts.Oversample
+	if oversample <= 0 {
+		oversample = db.config.Oversample
+	}
+	if oversample < 1 {
+		oversample = 1
+	}
+	// The radius and score threshold apply to the exact distances, not the
+	// quantized ones, a candidate just outside them may well be inside. For a
+	// range search topK is already its max_results cap, so that many results
+	// times oversample candidates are fetched.
+	candidateOpts := opts
+	candidateOpts.Radius = 0
+	candidateOpts.MinScore = nil
+	return db.rerank(query, search(query, topK*oversample, candidateOpts), topK, opts)
 }
 
+// rerank rescores candidates against the full precision vectors and keeps the best k.
+// The radius and score threshold are checked against the exact distances.
+func (db *VectraDB) rerank(query []float32, candidates []Match, k int, opts SearchOptions) []Match {
+	prepared := db.raw.Distancer(query)
+
+	out := candidates[:0]
+	for _, c := range candidates {
+		d, err := prepared.Distance(c.Index)
+		if err != nil || !opts.within(d) {
+			continue
+		}
+		c.Score = 1 - d
+		out = append(out, c)
+	}
+
+	slices.SortFunc(out, compareMatches)
+	if len(out) > k {
+		out = out[:k]
+	}
+	return out
+}
+
+// records maps index matches back to record ids
+func (db *VectraDB) records(matches []Match) []VectroRecord {
+	output := make([]VectroRecord, 0, len(matches))
+	for _, m := range matches {
+		if int(m.Index) >= len(db.revIndex) {
+			continue
+		}
+		output = append(output, VectroRecord{
+			ID:    db.revIndex[m.Index],
+			Score: m.Score,
+			Data:  json.RawMessage(`{}`),
+		})
+	}
+	return output
+}
+
+// Delete tombstones the vector in the index and forgets the id
 func (db *VectraDB) Delete(id string) error {
-	return db.HNSW.Delete(id)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	idx, exists := db.index[id]
+	if !exists {
+		return nil
+	}
+	if err := db.Index.Delete(idx); err != nil {
+		return err
+	}
+	db.sparse.Delete(idx)
+	if db.text != nil {
+		db.text.Delete(idx)
+	}
+	delete(db.index, id)
+	return nil
+}
+
+// InsertInMemory adds a vector, and its sparse vector when not nil, to the arena
+// and the indexes without writing metadata, used when restoring snapshot records
+// that carry none
+func (db *VectraDB) InsertInMemory(id string, vector []float32, sparse *SparseVector) (uint32, error) {
+	var sv SparseVector
+	if sparse != nil {
+		var err error
+		if sv, err = sparse.Normalize(); err != nil {
+			return 0, err
+		}
+	}
+
+	db.mu.Lock()
+	idx, err := db.addVector(vector)
+	if err != nil {
+		db.mu.Unlock()
+		return 0, err
+	}
+
+	db.bind(id, idx)
+	db.sparse.Add(idx, sv)
+	db.indexing.RLock()
+	db.mu.Unlock()
+
+	db.addToIndex(vector, idx)
+	return idx, nil
 }
 
-func (db *VectraDB) InsertInMemory(id string, vector []float32) (uint32, error) {
+// addVector stores a vector in the arena, and in the re-rank arena when there is one
+func (db *VectraDB) addVector(vector []float32) (uint32, error) {
 	idx, err := db.Arena.Add(vector)
+	if err != nil {
+		return 0, err
+	}
+	if db.raw != nil {
+		if _, err := db.raw.Add(vector); err != nil {
+			return 0, err
+		}
+	}
+	return idx, nil
+}
 
-	db.index[id] = idx
-	db.revIndex[idx] = id
-	// db.metaLocs[idx] = loc
-	return idx, err
+// vector returns the most precise copy of a stored vector: the re-rank arena,
+// the full vector kept by a disk index, or the decoded arena code
+func (db *VectraDB) vector(idx uint32) ([]float32, error) {
+	if db.raw != nil {
+		return db.raw.Get(idx)
+	}
+	if source, ok := db.Index.(interface {
+		Vector(idx uint32) ([]float32, error)
+	}); ok {
+		if vec, err := source.Vector(idx); err == nil {
+			return vec, nil
+		}
+		// Not linked into the graph yet
+	}
+	return db.Arena.Get(idx)
+}
+
+// Records calls fn with every live record, with its metadata when it has any,
+// under a single read lock so that they all come from the same state
+func (db *VectraDB) Records(fn func(rec ExportedRecord) error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for id, idx := range db.index {
+		vec, err := db.vector(idx)
+		if err != nil {
+			return err
+		}
+		rec := ExportedRecord{ID: id, Vector: vec}
+		if sv, ok := db.sparse.Get(idx); ok {
+			rec.Sparse = &sv
+		}
+		if loc, ok := db.metaLocs[idx]; ok {
+			if rec.Data, err = db.disk.Read(loc); err != nil {
+				return fmt.Errorf("failed to read metadata of %q: %w", id, err)
+			}
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IndexStats reports the state of the collection's index
+func (db *VectraDB) IndexStats() IndexStats {
+	return db.Index.Stats()
+}
+
+// SerializeIndex writes the index structure, see LoadIndex
+func (db *VectraDB) SerializeIndex(w io.Writer) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Wait for inserts that already stored their vector to finish indexing it
+	db.indexing.Lock()
+	defer db.indexing.Unlock()
+	return db.Index.Serialize(w)
+}
+
+// Retrain rebuilds indexes that learn from the data, such as IVF centroids
+func (db *VectraDB) Retrain() error {
+	trainable, ok := db.Index.(interface{ Retrain() error })
+	if !ok {
+		return fmt.Errorf("%s index does not support retraining", db.config.Index)
+	}
+	return trainable.Retrain()
 }
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestConcurrentInsertUpsertDeleteSearch hammers one collection with concurrent
+// inserts, upserts, deletes and searches, run it with -race
+func TestConcurrentInsertUpsertDeleteSearch(t *testing.T) {
+	for _, index := range []IndexType{IndexHNSW, IndexFlat, IndexIVF, IndexVamana} {
+		t.Run(string(index), func(t *testing.T) {
+			collection := DefaultCollectionConfig()
+			collection.Index = index
+			stressCollection(t, collection, 8, 4)
+		})
+	}
+}
+
+func stressCollection(t *testing.T, collection CollectionConfig, writers, readers int) {
+	items := stressItems(t)
+	db, err := NewVectraDBWithConfig(stressDim, t.TempDir(), collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var inserted, deleted sync.Map // id -> true
+	var done atomic.Bool
+
+	var wgRead sync.WaitGroup
+	for r := 0; r < readers; r++ {
+		wgRead.Add(1)
+		go func(seed int64) {
+			defer wgRead.Done()
+			rng := rand.New(rand.NewSource(seed))
+			// A bounded number of searches, back to back readers starve the
+			// writers under the race detector
+			for i := 0; i < items/4 && !done.Load(); i++ {
+				for _, rec := range db.Search(stressVector(rng), 10, SearchOptions{}) {
+					if _, ok := inserted.Load(rec.ID); !ok {
+						t.Errorf("search returned %s that was never inserted", rec.ID)
+						return
+					}
+				}
+			}
+		}(int64(r))
+	}
+
+	var wgWrite sync.WaitGroup
+	batch := items / writers
+	for w := 0; w < writers; w++ {
+		wgWrite.Add(1)
+		go func(w int) {
+			defer wgWrite.Done()
+			rng := rand.New(rand.NewSource(100 + int64(w)))
+			for i := 0; i < batch; i++ {
+				id := fmt.Sprintf("vec-%d", w*batch+i)
+				inserted.Store(id, true)
+				if err := db.Insert(id, stressVector(rng), nil); err != nil {
+					t.Errorf("insert %s: %v", id, err)
+					return
+				}
+				// Mix in upserts and deletes of ids this writer owns
+				switch i % 50 {
+				case 10:
+					if err := db.Insert(fmt.Sprintf("vec-%d", w*batch+i-5), stressVector(rng), nil); err != nil {
+						t.Errorf("upsert: %v", err)
+						return
+					}
+				case 20:
+					victim := fmt.Sprintf("vec-%d", w*batch+i-15)
+					deleted.Store(victim, true)
+					if err := db.Delete(victim); err != nil {
+						t.Errorf("delete %s: %v", victim, err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wgWrite.Wait()
+	done.Store(true)
+	wgRead.Wait()
+	if t.Failed() {
+		return
+	}
+
+	for w := 0; w < writers; w++ {
+		for i := 0; i < batch; i++ {
+			id := fmt.Sprintf("vec-%d", w*batch+i)
+			_, gone := deleted.Load(id)
+			if _, _, ok := db.Get(id); ok == gone {
+				t.Fatalf("%s: stored %v, deleted %v", id, ok, gone)
+			}
+		}
+	}
+	for _, rec := range db.Search(make([]float32, stressDim), items, SearchOptions{}) {
+		if _, gone := deleted.Load(rec.ID); gone {
+			t.Fatalf("search returned deleted %s", rec.ID)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// ExportedRecord is a stored record as Export hands it out. Vectors are decoded
+// from the collection's encoding, fp16 and bf16 values convert to float32 and
+// back without loss, so re-inserting them into a collection with the same
+// encoding restores the stored values exactly.
+type ExportedRecord struct {
+	ID     string
+	Vector []float32
+	Sparse *SparseVector
+	Data   json.RawMessage
+}
+
+// Export calls fn with every live record in id order. The ids are taken at the
+// start and every record is read on its own, so writers are not blocked for
+// the whole export. Records deleted in the meantime are skipped.
+func (db *VectraDB) Export(fn func(rec ExportedRecord) error) error {
+	db.mu.RLock()
+	ids := make([]string, 0, len(db.index))
+	for id := range db.index {
+		ids = append(ids, id)
+	}
+	db.mu.RUnlock()
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		rec, ok := db.export(id)
+		if !ok {
+			continue
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *VectraDB) export(id string) (ExportedRecord, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	idx, exists := db.index[id]
+	if !exists {
+		return ExportedRecord{}, false
+	}
+	vec, err := db.vector(idx)
+	if err != nil {
+		return ExportedRecord{}, false
+	}
+	rec := ExportedRecord{ID: id, Vector: vec}
+	if sv, ok := db.sparse.Get(idx); ok {
+		rec.Sparse = &sv
+	}
+	if loc, ok := db.metaLocs[idx]; ok {
+		if data, err := db.disk.Read(loc); err == nil {
+			rec.Data = data
+		}
+	}
+	return rec, true
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"encoding/gob"
+	"io"
+	"sync"
+)
+
+// FlatIndex is an exact brute-force index. Every query scans the whole arena
+// and keeps the best k in a MinHeap, which makes it the ground truth for
+// measuring the recall of the approximate indexes. It is only exact over a
+// float32 arena: VectraDB builds it on the full precision copies when the
+// collection is quantized.
+type FlatIndex struct {
+	mu    sync.RWMutex
+	arena *VectorArena
+
+	offsets    []uint32 // scan order, same as insertion order
+	added      map[uint32]bool
+	tombstones map[uint32]bool
+}
+
+type flatState struct {
+	Offsets    []uint32
+	Tombstones []uint32
+}
+
+func NewFlatIndex(arena *VectorArena) *FlatIndex {
+	return &FlatIndex{
+		arena:      arena,
+		added:      make(map[uint32]bool),
+		tombstones: make(map[uint32]bool),
+	}
+}
+
+func (f *FlatIndex) Add(vector []float32, idx uint32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.added[idx] {
+		return
+	}
+	f.offsets = append(f.offsets, idx)
+	f.added[idx] = true
+}
+
+// Search compares the query against every live vector. A range search keeps
+// the best k of those within the radius, so it is exact too.
+func (f *FlatIndex) Search(query []float32, k int, opts SearchOptions) []Match {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if k <= 0 {
+		return nil
+	}
+
+	prepared := f.arena.Distancer(query)
+	top := make(MinHeap, 0, k)
+	for _, off := range f.offsets {
+		if f.tombstones[off] {
+			continue
+		}
+		d, err := prepared.Distance(off)
+		if err != nil || !opts.within(d) {
+			continue
+		}
+		top.PushTopK(Match{Index: off, Score: 1 - d}, k)
+	}
+
+	return top.Sorted()
+}
+
+func (f *FlatIndex) Delete(idx uint32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// The offset may not be added yet when an insert is still in flight
+	f.tombstones[idx] = true
+	return nil
+}
+
+func (f *FlatIndex) Stats() IndexStats {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return IndexStats{
+		Type:    IndexFlat,
+		Vectors: len(f.offsets),
+		Deleted: len(f.tombstones),
+	}
+}
+
+func (f *FlatIndex) Serialize(w io.Writer) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	state := flatState{Offsets: f.offsets}
+	for off := range f.tombstones {
+		state.Tombstones = append(state.Tombstones, off)
+	}
+	return encodeIndex(w, IndexFlat, state)
+}
+
+func (f *FlatIndex) load(dec *gob.Decoder) error {
+	var state flatState
+	if err := dec.Decode(&state); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, off := range state.Offsets {
+		f.offsets = append(f.offsets, off)
+		f.added[off] = true
+	}
+	for _, off := range state.Tombstones {
+		f.tombstones[off] = true
+	}
+	return nil
+}
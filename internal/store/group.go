@@ -0,0 +1,181 @@
+package store
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"sync"
+)
+
+// maxGroupCandidates bounds how far a grouped search expands on one shard
+const maxGroupCandidates = 10000
+
+// GroupOptions turns a search into a grouped search: the best Size hits of each
+// of the Limit best groups, records are grouped by a top level metadata field
+type GroupOptions struct {
+	Field string
+	Size  int
+	Limit int
+}
+
+// RecordGroup holds the hits sharing one value of the group field, best first.
+// Key is the JSON encoding of the value.
+type RecordGroup struct {
+	Key  string
+	Hits []VectroRecord
+}
+
+// SearchGroups runs a grouped search on the collection. k starts at Size times
+// Limit and grows four times until Limit distinct groups are found, the
+// collection runs out of records or maxGroupCandidates is reached. On HNSW the
+// rounds resume one traversal with the larger ef, other indexes, and range
+// searches, run the whole search again. The metadata read for grouping is kept
+// across the rounds, and records are only built for the hits that are kept.
+// Records without the field are left out. Hits carry their metadata, it has
+// been read for grouping anyway.
+func (db *VectraDB) SearchGroups(query []float32, opts SearchOptions, group GroupOptions) []RecordGroup {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if group.Size <= 0 || group.Limit <= 0 || group.Field == "" {
+		return nil
+	}
+
+	search := indexSearch(db.Index.Search)
+	if h, ok := db.Index.(*HNSWIndex); ok && opts.Radius == 0 {
+		t := h.traverse(query)
+		search = func(_ []float32, k int, opts SearchOptions) []Match {
+			return t.search(k, opts)
+		}
+	}
+
+	// Metadata of offsets already seen, kept across the rounds
+	seen := make(map[uint32]groupedRecord)
+
+	k := group.Size * group.Limit
+	for {
+		matches := db.matchesWith(search, query, k, opts)
+		groups := db.groupMatches(matches, group, seen)
+		if len(groups) >= group.Limit || len(matches) < k || k >= maxGroupCandidates {
+			if len(groups) > group.Limit {
+				groups = groups[:group.Limit]
+			}
+			return groups
+		}
+		k = min(k*4, maxGroupCandidates)
+	}
+}
+
+type groupedRecord struct {
+	key  string
+	data json.RawMessage
+	ok   bool // has the group field
+}
+
+// groupMatches groups matches, already ordered best first, by the group field.
+// Groups are ordered by their best hit and hold at most group.Size hits.
+func (db *VectraDB) groupMatches(matches []Match, group GroupOptions, seen map[uint32]groupedRecord) []RecordGroup {
+	var groups []RecordGroup
+	index := make(map[string]int)
+	for _, m := range matches {
+		if int(m.Index) >= len(db.revIndex) {
+			continue
+		}
+		g, exists := seen[m.Index]
+		if !exists {
+			g = db.groupKey(m.Index, group.Field)
+			seen[m.Index] = g
+		}
+		if !g.ok {
+			continue
+		}
+
+		i, exists := index[g.key]
+		if !exists {
+			i = len(groups)
+			index[g.key] = i
+			groups = append(groups, RecordGroup{Key: g.key})
+		}
+		if len(groups[i].Hits) < group.Size {
+			groups[i].Hits = append(groups[i].Hits, VectroRecord{
+				ID:    db.revIndex[m.Index],
+				Score: m.Score,
+				Data:  g.data,
+			})
+		}
+	}
+	return groups
+}
+
+// groupKey reads the metadata stored for an offset and the value of the group field
+func (db *VectraDB) groupKey(idx uint32, field string) groupedRecord {
+	loc, exists := db.metaLocs[idx]
+	if !exists {
+		return groupedRecord{}
+	}
+	data, err := db.disk.Read(loc)
+	if err != nil {
+		return groupedRecord{}
+	}
+
+	var meta map[string]json.RawMessage
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return groupedRecord{}
+	}
+	value, exists := meta[field]
+	if !exists || string(value) == "null" {
+		return groupedRecord{}
+	}
+	return groupedRecord{key: string(value), data: data, ok: true}
+}
+
+// SearchGroups runs a grouped search on every shard and merges groups with the
+// same key, keeping the best group.Size hits of the best group.Limit groups
+func (c *Cluster) SearchGroups(query []float32, opts SearchOptions, group GroupOptions) []RecordGroup {
+	var wg sync.WaitGroup
+
+	resultCh := make(chan []RecordGroup, c.numShards)
+	for _, shard := range c.shards {
+		wg.Add(1)
+		go func(s ShardHandler) {
+			defer wg.Done()
+			resultCh <- s.SearchGroups(query, opts, group)
+		}(shard)
+	}
+
+	wg.Wait()
+	close(resultCh)
+
+	var merged []RecordGroup
+	index := make(map[string]int)
+	for shardGroups := range resultCh {
+		for _, g := range shardGroups {
+			i, exists := index[g.Key]
+			if !exists {
+				index[g.Key] = len(merged)
+				merged = append(merged, RecordGroup{Key: g.Key, Hits: g.Hits})
+				continue
+			}
+			merged[i].Hits = append(merged[i].Hits, g.Hits...)
+		}
+	}
+
+	for i := range merged {
+		sortRecords(merged[i].Hits)
+		if len(merged[i].Hits) > group.Size {
+			merged[i].Hits = merged[i].Hits[:group.Size]
+		}
+	}
+	// Best group first, ties broken by key like records are by id
+	slices.SortFunc(merged, func(a, b RecordGroup) int {
+		if c := cmp.Compare(b.Hits[0].Score, a.Hits[0].Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+
+	if len(merged) > group.Limit {
+		merged = merged[:group.Limit]
+	}
+	return merged
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// TestSearchGroupsMatchesExact groups by a field with only a few more values
+// than groups asked for, so the HNSW search has to resume its traversal over
+// several rounds. Its groups must be nearly those of an exact search.
+func TestSearchGroupsMatchesExact(t *testing.T) {
+	const n, categories = 2000, 40
+	group := GroupOptions{Field: "cat", Size: 2, Limit: 35}
+
+	dbs := make(map[IndexType]*VectraDB)
+	for _, index := range []IndexType{IndexHNSW, IndexFlat} {
+		collection := DefaultCollectionConfig()
+		collection.Index = index
+		db, err := NewVectraDBWithConfig(stressDim, t.TempDir(), collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < n; i++ {
+			if err := db.Insert(fmt.Sprintf("vec-%d", i), stressVector(rng), map[string]any{"cat": i % categories}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dbs[index] = db
+	}
+
+	rng := rand.New(rand.NewSource(2))
+	found, total := 0, 0
+	for q := 0; q < 10; q++ {
+		query := stressVector(rng)
+		want := make(map[string]bool)
+		for _, g := range dbs[IndexFlat].SearchGroups(query, SearchOptions{}, group) {
+			want[g.Key] = true
+		}
+		got := dbs[IndexHNSW].SearchGroups(query, SearchOptions{}, group)
+		if len(got) != group.Limit {
+			t.Fatalf("query %d: %d groups, want %d", q, len(got), group.Limit)
+		}
+		for _, g := range got {
+			if len(g.Hits) == 0 || len(g.Hits) > group.Size {
+				t.Fatalf("query %d: group %s has %d hits", q, g.Key, len(g.Hits))
+			}
+			if len(g.Hits) == 2 && g.Hits[0].Score < g.Hits[1].Score {
+				t.Fatalf("query %d: group %s hits out of order", q, g.Key)
+			}
+			if want[g.Key] {
+				found++
+			}
+		}
+		total += len(want)
+	}
+	if ratio := float64(found) / float64(total); ratio < 0.9 {
+		t.Fatalf("found %.3f of the exact groups", ratio)
+	}
+}
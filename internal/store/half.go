@@ -0,0 +1,173 @@
+package store
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// halfBlock is the number of dimensions converted to float32 at a time by the
+// half precision distance kernels
+const halfBlock = 64
+
+// HalfQuantizer stores every dimension in 16 bits, either as IEEE 754 half precision
+// (fp16) or as bfloat16 (the top half of a float32). Both decode to float32 exactly,
+// so vectors survive snapshots and restores without further loss.
+type HalfQuantizer struct {
+	dim    int
+	bfloat bool
+}
+
+func NewFloat16Quantizer(dim int) *HalfQuantizer {
+	fp16TableOnce.Do(buildFP16Table)
+	return &HalfQuantizer{dim: dim}
+}
+
+func NewBFloat16Quantizer(dim int) *HalfQuantizer {
+	return &HalfQuantizer{dim: dim, bfloat: true}
+}
+
+func (h *HalfQuantizer) CodeSize() int {
+	return h.dim * 2
+}
+
+func (h *HalfQuantizer) Encode(vec []float32, dst []byte) {
+	for i, v := range vec {
+		var bits uint16
+		if h.bfloat {
+			bits = float32ToBFloat16(v)
+		} else {
+			bits = float32ToFloat16(v)
+		}
+		binary.LittleEndian.PutUint16(dst[i*2:], bits)
+	}
+}
+
+func (h *HalfQuantizer) Decode(code []byte) []float32 {
+	out := make([]float32, h.dim)
+	h.decodeInto(out, code)
+	return out
+}
+
+// decodeInto converts len(dst) values from the start of code
+func (h *HalfQuantizer) decodeInto(dst []float32, code []byte) {
+	if h.bfloat {
+		for i := range dst {
+			dst[i] = math.Float32frombits(uint32(binary.LittleEndian.Uint16(code[i*2:])) << 16)
+		}
+		return
+	}
+	for i := range dst {
+		dst[i] = fp16Table[binary.LittleEndian.Uint16(code[i*2:])]
+	}
+}
+
+func (h *HalfQuantizer) Prepare(query []float32) Distancer {
+	return &halfDistancer{h: h, query: query}
+}
+
+type halfDistancer struct {
+	h     *HalfQuantizer
+	query []float32
+	block [halfBlock]float32
+}
+
+// Distance converts the code in blocks so the float32 loop stays cache and register friendly
+func (d *halfDistancer) Distance(code []byte) float32 {
+	var sum float32
+	for start := 0; start < d.h.dim; start += halfBlock {
+		n := d.h.dim - start
+		if n > halfBlock {
+			n = halfBlock
+		}
+		block := d.block[:n]
+		d.h.decodeInto(block, code[start*2:])
+		sum += dist(d.query[start:start+n], block)
+	}
+	return sum
+}
+
+var (
+	fp16TableOnce sync.Once
+	fp16Table     []float32 // every fp16 bit pattern decoded to float32
+)
+
+func buildFP16Table() {
+	fp16Table = make([]float32, 1<<16)
+	for i := range fp16Table {
+		fp16Table[i] = float16ToFloat32(uint16(i))
+	}
+}
+
+// float32ToFloat16 rounds to the nearest fp16, ties to even. Values too large
+// become infinity, values too small become (signed) zero or subnormals.
+func float32ToFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int32(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+
+	switch {
+	case exp == 0xff: // Inf or NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp-127 > 15: // overflow
+		return sign | 0x7c00
+	case exp-127 >= -14: // normal
+		half := uint32(exp-127+15)<<10 | mant>>13
+		// Round to nearest even on the 13 dropped bits, a carry into the
+		// exponent is correct and may produce infinity
+		rest := mant & 0x1fff
+		if rest > 0x1000 || (rest == 0x1000 && half&1 == 1) {
+			half++
+		}
+		return sign | uint16(half)
+	case exp-127 >= -25: // subnormal
+		mant |= 0x800000
+		shift := uint32(-14-(exp-127)) + 13
+		half := mant >> shift
+		rest := mant & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if rest > halfway || (rest == halfway && half&1 == 1) {
+			half++
+		}
+		return sign | uint16(half)
+	default: // underflow
+		return sign
+	}
+}
+
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch {
+	case exp == 0x1f: // Inf or NaN
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case exp == 0:
+		if mant == 0 {
+			return math.Float32frombits(sign)
+		}
+		// Subnormal, value is mant * 2^-24
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			return -f
+		}
+		return f
+	default:
+		return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+	}
+}
+
+// float32ToBFloat16 keeps the top 16 bits of the float32, rounded to nearest even
+func float32ToBFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	if bits&0x7fffffff > 0x7f800000 { // NaN, keep it quiet
+		return uint16(bits>>16) | 0x40
+	}
+	bits += 0x7fff + (bits>>16)&1
+	return uint16(bits >> 16)
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloat32ToFloat16(t *testing.T) {
+	tests := []struct {
+		name string
+		in   float32
+		want uint16
+	}{
+		{"zero", 0, 0x0000},
+		{"negative zero", float32(math.Copysign(0, -1)), 0x8000},
+		{"one", 1, 0x3c00},
+		{"minus two", -2, 0xc000},
+		{"0.1 rounds down", 0.1, 0x2e66},
+		{"tie rounds to even, down", 1 + 1.0/(1<<11), 0x3c00},
+		{"tie rounds to even, up", 1 + 3.0/(1<<11), 0x3c02},
+		{"above the tie rounds up", 1 + 1.0/(1<<11) + 1.0/(1<<20), 0x3c01},
+		{"carry into the exponent", 1 - 1.0/(1<<12), 0x3c00},
+		{"largest normal", 65504, 0x7bff},
+		{"below the overflow tie", 65519, 0x7bff},
+		{"overflow tie rounds to infinity", 65520, 0x7c00},
+		{"overflow", 1e6, 0x7c00},
+		{"negative overflow", -1e6, 0xfc00},
+		{"infinity", float32(math.Inf(1)), 0x7c00},
+		{"negative infinity", float32(math.Inf(-1)), 0xfc00},
+		{"smallest normal", 1.0 / (1 << 14), 0x0400},
+		{"largest subnormal", 1023.0 / (1 << 24), 0x03ff},
+		{"subnormal rounds up to normal", 1023.75 / (1 << 24), 0x0400},
+		{"smallest subnormal", 1.0 / (1 << 24), 0x0001},
+		{"negative subnormal", -3.0 / (1 << 24), 0x8003},
+		{"subnormal tie rounds to even", 2.5 / (1 << 24), 0x0002},
+		{"half the smallest subnormal rounds to zero", 1.0 / (1 << 25), 0x0000},
+		{"above half the smallest subnormal", 1.5 / (1 << 25), 0x0001},
+		{"underflow", 1e-8, 0x0000},
+		{"negative underflow", -1e-8, 0x8000},
+		{"float32 subnormal", math.Float32frombits(0x00000001), 0x0000},
+		{"NaN", float32(math.NaN()), 0x7e00},
+		{"negative NaN", math.Float32frombits(0xffc00001), 0xfe00},
+	}
+	for _, tt := range tests {
+		if got := float32ToFloat16(tt.in); got != tt.want {
+			t.Errorf("%s: float32ToFloat16(%v) = %#04x, want %#04x", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFloat16ToFloat32(t *testing.T) {
+	tests := []struct {
+		in   uint16
+		want float32
+	}{
+		{0x0000, 0},
+		{0x3c00, 1},
+		{0xc000, -2},
+		{0x3555, 0.333251953125},
+		{0x7bff, 65504},
+		{0x0400, 1.0 / (1 << 14)},
+		{0x03ff, 1023.0 / (1 << 24)},
+		{0x0001, 1.0 / (1 << 24)},
+		{0x8001, -1.0 / (1 << 24)},
+		{0x7c00, float32(math.Inf(1))},
+		{0xfc00, float32(math.Inf(-1))},
+	}
+	for _, tt := range tests {
+		if got := float16ToFloat32(tt.in); got != tt.want {
+			t.Errorf("float16ToFloat32(%#04x) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	if got := math.Float32bits(float16ToFloat32(0x8000)); got != 0x80000000 {
+		t.Errorf("negative zero decoded to %#08x", got)
+	}
+	for _, nan := range []uint16{0x7e00, 0x7c01, 0xfe00} {
+		if got := float16ToFloat32(nan); !math.IsNaN(float64(got)) {
+			t.Errorf("float16ToFloat32(%#04x) = %v, want NaN", nan, got)
+		}
+	}
+}
+
+// TestFloat16RoundTrip decodes every fp16 bit pattern, encoding it again must
+// give the same bits. NaNs come back as quiet NaNs with their sign.
+func TestFloat16RoundTrip(t *testing.T) {
+	q := NewFloat16Quantizer(1)
+	for i := 0; i < 1<<16; i++ {
+		h := uint16(i)
+		f := float16ToFloat32(h)
+		if table := q.Decode([]byte{byte(h), byte(h >> 8)})[0]; math.Float32bits(table) != math.Float32bits(f) {
+			t.Fatalf("table decodes %#04x to %v, want %v", h, table, f)
+		}
+		want := h
+		if h&0x7c00 == 0x7c00 && h&0x3ff != 0 {
+			want = h&0x8000 | 0x7e00
+		}
+		if got := float32ToFloat16(f); got != want {
+			t.Fatalf("%#04x decoded to %v and encoded back to %#04x", h, f, got)
+		}
+	}
+}
+
+func TestFloat32ToBFloat16(t *testing.T) {
+	tests := []struct {
+		name string
+		in   uint32 // float32 bits
+		want uint16
+	}{
+		{"zero", 0x00000000, 0x0000},
+		{"negative zero", 0x80000000, 0x8000},
+		{"one", 0x3f800000, 0x3f80},
+		{"minus two", 0xc0000000, 0xc000},
+		{"below the tie rounds down", 0x3f807fff, 0x3f80},
+		{"tie rounds to even, down", 0x3f808000, 0x3f80},
+		{"tie rounds to even, up", 0x3f818000, 0x3f82},
+		{"above the tie rounds up", 0x3f808001, 0x3f81},
+		{"carry into the exponent", 0x3fffffff, 0x4000},
+		{"largest float32 rounds to infinity", 0x7f7fffff, 0x7f80},
+		{"largest bfloat16", 0x7f7f0000, 0x7f7f},
+		{"infinity", 0x7f800000, 0x7f80},
+		{"negative infinity", 0xff800000, 0xff80},
+		{"subnormal", 0x00010000, 0x0001},
+		{"subnormal tie rounds to even", 0x00008000, 0x0000},
+		{"subnormal rounds up", 0x00018000, 0x0002},
+		{"quiet NaN", 0x7fc00000, 0x7fc0},
+		{"NaN payload in the low bits stays NaN", 0x7f800001, 0x7fc0},
+		{"negative NaN", 0xffc00000, 0xffc0},
+	}
+	for _, tt := range tests {
+		if got := float32ToBFloat16(math.Float32frombits(tt.in)); got != tt.want {
+			t.Errorf("%s: float32ToBFloat16(%#08x) = %#04x, want %#04x", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestBFloat16RoundTrip decodes every bfloat16 bit pattern, encoding it again
+// must give the same bits. NaNs are quieted.
+func TestBFloat16RoundTrip(t *testing.T) {
+	q := NewBFloat16Quantizer(1)
+	for i := 0; i < 1<<16; i++ {
+		h := uint16(i)
+		f := q.Decode([]byte{byte(h), byte(h >> 8)})[0]
+		if math.Float32bits(f) != uint32(h)<<16 {
+			t.Fatalf("%#04x decoded to %#08x", h, math.Float32bits(f))
+		}
+		want := h
+		if h&0x7f80 == 0x7f80 && h&0x7f != 0 {
+			want |= 0x40
+		}
+		if got := float32ToBFloat16(f); got != want {
+			t.Fatalf("%#04x decoded to %v and encoded back to %#04x", h, f, got)
+		}
+	}
+}
@@ -1,10 +1,30 @@
 package store
 
+import (
+	"cmp"
+	"slices"
+)
+
 type Match struct {
 	Index uint32
 	Score float32
 }
 
+// compareMatches orders matches by score, highest first. Equal scores are ordered
+// by arena offset, so which of them survives a cut to k never depends on the
+// order they were found in.
+func compareMatches(a, b Match) int {
+	if c := cmp.Compare(b.Score, a.Score); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Index, b.Index)
+}
+
+// weaker reports whether a ranks below b
+func weaker(a, b Match) bool {
+	return compareMatches(a, b) > 0
+}
+
 type MinHeap []Match
 
 func (h *MinHeap) Len() int { return len(*h) }
@@ -19,10 +39,28 @@ func (h *MinHeap) Replace(m Match) {
 	h.down(0, len(*h))
 }
 
+// PushTopK keeps only the k highest scoring matches in the heap,
+// the weakest of them sits at the root.
+func (h *MinHeap) PushTopK(m Match, k int) {
+	if h.Len() < k {
+		h.Push(m)
+	} else if weaker((*h)[0], m) {
+		h.Replace(m)
+	}
+}
+
+// Sorted returns the matches ordered from highest to lowest score, then by offset.
+func (h MinHeap) Sorted() []Match {
+	out := make([]Match, len(h))
+	copy(out, h)
+	slices.SortFunc(out, compareMatches)
+	return out
+}
+
 func (h *MinHeap) up(j int) {
 	for {
 		i := (j - 1) / 2
-		if i == j || (*h)[j].Score >= (*h)[i].Score {
+		if i == j || !weaker((*h)[j], (*h)[i]) {
 			break
 		}
 		(*h)[i], (*h)[j] = (*h)[j], (*h)[i]
@@ -38,10 +76,10 @@ func (h *MinHeap) down(i0, n int) {
 			break
 		}
 		j := j1
-		if j2 := j1 + 1; j2 < n && (*h)[j2].Score < (*h)[j1].Score {
+		if j2 := j1 + 1; j2 < n && weaker((*h)[j2], (*h)[j1]) {
 			j = j2
 		}
-		if (*h)[i].Score <= (*h)[j].Score {
+		if !weaker((*h)[j], (*h)[i]) {
 			break
 		}
 		(*h)[i], (*h)[j] = (*h)[j], (*h)[i]
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// TestPushTopKBreaksTiesByOffset cuts a list full of equal scores at k, the
+// lowest offsets must survive whatever order they arrive in
+func TestPushTopKBreaksTiesByOffset(t *testing.T) {
+	matches := make([]Match, 50)
+	for i := range matches {
+		matches[i] = Match{Index: uint32(i), Score: float32(i%3) / 2}
+	}
+	want := []Match{{Index: 2, Score: 1}, {Index: 5, Score: 1}, {Index: 8, Score: 1}, {Index: 11, Score: 1}}
+
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 20; trial++ {
+		rng.Shuffle(len(matches), func(i, j int) { matches[i], matches[j] = matches[j], matches[i] })
+		var top MinHeap
+		for _, m := range matches {
+			top.PushTopK(m, len(want))
+		}
+		if got := top.Sorted(); !slices.Equal(got, want) {
+			t.Fatalf("trial %d: got %v want %v", trial, got, want)
+		}
+	}
+}
+
+// TestSearchBreaksTiesByID inserts equal vectors in reverse id order, so the
+// index's offset order is the opposite of the id order. Each shard must keep
+// the lowest ids at its cut, the merged results then match a single shard.
+func TestSearchBreaksTiesByID(t *testing.T) {
+	for _, index := range []IndexType{IndexHNSW, IndexFlat} {
+		t.Run(string(index), func(t *testing.T) {
+			collection := DefaultCollectionConfig()
+			collection.Index = index
+
+			var shards []ShardHandler
+			for s := 0; s < 2; s++ {
+				db, err := NewVectraDBWithConfig(4, t.TempDir(), collection)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer db.Close()
+				shards = append(shards, db)
+			}
+			c := NewCluster(shards)
+			for i := 29; i >= 0; i-- {
+				if err := c.Insert(fmt.Sprintf("id-%02d", i), []float32{1, 0, 0, 0}, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := c.Insert("far", []float32{0, 0, 0, 1}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, k := range []int{1, 3, 10} {
+				var got []string
+				for _, rec := range c.Search([]float32{1, 0, 0, 0}, k, SearchOptions{}) {
+					got = append(got, rec.ID)
+				}
+				var want []string
+				for i := 0; i < k; i++ {
+					want = append(want, fmt.Sprintf("id-%02d", i))
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("k=%d: got %v want %v", k, got, want)
+				}
+			}
+		})
+	}
+}
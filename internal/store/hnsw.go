@@ -1,10 +1,13 @@
 package store
 
 import (
-	"encoding/json"
+	"cmp"
+	"encoding/gob"
+	"io"
 	"math/rand"
-	"sort"
+	"slices"
 	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -14,35 +17,199 @@ const (
 	HNSW_LevelMult   = 1 / 0.69 // Normalization factor for level generation
 )
 
-type HNSWNode struct {
-	ID          string
-	Layer       int
-	Connections [][]string //[Level][neighbourID]
-	ArenaOffset uint32
-	sync.RWMutex
+// hnswNode is the per vector state of the graph. Nodes are identified by their
+// arena offset, the external string ids only exist in VectraDB.
+type hnswNode struct {
+	mu      sync.Mutex // guards the node's neighbour lists on every layer
+	level   int8       // top layer, -1 when the offset is not in the graph
+	deleted atomic.Bool
+	upper   uint32 // first list of the node in the upper layer slab, layer l uses upper+l-1
+}
+
+// hnswNodesPerPage is how many nodes one page of the node table holds
+const hnswNodesPerPage = 4096
+
+// nodeTable is a paged array of nodes indexed by arena offset. Pages never move
+// and the directory is replaced atomically, so lookups need no lock while it grows.
+type nodeTable struct {
+	mu    sync.Mutex // serializes growth
+	pages atomic.Pointer[[][]hnswNode]
+}
+
+func newNodeTable() *nodeTable {
+	t := &nodeTable{}
+	t.pages.Store(&[][]hnswNode{})
+	return t
+}
+
+// get returns the node at an offset, nil when the table does not reach it yet
+func (t *nodeTable) get(id uint32) *hnswNode {
+	pages := *t.pages.Load()
+	if int(id/hnswNodesPerPage) >= len(pages) {
+		return nil
+	}
+	return &pages[id/hnswNodesPerPage][id%hnswNodesPerPage]
+}
+
+// ensure grows the table to cover the offset and returns its node
+func (t *nodeTable) ensure(id uint32) *hnswNode {
+	if n := t.get(id); n != nil {
+		return n
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pages := *t.pages.Load()
+	if int(id/hnswNodesPerPage) >= len(pages) {
+		next := append([][]hnswNode(nil), pages...)
+		for int(id/hnswNodesPerPage) >= len(next) {
+			page := make([]hnswNode, hnswNodesPerPage)
+			for i := range page {
+				page[i].level = -1
+			}
+			next = append(next, page)
+		}
+		t.pages.Store(&next)
+	}
+	return t.get(id)
 }
 
+// size is the number of offsets the table currently covers
+func (t *nodeTable) size() int {
+	return len(*t.pages.Load()) * hnswNodesPerPage
+}
+
+// HNSWIndex is safe for concurrent use. Inserts link nodes under per-node locks
+// so they run in parallel with each other and with searches, only inserts that
+// raise the top layer are serialized. The RWMutex is held shared by inserts and
+// exclusively while serializing or loading the whole graph.
 type HNSWIndex struct {
-	EntryNodeID string
-	Nodes       map[string]*HNSWNode
-	MaxLayer    int
-	Arena       *VectorArena
-	Tombstones  map[string]bool
+	Entry    uint32 // arena offset of the entry point
+	MaxLayer int    // -1 while the graph is empty
+	Arena    *VectorArena
 	sync.RWMutex
+
+	entryMu sync.RWMutex // guards Entry and MaxLayer
+	topMu   sync.Mutex   // held by inserts that may raise MaxLayer
+
+	nodes   *nodeTable     // by arena offset
+	layer0  *adjacencySlab // layer 0 neighbour lists, the list id is the arena offset
+	upper   *adjacencySlab // layer 1+ neighbour lists
+	count   atomic.Int64
+	deleted atomic.Int64
+
+	scratch sync.Pool // *searchScratch
+
+	// File mapping backing the adjacency pages of an index opened with OpenHNSWIndex
+	mapping []byte
 }
 
 type nodeDist struct {
-	node *HNSWNode
+	id   uint32
 	dist float32
 }
 
+// byDist orders nodes closest first, equal distances by offset so that cutting
+// a list to ef or M keeps the same nodes whatever order they were visited in
+func byDist(a, b nodeDist) int {
+	if c := cmp.Compare(a.dist, b.dist); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.id, b.id)
+}
+
+// distHeap is a binary heap of nodeDist, the order is given by less on every call
+type distHeap []nodeDist
+
+func closer(a, b nodeDist) bool  { return byDist(a, b) < 0 }
+func further(a, b nodeDist) bool { return byDist(a, b) > 0 }
+
+func (h *distHeap) push(n nodeDist, less func(a, b nodeDist) bool) {
+	*h = append(*h, n)
+	s := *h
+	for j := len(s) - 1; j > 0; {
+		i := (j - 1) / 2
+		if !less(s[j], s[i]) {
+			break
+		}
+		s[i], s[j] = s[j], s[i]
+		j = i
+	}
+}
+
+func (h *distHeap) pop(less func(a, b nodeDist) bool) nodeDist {
+	s := *h
+	top := s[0]
+	last := len(s) - 1
+	s[0] = s[last]
+	s = s[:last]
+	for i := 0; ; {
+		j := 2*i + 1
+		if j >= len(s) {
+			break
+		}
+		if j+1 < len(s) && less(s[j+1], s[j]) {
+			j++
+		}
+		if !less(s[j], s[i]) {
+			break
+		}
+		s[i], s[j] = s[j], s[i]
+		i = j
+	}
+	*h = s
+	return top
+}
+
+// visitedSet marks arena offsets seen during one search. Bumping the generation
+// clears it without touching memory, so it can be reused across searches.
+type visitedSet struct {
+	marks []uint32
+	gen   uint32
+}
+
+func (v *visitedSet) reset(size int) {
+	if len(v.marks) < size {
+		v.marks = make([]uint32, size+size/4)
+		v.gen = 0
+	}
+	v.gen++
+	if v.gen == 0 {
+		clear(v.marks)
+		v.gen = 1
+	}
+}
+
+// visit marks the offset and reports whether it was unvisited
+func (v *visitedSet) visit(off uint32) bool {
+	if int(off) >= len(v.marks) {
+		// Added after the search started, grow instead of failing
+		v.marks = append(v.marks, make([]uint32, int(off)-len(v.marks)+1)...)
+	}
+	if v.marks[off] == v.gen {
+		return false
+	}
+	v.marks[off] = v.gen
+	return true
+}
+
+type searchScratch struct {
+	visited    visitedSet
+	candidates distHeap
+	results    distHeap
+	ids        []uint32
+	friends    []uint32 // neighbour list copied out under the node lock
+}
+
 // Return a new HNSW Index Tree
 func NewHNSWIndex(arena *VectorArena) *HNSWIndex {
 	return &HNSWIndex{
-		Nodes:      make(map[string]*HNSWNode),
-		MaxLayer:   -1,
-		Arena:      arena,
-		Tombstones: make(map[string]bool),
+		MaxLayer: -1,
+		Arena:    arena,
+		nodes:    newNodeTable(),
+		layer0:   newAdjacencySlab(MNSW_M0),
+		upper:    newAdjacencySlab(HNSW_M),
+		scratch:  sync.Pool{New: func() any { return new(searchScratch) }},
 	}
 }
 
@@ -56,42 +223,77 @@ func (h *HNSWIndex) randomLevel() int {
 }
 
 // Euclidean Distance (Squared) - Faster than Cosine for HNSW usually
-// TODO: Use SIMD for pure math performance
 func dist(v1, v2 []float32) float32 {
-	var sum float32
-	for i := range v1 {
-		diff := v1[i] - v2[i]
-		sum += diff * diff
+	return l2Float32(v1, v2)
+}
+
+// list locates the neighbour list of a node on a layer
+func (h *HNSWIndex) list(id uint32, layer int) (*adjacencySlab, uint32) {
+	if layer == 0 {
+		return h.layer0, id
 	}
-	return sum
+	return h.upper, h.nodes.get(id).upper + uint32(layer-1)
+}
+
+// neighbors copies the neighbour list of a node into buf under the node lock
+func (h *HNSWIndex) neighbors(id uint32, layer int, buf []uint32) []uint32 {
+	node := h.nodes.get(id)
+	slab, list := h.list(id, layer)
+	node.mu.Lock()
+	buf = append(buf[:0], slab.neighbors(list)...)
+	node.mu.Unlock()
+	return buf
+}
+
+// entry returns the current entry point and top layer
+func (h *HNSWIndex) entry() (uint32, int) {
+	h.entryMu.RLock()
+	defer h.entryMu.RUnlock()
+	return h.Entry, h.MaxLayer
+}
+
+// addNode reserves the node and its neighbour lists. The node is not reachable
+// until it is linked, so its fields can be set without the node lock.
+func (h *HNSWIndex) addNode(idx uint32, level int) *hnswNode {
+	node := h.nodes.ensure(idx)
+	node.level = int8(level)
+	if level > 0 {
+		node.upper = h.upper.alloc(level)
+	}
+	h.layer0.grow(idx + 1)
+	h.count.Add(1)
+	return node
+}
+
+func (h *HNSWIndex) contains(idx uint32) bool {
+	node := h.nodes.get(idx)
+	return node != nil && node.level >= 0
 }
 
-// searchLayer finds the closest node to query in a specific layer
+func (h *HNSWIndex) isDeleted(idx uint32) bool {
+	return h.nodes.get(idx).deleted.Load()
+}
+
+// searchLayer finds the closest node to the prepared query in a specific layer
 // starting from entry point
-func (h *HNSWIndex) searchLayer(query []float32, entryPoint *HNSWNode, layer int) (*HNSWNode, error) {
-	curr := entryPoint
-	currVector, err := h.Arena.Get(uint32(curr.ArenaOffset))
+func (h *HNSWIndex) searchLayer(query *ArenaDistancer, entry uint32, layer int, scratch *searchScratch) (uint32, error) {
+	curr := entry
+	minDist, err := query.Distance(curr)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	minDist := DistQuantized(Quantize(query), currVector)
 
 	for {
 		changed := false
-		curr.RLock()
-		friends := curr.Connections[layer]
-		curr.RUnlock()
-
-		for _, friendID := range friends {
-			friendNode := h.Nodes[friendID]
-			friendVector, err := h.Arena.Get(uint32(friendNode.ArenaOffset))
+		scratch.friends = h.neighbors(curr, layer, scratch.friends)
+		for _, friend := range scratch.friends {
+			d, err := query.Distance(friend)
 			if err != nil {
-				return nil, err
+				return 0, err
 			}
-			d := DistQuantized(Quantize(query), friendVector)
 			if d < minDist {
 				minDist = d
-				curr = friendNode
+				curr = friend
 				changed = true
 			}
 		}
@@ -104,85 +306,241 @@ func (h *HNSWIndex) searchLayer(query []float32, entryPoint *HNSWNode, layer int
 	return curr, nil
 }
 
-// Add's a new node to the HNSW graph, connecting it to existing nodes based on proximity
-func (h *HNSWIndex) Add(vector []float32, id string, idx uint32) {
-	h.Lock()
-	defer h.Unlock()
+// searchLayerEf explores a layer from entry and keeps the ef closest nodes found.
+// Deleted nodes are walked through but left out of the results when skipDeleted is set.
+// The results are sorted closest first and live in scratch until its next use.
+func (h *HNSWIndex) searchLayerEf(query *ArenaDistancer, entry uint32, ef, layer int, skipDeleted bool, scratch *searchScratch) []nodeDist {
+	// Prevent infinite loops in the graph
+	visited := &scratch.visited
+	visited.reset(h.nodes.size())
+	visited.visit(entry)
+
+	entryDist, _ := query.Distance(entry)
+
+	// 'candidates' are nodes we still need to explore, closest on top.
+	// 'results' are the best ones we've found, furthest on top so it can be evicted.
+	candidates := scratch.candidates[:0]
+	results := scratch.results[:0]
+	candidates.push(nodeDist{id: entry, dist: entryDist}, closer)
+	if !skipDeleted || !h.isDeleted(entry) {
+		results.push(nodeDist{id: entry, dist: entryDist}, further)
+	}
 
-	// If this vector ID already exists in the graph,
+	for len(candidates) > 0 {
+		// Pop the closest node from candidates
+		c := candidates.pop(closer)
+
+		// EARLY STOPPING: If our closest candidate is further away than our worst result,
+		// and we already have enough results, the search space is exhausted!
+		if len(results) >= ef && c.dist > results[0].dist {
+			break
+		}
+
+		scratch.friends = h.neighbors(c.id, layer, scratch.friends)
+		for _, friend := range scratch.friends {
+			if !visited.visit(friend) {
+				continue
+			}
+			fDist, err := query.Distance(friend)
+			if err != nil {
+				continue
+			}
+
+			// Only explore friends that could still improve the results
+			found := nodeDist{id: friend, dist: fDist}
+			if len(results) < ef || closer(found, results[0]) {
+				candidates.push(found, closer)
+				if !skipDeleted || !h.isDeleted(friend) {
+					results.push(found, further)
+					if len(results) > ef {
+						results.pop(further)
+					}
+				}
+			}
+		}
+	}
+	scratch.candidates, scratch.results = candidates, results
+
+	slices.SortFunc(results, byDist)
+	return results
+}
+
+// searchRadius expands a range search from the seeds of an ef-search. It walks
+// layer 0 outwards, closest first, through every node within the radius and
+// stops once limit live nodes are found. Nodes within the radius that are only
+// reachable through nodes outside it are missed, like any graph range search.
+// The results are sorted closest first.
+func (h *HNSWIndex) searchRadius(query *ArenaDistancer, seeds []nodeDist, radius float32, limit int, scratch *searchScratch) []nodeDist {
+	visited := &scratch.visited
+	visited.reset(h.nodes.size())
+
+	// seeds live in scratch.results, the frontier uses scratch.candidates
+	frontier := scratch.candidates[:0]
+	for _, s := range seeds {
+		visited.visit(s.id)
+		if s.dist <= radius {
+			frontier.push(s, closer)
+		}
+	}
+
+	var found []nodeDist
+	for len(frontier) > 0 && len(found) < limit {
+		c := frontier.pop(closer)
+		if !h.isDeleted(c.id) {
+			found = append(found, c)
+		}
+
+		scratch.friends = h.neighbors(c.id, 0, scratch.friends)
+		for _, friend := range scratch.friends {
+			if !visited.visit(friend) {
+				continue
+			}
+			d, err := query.Distance(friend)
+			if err != nil || d > radius {
+				continue
+			}
+			frontier.push(nodeDist{id: friend, dist: d}, closer)
+		}
+	}
+	scratch.candidates = frontier
+
+	slices.SortFunc(found, byDist)
+	return found
+}
+
+// Add's a new node to the HNSW graph, connecting it to its closest nodes on every
+// layer from its level down to 0. Adds of different offsets may run concurrently.
+func (h *HNSWIndex) Add(vector []float32, idx uint32) {
+	h.RLock()
+	defer h.RUnlock()
+
+	// If this offset is already in the graph,
 	// do not insert it again.
-	if _, exists := h.Nodes[id]; exists {
+	if h.contains(idx) {
 		return
 	}
 
 	// Create New Node with random level
 	level := h.randomLevel()
-	newNode := &HNSWNode{
-		ID:          id,
-		Layer:       level,
-		Connections: make([][]string, level+1),
-		ArenaOffset: idx,
-	}
-	h.Nodes[id] = newNode
-
-	// If graph is empty, set this as entry point
-	if h.EntryNodeID == "" {
-		h.EntryNodeID = id
-		h.MaxLayer = level
-		return
+	node := h.addNode(idx, level)
+
+	entry, maxLayer := h.entry()
+	if level > maxLayer {
+		// This node becomes the new entry point. Hold topMu for the whole insert
+		// so the entry only moves to fully linked nodes, one at a time.
+		h.topMu.Lock()
+		defer h.topMu.Unlock()
+		entry, maxLayer = h.entry()
+
+		// If graph is empty, set this as entry point
+		if maxLayer < 0 {
+			h.entryMu.Lock()
+			h.Entry, h.MaxLayer = idx, level
+			h.entryMu.Unlock()
+			return
+		}
 	}
 
-	curr := h.Nodes[h.EntryNodeID]
+	prepared := h.Arena.Distancer(vector)
+	scratch := h.scratch.Get().(*searchScratch)
+	defer h.scratch.Put(scratch)
+
+	curr := entry
 
 	// Zoom Phase: Search down from top layer to the nodes level
 	// We doon't link yet, just find the best starting point
-	for l := h.MaxLayer; l > level; l-- {
-		curr, _ = h.searchLayer(vector, curr, l)
+	for l := maxLayer; l > level; l-- {
+		curr, _ = h.searchLayer(prepared, curr, l, scratch)
 	}
 
-	startLayer := level
-	if h.MaxLayer < level {
-		startLayer = h.MaxLayer
-	}
-
-	// Build Phase: Link neighbours from node's level down to 0
-	for l := startLayer; l >= 0; l-- {
-		// Find the closest neighbor at this layer
-		// TODO: In prod, we'd find 'M' nighbors, here we simplify to 1 for redability
-		bestNeighbor, _ := h.searchLayer(vector, curr, l)
+	// Build Phase: Link the M closest neighbours from node's level down to 0
+	for l := min(level, maxLayer); l >= 0; l-- {
+		found := h.searchLayerEf(prepared, curr, HNSW_EfConstruct, l, false, scratch)
+		if len(found) == 0 {
+			continue
+		}
 
-		// Link them (Bidirectional)
-		newNode.Connections[l] = append(newNode.Connections[l], bestNeighbor.ID)
-		bestNeighbor.Connections[l] = append(bestNeighbor.Connections[l], id)
+		slab, list := h.list(idx, l)
+		ids := scratch.ids[:0]
+		for i := 0; i < len(found) && len(ids) < slab.capacity; i++ {
+			if found[i].id != idx {
+				ids = append(ids, found[i].id)
+			}
+		}
+		node.mu.Lock()
+		slab.set(list, ids)
+		node.mu.Unlock()
 
 		// Move search pointer for next iteration
-		curr = bestNeighbor
+		curr = found[0].id
+
+		// Link them back (Bidirectional)
+		for _, n := range ids {
+			h.link(n, idx, l)
+		}
+		scratch.ids = ids
 	}
 
 	// Update Entry Point if new node is higher
-	if level > h.MaxLayer {
-		h.MaxLayer = level
-		h.EntryNodeID = id
+	if level > maxLayer {
+		h.entryMu.Lock()
+		h.Entry, h.MaxLayer = idx, level
+		h.entryMu.Unlock()
 	}
+}
+
+// link adds idx to the neighbours of n. A full list keeps only its closest
+// nodes, so either the farthest neighbour is dropped or idx is not added.
+func (h *HNSWIndex) link(n, idx uint32, layer int) {
+	node := h.nodes.get(n)
+	slab, list := h.list(n, layer)
 
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if slab.add(list, idx) {
+		return
+	}
+
+	vec, err := h.Arena.Get(n)
+	if err != nil {
+		return
+	}
+	prepared := h.Arena.Distancer(vec)
+
+	current := slab.neighbors(list)
+	cands := make([]nodeDist, 0, len(current)+1)
+	for _, id := range current {
+		d, _ := prepared.Distance(id)
+		cands = append(cands, nodeDist{id: id, dist: d})
+	}
+	d, _ := prepared.Distance(idx)
+	cands = append(cands, nodeDist{id: idx, dist: d})
+	slices.SortFunc(cands, byDist)
+
+	ids := make([]uint32, 0, slab.capacity)
+	for _, c := range cands[:slab.capacity] {
+		ids = append(ids, c.id)
+	}
+	slab.set(list, ids)
 }
 
 // Search finds and returns the k closest nodes to the query vector using the HNSW algorithm.
-func (h *HNSWIndex) Search(query []float32, k int) []VectroRecord {
-	h.RLock()
-	entryID := h.EntryNodeID
-	maxL := h.MaxLayer
-	h.RUnlock()
-
-	if entryID == "" {
+// It takes no index wide lock, neighbour lists are read under their node lock.
+func (h *HNSWIndex) Search(query []float32, k int, opts SearchOptions) []Match {
+	curr, maxLayer := h.entry()
+	if maxLayer < 0 || k <= 0 {
 		return nil
 	}
 
-	curr := h.Nodes[entryID]
+	prepared := h.Arena.Distancer(query)
+
+	// Scratch space is pooled so a search does not allocate per hop
+	scratch := h.scratch.Get().(*searchScratch)
+	defer h.scratch.Put(scratch)
 
 	// ZOOM PHASE: Fast traversal down to Layer 1 (Finds a great starting point)
-	for l := maxL; l > 0; l-- {
-		curr, _ = h.searchLayer(query, curr, l)
+	for l := maxLayer; l > 0; l-- {
+		curr, _ = h.searchLayer(prepared, curr, l, scratch)
 	}
 
 	// BUILD THE NET: Layer 0 Top-K Search
@@ -192,97 +550,222 @@ func (h *HNSWIndex) Search(query []float32, k int) []VectroRecord {
 	if ef < 10 {
 		ef = 10
 	}
+	if opts.Ef > ef {
+		ef = opts.Ef
+	}
+	var results []nodeDist
+	if opts.Radius > 0 {
+		// The seeds only need to land inside the radius, the expansion does the rest.
+		// Deleted nodes may be the only bridge into it, so they are kept as seeds.
+		seeds := h.searchLayerEf(prepared, curr, min(ef, HNSW_EfConstruct), 0, false, scratch)
+		results = h.searchRadius(prepared, seeds, opts.Radius, k, scratch)
+	} else {
+		results = h.searchLayerEf(prepared, curr, ef, 0, true, scratch)
+	}
 
-	// Prevent infinite loops in the graph
-	visited := make(map[string]bool)
-	visited[curr.ID] = true
+	// FORMAT THE OUTPUT
+	// Trim down to exactly K items if we gathered more
+	if len(results) > k {
+		results = results[:k]
+	}
 
-	currVec, _ := h.Arena.Get(curr.ArenaOffset)
-	currDist := DistQuantized(Quantize(query), currVec)
+	output := make([]Match, 0, len(results))
+	for _, r := range results {
+		if !opts.within(r.dist) {
+			continue // below the score threshold
+		}
+		output = append(output, Match{
+			Index: r.id,
+			Score: 1 - r.dist, // Assuming your dist() is Euclidean/Cosine converted to a similarity score
+		})
+	}
 
-	// 'candidates' are nodes we still need to explore. 'results' are the best ones we've found.
-	candidates := []nodeDist{{node: curr, dist: currDist}}
-	results := []nodeDist{{node: curr, dist: currDist}}
+	return output
+}
 
-	for len(candidates) > 0 {
-		// Pop the closest node from candidates
-		c := candidates[0]
-		candidates = candidates[1:]
+// hnswTraversal is a layer 0 search that can be resumed with a larger ef. It
+// keeps its candidate heap between rounds, along with the live nodes pushed out
+// of the results and the nodes left unexpanded because they were too far for
+// the last ef, so a later round carries on the walk instead of redoing it.
+type hnswTraversal struct {
+	h       *HNSWIndex
+	query   *ArenaDistancer
+	visited visitedSet
+	friends []uint32
+
+	candidates distHeap // still to expand, closest on top
+	results    distHeap // the ef closest live nodes, furthest on top
+	evicted    distHeap // live nodes pushed out of results, closest on top
+	deferred   distHeap // nodes too far for the last ef, closest on top
+}
 
-		// What is the worst result we currently consider "good"?
-		furthestResultDist := results[len(results)-1].dist
+// traverse descends the upper layers to the layer 0 entry point of a query
+func (h *HNSWIndex) traverse(query []float32) *hnswTraversal {
+	t := &hnswTraversal{h: h, query: h.Arena.Distancer(query)}
+	curr, maxLayer := h.entry()
+	if maxLayer < 0 {
+		return t
+	}
 
-		// EARLY STOPPING: If our closest candidate is further away than our worst result,
-		// and we already have enough results, the search space is exhausted!
-		if c.dist > furthestResultDist && len(results) >= k {
+	scratch := h.scratch.Get().(*searchScratch)
+	for l := maxLayer; l > 0; l-- {
+		curr, _ = h.searchLayer(t.query, curr, l, scratch)
+	}
+	h.scratch.Put(scratch)
+
+	t.visited.reset(h.nodes.size())
+	t.visited.visit(curr)
+	d, _ := t.query.Distance(curr)
+	t.admit(nodeDist{id: curr, dist: d}, 1)
+	return t
+}
+
+// admit queues a node for expansion and adds it to the results when it is live
+func (t *hnswTraversal) admit(n nodeDist, ef int) {
+	t.candidates.push(n, closer)
+	if t.h.isDeleted(n.id) {
+		return
+	}
+	t.results.push(n, further)
+	if len(t.results) > ef {
+		t.evicted.push(t.results.pop(further), closer)
+	}
+}
+
+// search continues the walk until the ef closest nodes it can reach are found,
+// ef being k raised to opts.Ef and at least 10 like Search, and returns the k
+// closest within the score threshold
+func (t *hnswTraversal) search(k int, opts SearchOptions) []Match {
+	if k <= 0 {
+		return nil
+	}
+	ef := max(k, 10, opts.Ef)
+
+	// What the last round left out comes back first
+	for len(t.results) < ef && len(t.evicted) > 0 {
+		t.results.push(t.evicted.pop(closer), further)
+	}
+	for len(t.deferred) > 0 && (len(t.results) < ef || closer(t.deferred[0], t.results[0])) {
+		t.admit(t.deferred.pop(closer), ef)
+	}
+
+	for len(t.candidates) > 0 {
+		// The closest candidate stays queued when it stops this round
+		if c := t.candidates[0]; len(t.results) >= ef && c.dist > t.results[0].dist {
 			break
 		}
+		c := t.candidates.pop(closer)
 
-		c.node.RLock()
-		// Get all friends at Layer 0
-		friends := c.node.Connections[0]
-		c.node.RUnlock()
-
-		for _, friendID := range friends {
-			if !visited[h.Nodes[friendID].ID] {
-				visited[h.Nodes[friendID].ID] = true
-
-				fVec, _ := h.Arena.Get(h.Nodes[friendID].ArenaOffset)
-				fDist := DistQuantized(Quantize(query), fVec)
-
-				h.RLock()
-				isDeleted := h.Tombstones[friendID]
-				h.RUnlock()
-
-				candidates = append(candidates, nodeDist{node: h.Nodes[friendID], dist: fDist})
-				// Sort candidates ascending (closest first)
-				sort.Slice(candidates, func(i, j int) bool {
-					return candidates[i].dist < candidates[j].dist
-				})
-
-				if !isDeleted {
-					// If this friend is better than our worst result, or we don't have enough results yet
-					if fDist < furthestResultDist || len(results) < k {
-						results = append(results, nodeDist{node: h.Nodes[friendID], dist: fDist})
-						// Sort results ascending and trim to our exploration factor (ef)
-						sort.Slice(results, func(i, j int) bool {
-							return results[i].dist < results[j].dist
-						})
-						if len(results) > ef {
-							results = results[:ef]
-						}
-					}
-				}
+		t.friends = t.h.neighbors(c.id, 0, t.friends)
+		for _, friend := range t.friends {
+			if !t.visited.visit(friend) {
+				continue
+			}
+			d, err := t.query.Distance(friend)
+			if err != nil {
+				continue
+			}
+			found := nodeDist{id: friend, dist: d}
+			if len(t.results) < ef || closer(found, t.results[0]) {
+				t.admit(found, ef)
+			} else {
+				t.deferred.push(found, closer)
 			}
 		}
 	}
 
-	// FORMAT THE OUTPUT
-	// Trim down to exactly K items if we gathered more
-	if len(results) > k {
-		results = results[:k]
+	results := slices.Clone(t.results)
+	slices.SortFunc(results, byDist)
+	output := make([]Match, 0, min(k, len(results)))
+	for _, r := range results[:min(k, len(results))] {
+		if opts.within(r.dist) {
+			output = append(output, Match{Index: r.id, Score: 1 - r.dist})
+		}
 	}
+	return output
+}
 
-	var output []VectroRecord
-	for _, r := range results {
-		output = append(output, VectroRecord{
-			ID:    r.node.ID,
-			Score: 1 - r.dist, // Assuming your dist() is Euclidean/Cosine converted to a similarity score
-			Data:  json.RawMessage(`{}`),
-		})
+// Delete marks a node as deleted using a tombstone. Thne actual node remains intact to preserve structure
+// but is ignored in search results. An offset can be tombstoned before its Add has run.
+func (h *HNSWIndex) Delete(idx uint32) error {
+	if h.nodes.ensure(idx).deleted.CompareAndSwap(false, true) {
+		h.deleted.Add(1)
 	}
+	return nil
+}
 
-	return output
+type hnswState struct {
+	Entry     uint32
+	MaxLayer  int
+	Levels    []int8       // by arena offset, -1 when not in the graph
+	Neighbors [][][]uint32 // [offset][layer] neighbour offsets
+	Deleted   []uint32
 }
 
-// Delete marks a node as deleted using a tombstone. Thne actual node remains intact to preserve structure
-// but is ignored in search results.
-func (h *HNSWIndex) Delete(id string) error {
+func (h *HNSWIndex) Stats() IndexStats {
+	_, maxLayer := h.entry()
+	return IndexStats{
+		Type:     IndexHNSW,
+		Vectors:  int(h.count.Load()),
+		Deleted:  int(h.deleted.Load()),
+		MaxLayer: maxLayer,
+	}
+}
+
+// Serialize writes the graph layers and tombstones. It waits for running inserts.
+func (h *HNSWIndex) Serialize(w io.Writer) error {
 	h.Lock()
 	defer h.Unlock()
 
-	if _, exists := h.Nodes[id]; exists {
-		h.Tombstones[id] = true
+	size := h.nodes.size()
+	state := hnswState{
+		Entry:     h.Entry,
+		MaxLayer:  h.MaxLayer,
+		Levels:    make([]int8, size),
+		Neighbors: make([][][]uint32, size),
+	}
+	for i := 0; i < size; i++ {
+		node := h.nodes.get(uint32(i))
+		state.Levels[i] = node.level
+		if node.deleted.Load() {
+			state.Deleted = append(state.Deleted, uint32(i))
+		}
+		for l := 0; l <= int(node.level); l++ {
+			state.Neighbors[i] = append(state.Neighbors[i], h.neighbors(uint32(i), l, nil))
+		}
+	}
+	// Trim the unused tail of the last page
+	for len(state.Levels) > 0 && state.Levels[len(state.Levels)-1] < 0 {
+		state.Levels = state.Levels[:len(state.Levels)-1]
+	}
+	state.Neighbors = state.Neighbors[:len(state.Levels)]
+	return encodeIndex(w, IndexHNSW, state)
+}
+
+func (h *HNSWIndex) load(dec *gob.Decoder) error {
+	var state hnswState
+	if err := dec.Decode(&state); err != nil {
+		return err
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	h.entryMu.Lock()
+	h.Entry = state.Entry
+	h.MaxLayer = state.MaxLayer
+	h.entryMu.Unlock()
+	for i, level := range state.Levels {
+		if level < 0 {
+			continue
+		}
+		h.addNode(uint32(i), int(level))
+		for l, ids := range state.Neighbors[i] {
+			slab, list := h.list(uint32(i), l)
+			slab.set(list, ids)
+		}
+	}
+	for _, idx := range state.Deleted {
+		h.Delete(idx)
 	}
 	return nil
 }
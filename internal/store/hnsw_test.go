@@ -0,0 +1,190 @@
+package store
+
+import (
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const stressDim = 32
+
+func stressVector(rng *rand.Rand) []float32 {
+	v := make([]float32, stressDim)
+	for i := range v {
+		v[i] = rng.Float32()*2 - 1
+	}
+	return v
+}
+
+// stressItems keeps the race detector runs short with -short
+func stressItems(t *testing.T) int {
+	if testing.Short() {
+		return 200
+	}
+	return 800
+}
+
+// TestHNSWConcurrentAddSearchDelete links nodes from several goroutines while
+// others search and tombstone, run it with -race
+func TestHNSWConcurrentAddSearchDelete(t *testing.T) {
+	const writers, readers = 8, 4
+	items := stressItems(t)
+
+	arena := NewVectorArena(stressDim)
+	h := NewHNSWIndex(arena)
+
+	var added sync.Map // arena offset -> vector
+	var deleted sync.Map
+	var done atomic.Bool
+	var searches atomic.Int64
+
+	var wgRead sync.WaitGroup
+	for r := 0; r < readers; r++ {
+		wgRead.Add(1)
+		go func(seed int64) {
+			defer wgRead.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for !done.Load() {
+				for _, m := range h.Search(stressVector(rng), 10, SearchOptions{}) {
+					if _, ok := added.Load(m.Index); !ok {
+						t.Errorf("search returned offset %d that was never added", m.Index)
+						return
+					}
+				}
+				searches.Add(1)
+			}
+		}(int64(r))
+	}
+
+	var wgWrite sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wgWrite.Add(1)
+		go func(seed int64) {
+			defer wgWrite.Done()
+			rng := rand.New(rand.NewSource(100 + seed))
+			var mine []uint32
+			for i := 0; i < items/writers; i++ {
+				vec := stressVector(rng)
+				idx, err := arena.Add(vec)
+				if err != nil {
+					t.Errorf("arena add: %v", err)
+					return
+				}
+				added.Store(idx, vec)
+				h.Add(vec, idx)
+				mine = append(mine, idx)
+				// Tombstone some of this writer's own nodes
+				if i%50 == 20 {
+					victim := mine[i-15]
+					deleted.Store(victim, true)
+					h.Delete(victim)
+				}
+			}
+		}(int64(w))
+	}
+	wgWrite.Wait()
+	done.Store(true)
+	wgRead.Wait()
+	if t.Failed() {
+		return
+	}
+
+	stats := h.Stats()
+	var live, found int
+	added.Range(func(k, v any) bool {
+		if _, gone := deleted.Load(k); gone {
+			return true
+		}
+		live++
+		matches := h.Search(v.([]float32), 1, SearchOptions{})
+		if len(matches) > 0 && matches[0].Index == k.(uint32) {
+			found++
+		}
+		return true
+	})
+	for _, m := range h.Search(make([]float32, stressDim), items, SearchOptions{}) {
+		if _, gone := deleted.Load(m.Index); gone {
+			t.Fatalf("search returned deleted offset %d", m.Index)
+		}
+	}
+	// Every node linked concurrently must stay reachable
+	if recall := float64(found) / float64(live); recall < 0.95 {
+		t.Fatalf("self recall %.3f after concurrent inserts, want >= 0.95 (%+v)", recall, stats)
+	}
+	t.Logf("%d searches during inserts, %+v", searches.Load(), stats)
+}
+
+// TestHNSWTraversalResumes grows k on one traversal like a grouped search
+// does, every round must find the k closest live nodes about as well as a
+// fresh search with that k
+func TestHNSWTraversalResumes(t *testing.T) {
+	const n = 3000
+	arena := NewVectorArena(stressDim)
+	h := NewHNSWIndex(arena)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < n; i++ {
+		vec := stressVector(rng)
+		idx, err := arena.Add(vec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Add(vec, idx)
+	}
+	for i := uint32(0); i < n; i += 7 {
+		h.Delete(i)
+	}
+
+	recall := func(got []Match, want []uint32) float64 {
+		hits := 0
+		for _, m := range got {
+			if slices.Contains(want, m.Index) {
+				hits++
+			}
+		}
+		return float64(hits) / float64(len(want))
+	}
+
+	const queries = 20
+	ks := []int{10, 40, 160, 640}
+	resumed, fresh := make([]float64, len(ks)), make([]float64, len(ks))
+	for q := 0; q < queries; q++ {
+		query := stressVector(rng)
+		prepared := arena.Distancer(query)
+		var exact []nodeDist
+		for i := uint32(0); i < n; i++ {
+			if i%7 == 0 {
+				continue
+			}
+			d, _ := prepared.Distance(i)
+			exact = append(exact, nodeDist{id: i, dist: d})
+		}
+		slices.SortFunc(exact, byDist)
+
+		trav := h.traverse(query)
+		for r, k := range ks {
+			want := make([]uint32, k)
+			for i := range want {
+				want[i] = exact[i].id
+			}
+			got := trav.search(k, SearchOptions{})
+			if len(got) != k {
+				t.Fatalf("query %d: round k=%d returned %d matches", q, k, len(got))
+			}
+			for _, m := range got {
+				if m.Index%7 == 0 {
+					t.Fatalf("query %d: deleted offset %d returned", q, m.Index)
+				}
+			}
+			resumed[r] += recall(got, want) / queries
+			fresh[r] += recall(h.Search(query, k, SearchOptions{}), want) / queries
+		}
+	}
+	for r, k := range ks {
+		t.Logf("k=%d: recall %.3f resumed, %.3f fresh", k, resumed[r], fresh[r])
+		if resumed[r] < 0.8 || resumed[r] < fresh[r]-0.02 {
+			t.Errorf("k=%d: resumed recall %.3f, fresh %.3f", k, resumed[r], fresh[r])
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FusionType selects how hybrid search combines the keyword, sparse and vector rankings
+type FusionType string
+
+const (
+	// FusionRRF scores a record by reciprocal rank fusion, sum of 1 / (RRFK + rank)
+	FusionRRF FusionType = "rrf"
+	// FusionWeighted min-max normalizes the scores of each search and adds them,
+	// the vector score weighted by Alpha while the BM25 and sparse scores share
+	// the remaining 1 - Alpha
+	FusionWeighted FusionType = "weighted"
+)
+
+func ParseFusionType(s string) (FusionType, error) {
+	switch t := FusionType(s); t {
+	case FusionRRF, "":
+		return FusionRRF, nil
+	case FusionWeighted:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown fusion %q", s)
+	}
+}
+
+// HybridOptions tunes a hybrid search
+type HybridOptions struct {
+	Fusion     FusionType
+	Alpha      float32 // weighted: share of the vector score
+	RRFK       int     // rrf: rank offset, 60 when zero
+	Candidates int     // results taken from each search before fusing, at least k
+}
+
+// HybridQuery holds the parts of a hybrid search, any of them may be left empty
+type HybridQuery struct {
+	Vector []float32
+	Text   string
+	Sparse *SparseVector
+}
+
+// HybridRankings holds the unfused results of each part of a hybrid search,
+// best first. Parts the query does not set are empty.
+type HybridRankings struct {
+	Keyword []VectroRecord
+	Sparse  []VectroRecord
+	Vector  []VectroRecord
+}
+
+// HybridRankings runs a BM25 search over the text fields, a sparse dot product
+// search and a vector search for the parts of the query that are set, each for
+// fetch results, and returns them unfused. Fusing is left to the caller, so the
+// rankings of several shards can be merged first. Collections without
+// TextFields have no keyword results.
+func (db *VectraDB) HybridRankings(query HybridQuery, fetch int, opts SearchOptions) HybridRankings {
+	var sparse SparseVector
+	if query.Sparse != nil {
+		var err error
+		if sparse, err = query.Sparse.Normalize(); err != nil {
+			return HybridRankings{}
+		}
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var r HybridRankings
+	if query.Text != "" && db.text != nil {
+		r.Keyword = db.records(db.text.Search(query.Text, fetch))
+	}
+	if len(sparse.Indices) > 0 {
+		r.Sparse = db.records(db.sparse.Search(sparse, fetch))
+	}
+	if len(query.Vector) > 0 {
+		r.Vector = db.search(query.Vector, fetch, opts)
+	}
+	return r
+}
+
+// fuse combines the rankings into one, scored by the fused score
+func (r HybridRankings) fuse(hybrid HybridOptions) []VectroRecord {
+	switch hybrid.Fusion {
+	case FusionWeighted:
+		return fuseWeighted(r.Vector, hybrid.Alpha, r.Keyword, r.Sparse)
+	default:
+		return fuseRRF(hybrid.RRFK, r.Keyword, r.Sparse, r.Vector)
+	}
+}
+
+// fuseRRF combines rankings by reciprocal rank fusion
+func fuseRRF(k int, rankings ...[]VectroRecord) []VectroRecord {
+	if k <= 0 {
+		k = 60
+	}
+
+	scores := make(map[string]float32)
+	var out []VectroRecord
+	for _, ranking := range rankings {
+		for rank, rec := range ranking {
+			if _, exists := scores[rec.ID]; !exists {
+				out = append(out, rec)
+			}
+			scores[rec.ID] += 1 / float32(k+rank+1)
+		}
+	}
+	for i := range out {
+		out[i].Score = scores[out[i].ID]
+	}
+	sortRecords(out)
+	return out
+}
+
+// fuseWeighted adds min-max normalized scores, alpha weighs the vector ranking
+// and the other non-empty rankings split 1 - alpha evenly
+func fuseWeighted(vector []VectroRecord, alpha float32, others ...[]VectroRecord) []VectroRecord {
+	type weighted struct {
+		records []VectroRecord
+		weight  float32
+	}
+	rankings := []weighted{{vector, alpha}}
+	present := 0
+	for _, o := range others {
+		if len(o) > 0 {
+			present++
+		}
+	}
+	for _, o := range others {
+		if len(o) > 0 {
+			rankings = append(rankings, weighted{o, (1 - alpha) / float32(present)})
+		}
+	}
+
+	scores := make(map[string]float32)
+	var out []VectroRecord
+	for _, r := range rankings {
+		if len(r.records) == 0 {
+			continue
+		}
+		lo, hi := r.records[0].Score, r.records[0].Score
+		for _, rec := range r.records {
+			lo, hi = min(lo, rec.Score), max(hi, rec.Score)
+		}
+		for _, rec := range r.records {
+			norm := float32(1)
+			if hi > lo {
+				norm = (rec.Score - lo) / (hi - lo)
+			}
+			if _, exists := scores[rec.ID]; !exists {
+				out = append(out, rec)
+			}
+			scores[rec.ID] += r.weight * norm
+		}
+	}
+	for i := range out {
+		out[i].Score = scores[out[i].ID]
+	}
+	sortRecords(out)
+	return out
+}
+
+// SearchHybrid runs a hybrid search across the cluster. Every shard returns its
+// keyword, sparse and vector rankings unfused, these are merged across shards
+// into one ranking of each kind and fused once, so ranks and normalized scores
+// are those of the whole collection rather than of each shard. A query with only
+// one part is a plain search of that kind. Scores are the fused scores.
+func (c *Cluster) SearchHybrid(query HybridQuery, topK int, opts SearchOptions, hybrid HybridOptions) []VectroRecord {
+	fetch := max(hybrid.Candidates, topK)
+
+	var wg sync.WaitGroup
+	perShard := make([]HybridRankings, c.numShards)
+	for i, shard := range c.shards {
+		wg.Add(1)
+		go func(i int, s ShardHandler) {
+			defer wg.Done()
+			perShard[i] = s.HybridRankings(query, fetch, opts)
+		}(i, shard)
+	}
+	wg.Wait()
+
+	var merged HybridRankings
+	for _, r := range perShard {
+		merged.Keyword = append(merged.Keyword, r.Keyword...)
+		merged.Sparse = append(merged.Sparse, r.Sparse...)
+		merged.Vector = append(merged.Vector, r.Vector...)
+	}
+	for _, ranking := range []*[]VectroRecord{&merged.Keyword, &merged.Sparse, &merged.Vector} {
+		sortRecords(*ranking)
+		if len(*ranking) > fetch {
+			*ranking = (*ranking)[:fetch]
+		}
+	}
+
+	fused := merged.fuse(hybrid)
+	if len(fused) > topK {
+		fused = fused[:topK]
+	}
+	return fused
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// TestSearchHybridFusesAcrossShards splits a collection over two shards, the
+// fused results must match those of the whole collection on one shard
+func TestSearchHybridFusesAcrossShards(t *testing.T) {
+	collection := DefaultCollectionConfig()
+	collection.Index = IndexFlat
+	collection.Quantization = QuantizationNone
+
+	open := func() *VectraDB {
+		db, err := NewVectraDBWithConfig(8, t.TempDir(), collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	whole, a, b := open(), open(), open()
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		vec := make([]float32, 8)
+		for j := range vec {
+			vec[j] = rng.Float32()
+		}
+		sparse := &SparseVector{
+			Indices: []uint32{uint32(rng.Intn(20)), uint32(20 + rng.Intn(20))},
+			Values:  []float32{rng.Float32(), rng.Float32()},
+		}
+		id := fmt.Sprintf("doc-%d", i)
+		shard := b
+		if i%3 == 0 {
+			shard = a
+		}
+		for _, db := range []*VectraDB{whole, shard} {
+			if err := db.InsertWithSparse(id, vec, sparse, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	single := NewCluster([]ShardHandler{whole})
+	sharded := NewCluster([]ShardHandler{a, b})
+	query := HybridQuery{
+		Vector: []float32{.5, .5, .5, .5, .5, .5, .5, .5},
+		Sparse: &SparseVector{Indices: []uint32{3, 25}, Values: []float32{1, 1}},
+	}
+	for _, fusion := range []FusionType{FusionRRF, FusionWeighted} {
+		hybrid := HybridOptions{Fusion: fusion, Alpha: 0.5, Candidates: 40}
+		want := single.SearchHybrid(query, 10, SearchOptions{}, hybrid)
+		got := sharded.SearchHybrid(query, 10, SearchOptions{}, hybrid)
+		if len(want) != 10 || !slices.EqualFunc(got, want, func(x, y VectroRecord) bool { return x.ID == y.ID && x.Score == y.Score }) {
+			t.Fatalf("%s: sharded %v, single shard %v", fusion, got, want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// IndexType selects the ANN structure a collection is searched with
+type IndexType string
+
+const (
+	IndexHNSW IndexType = "hnsw"
+	IndexIVF  IndexType = "ivf"
+	IndexFlat IndexType = "flat"
+
+	// IndexVamana keeps full vectors and the graph on disk, pair it with PQ
+	// quantization so only the codes stay in memory
+	IndexVamana IndexType = "vamana"
+)
+
+// Index is implemented by every search structure a VectraDB can be built with.
+// Vectors live in the shared VectorArena, indexes only reference them by offset
+// and VectraDB maps the offsets back to record ids.
+type Index interface {
+	Add(vector []float32, idx uint32)
+	// Search returns the k best matches ordered from highest to lowest score
+	Search(query []float32, k int, opts SearchOptions) []Match
+	Delete(idx uint32) error
+	Stats() IndexStats
+	// Serialize writes the index structure (not the vectors) so it can be
+	// rebuilt with LoadIndex on top of the same arena.
+	Serialize(w io.Writer) error
+}
+
+// IndexStats summarizes an index, fields that do not apply to a type are zero
+type IndexStats struct {
+	Type     IndexType
+	Vectors  int // vectors added, including deleted ones
+	Deleted  int
+	MaxLayer int  // HNSW
+	Lists    int  // IVF posting lists
+	Trained  bool // IVF
+}
+
+// SearchOptions carries per-query tuning knobs down to the index.
+// Zero values fall back to the collection defaults.
+type SearchOptions struct {
+	NProbe     int // IVF: number of clusters to scan
+	Oversample int // re-rank: candidates fetched per requested result
+	Ef         int // HNSW and Vamana: candidate list size, raised to k when smaller
+
+	// Radius switches to range search: every match within this squared euclidean
+	// distance (score >= 1 - Radius) is returned, best first, and k only caps how
+	// many. Zero keeps the plain top k search.
+	Radius float32
+
+	// MinScore drops matches scoring below it before they leave the shard,
+	// nil keeps every match. A max distance d is the same as a min score 1 - d.
+	MinScore *float32
+}
+
+// within reports whether a distance passes the radius of a range search and
+// the score threshold
+func (o SearchOptions) within(d float32) bool {
+	if o.MinScore != nil && 1-d < *o.MinScore {
+		return false
+	}
+	return o.Radius <= 0 || d <= o.Radius
+}
+
+// CollectionConfig holds the per-collection choices made at creation time
+type CollectionConfig struct {
+	Index        IndexType
+	IVF          IVFConfig
+	Quantization QuantizationType
+	PQ           PQConfig
+	Vamana       VamanaConfig
+
+	// Rerank keeps the original float32 vectors in a secondary arena and rescores
+	// the top k*Oversample quantized candidates against them. It has no effect
+	// when Quantization is none and is always on for binary. Flat collections
+	// keep the float32 vectors anyway and scan them instead of the codes.
+	Rerank     bool
+	Oversample int
+
+	// TextFields are the metadata fields indexed for keyword and hybrid search,
+	// none when empty
+	TextFields []string
+}
+
+func DefaultCollectionConfig() CollectionConfig {
+	return CollectionConfig{
+		Index:        IndexHNSW,
+		IVF:          DefaultIVFConfig(),
+		Quantization: QuantizationInt8,
+		PQ:           DefaultPQConfig(),
+		Vamana:       DefaultVamanaConfig(),
+		Oversample:   4,
+	}
+}
+
+func ParseIndexType(s string) (IndexType, error) {
+	switch t := IndexType(s); t {
+	case IndexHNSW, IndexIVF, IndexFlat, IndexVamana:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown index type %q", s)
+	}
+}
+
+// newIndex builds the index selected by the config on top of the arena
+func newIndex(cfg CollectionConfig, arena *VectorArena) (Index, error) {
+	switch cfg.Index {
+	case IndexHNSW, "":
+		return NewHNSWIndex(arena), nil
+	case IndexIVF:
+		return NewIVFIndex(arena, cfg.IVF), nil
+	case IndexFlat:
+		return NewFlatIndex(arena), nil
+	case IndexVamana:
+		return NewVamanaIndex(arena, cfg.Vamana)
+	default:
+		return nil, fmt.Errorf("unknown index type %q", cfg.Index)
+	}
+}
+
+// LoadIndex rebuilds an index written by Index.Serialize. The arena must hold
+// the same vectors at the same offsets as when the index was serialized.
+func LoadIndex(r io.Reader, cfg CollectionConfig, arena *VectorArena) (Index, error) {
+	dec := gob.NewDecoder(r)
+
+	var t IndexType
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("failed to read index header: %w", err)
+	}
+	cfg.Index = t
+
+	index, err := newIndex(cfg, arena)
+	if err != nil {
+		return nil, err
+	}
+	loader, ok := index.(interface{ load(*gob.Decoder) error })
+	if !ok {
+		return nil, fmt.Errorf("%s index cannot be loaded", t)
+	}
+	if err := loader.load(dec); err != nil {
+		if c, ok := index.(io.Closer); ok {
+			c.Close()
+		}
+		return nil, fmt.Errorf("failed to load %s index: %w", t, err)
+	}
+	return index, nil
+}
+
+// encodeIndex writes the type header followed by the index specific state
+func encodeIndex(w io.Writer, t IndexType, state any) error {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(t); err != nil {
+		return err
+	}
+	return enc.Encode(state)
+}
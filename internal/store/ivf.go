@@ -0,0 +1,336 @@
+package store
+
+import (
+	"cmp"
+	"encoding/gob"
+	"io"
+	"math/rand"
+	"slices"
+	"sync"
+)
+
+// IVFConfig tunes the inverted file index
+type IVFConfig struct {
+	NList      int // number of clusters (posting lists)
+	NProbe     int // clusters scanned per query when the request does not set one
+	TrainSize  int // vectors collected before the index trains itself
+	SampleSize int // max vectors sampled from the arena for k-means
+	Iterations int // max k-means iterations
+	Seed       int64
+}
+
+func DefaultIVFConfig() IVFConfig {
+	return IVFConfig{
+		NList:      256,
+		NProbe:     8,
+		TrainSize:  10_000,
+		SampleSize: 65_536,
+		Iterations: 20,
+		Seed:       42,
+	}
+}
+
+// IVFIndex is an IVF-Flat index: vectors are bucketed into posting lists by their
+// nearest k-means centroid and a query only scans the nprobe closest lists.
+// Until TrainSize vectors have arrived everything sits in one unclustered list
+// that is scanned exhaustively.
+type IVFIndex struct {
+	mu     sync.RWMutex
+	arena  *VectorArena
+	config IVFConfig
+
+	centroids [][]float32
+	lists     [][]uint32 // arena offsets per centroid
+	untrained []uint32   // arena offsets added before the first training
+
+	all        []uint32 // arena offsets in the lists, in insertion order
+	added      map[uint32]bool
+	tombstones map[uint32]bool // deleted offsets still in the lists, or not added yet
+}
+
+func NewIVFIndex(arena *VectorArena, config IVFConfig) *IVFIndex {
+	return &IVFIndex{
+		arena:      arena,
+		config:     config,
+		added:      make(map[uint32]bool),
+		tombstones: make(map[uint32]bool),
+	}
+}
+
+// Add assigns a vector to the posting list of its closest centroid
+func (ivf *IVFIndex) Add(vector []float32, idx uint32) {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	if ivf.added[idx] {
+		return
+	}
+	ivf.all = append(ivf.all, idx)
+	ivf.added[idx] = true
+
+	if ivf.centroids == nil {
+		ivf.untrained = append(ivf.untrained, idx)
+		if len(ivf.untrained) >= ivf.config.TrainSize {
+			ivf.trainLocked()
+		}
+		return
+	}
+
+	c := nearestCentroid(ivf.centroids, vector)
+	ivf.lists[c] = append(ivf.lists[c], idx)
+}
+
+// Retrain reruns k-means on a fresh sample of the arena and rebuilds every posting list.
+// Useful after the data distribution has drifted away from the original training set.
+func (ivf *IVFIndex) Retrain() error {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+	return ivf.trainLocked()
+}
+
+func (ivf *IVFIndex) trainLocked() error {
+	// Deleted vectors are dropped from the lists here, so their tombstones
+	// can go too. Tombstones of offsets that are not added yet stay.
+	all := ivf.all[:0]
+	for _, off := range ivf.all {
+		if ivf.tombstones[off] {
+			delete(ivf.tombstones, off)
+			continue
+		}
+		all = append(all, off)
+	}
+	ivf.all = all
+	if len(all) == 0 {
+		ivf.centroids, ivf.lists = nil, nil
+		ivf.untrained = nil
+		return nil
+	}
+
+	// Offsets in insertion order so every replica samples the same vectors
+
+	rng := rand.New(rand.NewSource(ivf.config.Seed))
+	sampleIdx := all
+	if ivf.config.SampleSize > 0 && len(all) > ivf.config.SampleSize {
+		sampleIdx = make([]uint32, ivf.config.SampleSize)
+		for i, p := range rng.Perm(len(all))[:ivf.config.SampleSize] {
+			sampleIdx[i] = all[p]
+		}
+	}
+
+	samples := make([][]float32, 0, len(sampleIdx))
+	for _, off := range sampleIdx {
+		vec, err := ivf.arena.Get(off)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, vec)
+	}
+
+	nlist := ivf.config.NList
+	if nlist > len(samples) {
+		nlist = len(samples)
+	}
+	centroids := kmeans(samples, nlist, ivf.config.Iterations, rng)
+
+	lists := make([][]uint32, len(centroids))
+	for _, off := range all {
+		vec, err := ivf.arena.Get(off)
+		if err != nil {
+			return err
+		}
+		c := nearestCentroid(centroids, vec)
+		lists[c] = append(lists[c], off)
+	}
+
+	ivf.centroids = centroids
+	ivf.lists = lists
+	ivf.untrained = nil
+	return nil
+}
+
+// Search scans the nprobe posting lists closest to the query
+func (ivf *IVFIndex) Search(query []float32, k int, opts SearchOptions) []Match {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+
+	if k <= 0 {
+		return nil
+	}
+
+	var candidates [][]uint32
+	if ivf.centroids == nil {
+		candidates = [][]uint32{ivf.untrained}
+	} else {
+		nprobe := opts.NProbe
+		if nprobe <= 0 {
+			nprobe = ivf.config.NProbe
+		}
+		if nprobe > len(ivf.centroids) {
+			nprobe = len(ivf.centroids)
+		}
+
+		order := make([]Match, len(ivf.centroids))
+		for i, c := range ivf.centroids {
+			order[i] = Match{Index: uint32(i), Score: dist(query, c)}
+		}
+		// Closest lists first, equal distances by list number
+		slices.SortFunc(order, func(a, b Match) int {
+			if c := cmp.Compare(a.Score, b.Score); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.Index, b.Index)
+		})
+
+		candidates = make([][]uint32, nprobe)
+		for i := 0; i < nprobe; i++ {
+			candidates[i] = ivf.lists[order[i].Index]
+		}
+	}
+
+	prepared := ivf.arena.Distancer(query)
+	top := make(MinHeap, 0, k)
+	for _, list := range candidates {
+		for _, off := range list {
+			if ivf.tombstones[off] {
+				continue
+			}
+			d, err := prepared.Distance(off)
+			if err != nil || !opts.within(d) {
+				continue
+			}
+			top.PushTopK(Match{Index: off, Score: 1 - d}, k)
+		}
+	}
+
+	return top.Sorted()
+}
+
+// Delete tombstones the vector, it stays in its posting list until the next training
+func (ivf *IVFIndex) Delete(idx uint32) error {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	// The offset may not be added yet when an insert is still in flight
+	ivf.tombstones[idx] = true
+	return nil
+}
+
+// kmeans runs Lloyd's algorithm seeded with k distinct random samples
+func kmeans(samples [][]float32, k, iterations int, rng *rand.Rand) [][]float32 {
+	if k <= 0 || len(samples) == 0 {
+		return nil
+	}
+	dim := len(samples[0])
+
+	centroids := make([][]float32, k)
+	for i, p := range rng.Perm(len(samples))[:k] {
+		centroids[i] = append([]float32(nil), samples[p]...)
+	}
+
+	assign := make([]int, len(samples))
+	for i := range assign {
+		assign[i] = -1
+	}
+	for it := 0; it < iterations; it++ {
+		changed := 0
+		for i, s := range samples {
+			c := nearestCentroid(centroids, s)
+			if c != assign[i] {
+				assign[i] = c
+				changed++
+			}
+		}
+		if changed == 0 {
+			break
+		}
+
+		sums := make([][]float32, k)
+		counts := make([]int, k)
+		for c := range sums {
+			sums[c] = make([]float32, dim)
+		}
+		for i, s := range samples {
+			addToVector(sums[assign[i]], s)
+			counts[assign[i]]++
+		}
+		for c := range centroids {
+			if counts[c] == 0 {
+				// Reseed empty clusters so no posting list is wasted
+				copy(centroids[c], samples[rng.Intn(len(samples))])
+				continue
+			}
+			divVector(sums[c], float32(counts[c]))
+			centroids[c] = sums[c]
+		}
+	}
+	return centroids
+}
+
+func nearestCentroid(centroids [][]float32, vec []float32) int {
+	best, bestDist := 0, dist(vec, centroids[0])
+	for i := 1; i < len(centroids); i++ {
+		if d := dist(vec, centroids[i]); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+type ivfState struct {
+	Centroids  [][]float32
+	Lists      [][]uint32
+	Untrained  []uint32
+	Offsets    []uint32
+	Tombstones []uint32
+}
+
+func (ivf *IVFIndex) Stats() IndexStats {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+
+	return IndexStats{
+		Type:    IndexIVF,
+		Vectors: len(ivf.all),
+		Deleted: len(ivf.tombstones),
+		Lists:   len(ivf.lists),
+		Trained: ivf.centroids != nil,
+	}
+}
+
+// Serialize writes the centroids, posting lists and tombstones
+func (ivf *IVFIndex) Serialize(w io.Writer) error {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+
+	state := ivfState{
+		Centroids: ivf.centroids,
+		Lists:     ivf.lists,
+		Untrained: ivf.untrained,
+		Offsets:   ivf.all,
+	}
+	for off := range ivf.tombstones {
+		state.Tombstones = append(state.Tombstones, off)
+	}
+	return encodeIndex(w, IndexIVF, state)
+}
+
+func (ivf *IVFIndex) load(dec *gob.Decoder) error {
+	var state ivfState
+	if err := dec.Decode(&state); err != nil {
+		return err
+	}
+
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+	ivf.centroids = state.Centroids
+	ivf.lists = state.Lists
+	ivf.untrained = state.Untrained
+	for _, off := range state.Offsets {
+		ivf.all = append(ivf.all, off)
+		ivf.added[off] = true
+	}
+	for _, off := range state.Tombstones {
+		ivf.tombstones[off] = true
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestIVFTrainingDropsDeleted deletes vectors before and after the first
+// training, retraining must drop them and their tombstones
+func TestIVFTrainingDropsDeleted(t *testing.T) {
+	arena := NewVectorArenaWithQuantizer(stressDim, NewFloatQuantizer(stressDim))
+	config := DefaultIVFConfig()
+	config.NList = 8
+	config.TrainSize = 200
+	ivf := NewIVFIndex(arena, config)
+
+	rng := rand.New(rand.NewSource(1))
+	deleted := func(idx uint32) bool { return idx%3 == 0 && (idx < 100 || idx >= 200) }
+	vecs := make([][]float32, 400)
+	live := 0
+	for i := range vecs {
+		vecs[i] = stressVector(rng)
+		idx, err := arena.Add(vecs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ivf.Add(vecs[i], idx)
+		// Every third vector is deleted, some before the first training
+		if deleted(idx) {
+			ivf.Delete(idx)
+		} else {
+			live++
+		}
+	}
+	// Deleted while its insert is still in flight
+	pending, _ := arena.Add(stressVector(rng))
+	ivf.Delete(pending)
+
+	if err := ivf.Retrain(); err != nil {
+		t.Fatal(err)
+	}
+	stats := ivf.Stats()
+	if stats.Vectors != live || stats.Deleted != 1 {
+		t.Fatalf("after retraining %d vectors and %d tombstones, want %d and 1", stats.Vectors, stats.Deleted, live)
+	}
+
+	ivf.Add(vecs[0], pending)
+	for i, vec := range vecs {
+		for _, m := range ivf.Search(vec, 10, SearchOptions{NProbe: config.NList}) {
+			if m.Index == pending || deleted(m.Index) {
+				t.Fatalf("query %d returned deleted offset %d", i, m.Index)
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+)
+
+// Distance kernels. They start out as the pure Go versions below and useSIMD
+// swaps in assembly versions at startup when the CPU supports them.
+var (
+	l2Float32       = l2Float32Go
+	dotFloat32      = dotFloat32Go
+	dotNormsFloat32 = dotNormsFloat32Go
+	dotInt8         = dotInt8Go
+	sqSumInt8       = sqSumInt8Go
+	hammingBytes    = hammingGo
+
+	kernels = "go"
+)
+
+func init() {
+	name := useSIMD()
+	if name == "" {
+		return
+	}
+	// Never trust the assembly blindly, a wrong kernel silently ruins recall
+	if err := checkKernels(); err != nil {
+		useGenericKernels()
+		kernels = fmt.Sprintf("go (%s disabled: %v)", name, err)
+		return
+	}
+	kernels = name
+}
+
+// Kernels names the distance kernels in use, e.g. "avx2" or "neon"
+func Kernels() string {
+	return kernels
+}
+
+func useGenericKernels() {
+	l2Float32 = l2Float32Go
+	dotFloat32 = dotFloat32Go
+	dotNormsFloat32 = dotNormsFloat32Go
+	dotInt8 = dotInt8Go
+	sqSumInt8 = sqSumInt8Go
+	hammingBytes = hammingGo
+}
+
+// checkKernels compares the active kernels with the Go ones on random input of
+// awkward lengths, so block and tail handling both get exercised
+func checkKernels() error {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 3, 7, 8, 15, 16, 17, 31, 32, 33, 63, 64, 65, 100, 128, 384, 768, 1000} {
+		fa, fb := make([]float32, n), make([]float32, n)
+		ia, ib := make([]int8, n), make([]int8, n)
+		ba, bb := make([]byte, n), make([]byte, n)
+		for i := 0; i < n; i++ {
+			fa[i], fb[i] = float32(rng.NormFloat64()), float32(rng.NormFloat64())
+			ia[i], ib[i] = int8(rng.Intn(256)-128), int8(rng.Intn(256)-128)
+			ba[i], bb[i] = byte(rng.Intn(256)), byte(rng.Intn(256))
+		}
+		// Extremes are where int8 kernels overflow
+		if n > 0 {
+			ia[0], ib[0] = -128, -128
+		}
+
+		if got, want := l2Float32(fa, fb), l2Float32Go(fa, fb); !closeEnough(got, want) {
+			return fmt.Errorf("l2 float32 n=%d got %v want %v", n, got, want)
+		}
+		if got, want := dotFloat32(fa, fb), dotFloat32Go(fa, fb); !closeEnough(got, want) {
+			return fmt.Errorf("dot float32 n=%d got %v want %v", n, got, want)
+		}
+		d, na, nb := dotNormsFloat32(fa, fb)
+		wd, wna, wnb := dotNormsFloat32Go(fa, fb)
+		if !closeEnough(d, wd) || !closeEnough(na, wna) || !closeEnough(nb, wnb) {
+			return fmt.Errorf("dot/norms float32 n=%d got %v %v %v want %v %v %v", n, d, na, nb, wd, wna, wnb)
+		}
+		if got, want := dotInt8(ia, ib), dotInt8Go(ia, ib); got != want {
+			return fmt.Errorf("dot int8 n=%d got %d want %d", n, got, want)
+		}
+		sq, sum := sqSumInt8(ia)
+		wsq, wsum := sqSumInt8Go(ia)
+		if sq != wsq || sum != wsum {
+			return fmt.Errorf("sq/sum int8 n=%d got %d %d want %d %d", n, sq, sum, wsq, wsum)
+		}
+		if got, want := hammingBytes(ba, bb), hammingGo(ba, bb); got != want {
+			return fmt.Errorf("hamming n=%d got %d want %d", n, got, want)
+		}
+	}
+	return nil
+}
+
+// closeEnough allows for the different summation order of vector lanes
+func closeEnough(got, want float32) bool {
+	return math.Abs(float64(got-want)) <= 1e-4*math.Max(1, math.Abs(float64(want)))
+}
+
+// l2Float32Go returns the squared Euclidean distance
+func l2Float32Go(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		diff := a[i] - b[i]
+		sum += diff * diff
+	}
+	return sum
+}
+
+func dotFloat32Go(a, b []float32) float32 {
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
+
+// dotNormsFloat32Go returns the dot product and both squared norms, everything cosine needs
+func dotNormsFloat32Go(a, b []float32) (dot, na, nb float32) {
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	return dot, na, nb
+}
+
+func dotInt8Go(a, b []int8) int32 {
+	var dot int32
+	for i := range a {
+		dot += int32(a[i]) * int32(b[i])
+	}
+	return dot
+}
+
+// sqSumInt8Go returns the sum of squares and the sum of the values
+func sqSumInt8Go(a []int8) (sq, sum int32) {
+	for _, v := range a {
+		sq += int32(v) * int32(v)
+		sum += int32(v)
+	}
+	return sq, sum
+}
+
+// hammingGo counts the differing bits of two equally long bit strings, 64 bits at a time
+func hammingGo(a, b []byte) int {
+	n := 0
+	i := 0
+	for ; i+8 <= len(a); i += 8 {
+		n += bits.OnesCount64(binary.LittleEndian.Uint64(a[i:]) ^ binary.LittleEndian.Uint64(b[i:]))
+	}
+	for ; i < len(a); i++ {
+		n += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return n
+}
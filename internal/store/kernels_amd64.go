@@ -0,0 +1,71 @@
+//go:build amd64 && !purego
+
+package store
+
+import "golang.org/x/sys/cpu"
+
+// Implemented in kernels_amd64.s. Every kernel handles any length, the tail
+// that does not fill a vector register is done with scalar instructions.
+
+//go:noescape
+func l2Float32AVX2(a, b []float32) float32
+
+//go:noescape
+func dotFloat32AVX2(a, b []float32) float32
+
+//go:noescape
+func dotNormsFloat32AVX2(a, b []float32) (dot, na, nb float32)
+
+//go:noescape
+func dotInt8AVX2(a, b []int8) int32
+
+//go:noescape
+func sqSumInt8AVX2(a []int8) (sq, sum int32)
+
+//go:noescape
+func hammingAVX2(a, b []byte) int
+
+//go:noescape
+func l2Float32AVX512(a, b []float32) float32
+
+//go:noescape
+func dotFloat32AVX512(a, b []float32) float32
+
+//go:noescape
+func dotNormsFloat32AVX512(a, b []float32) (dot, na, nb float32)
+
+//go:noescape
+func dotInt8AVX512(a, b []int8) int32
+
+//go:noescape
+func sqSumInt8AVX512(a []int8) (sq, sum int32)
+
+//go:noescape
+func hammingAVX512(a, b []byte) int
+
+func useSIMD() string {
+	if !cpu.X86.HasAVX2 || !cpu.X86.HasFMA || !cpu.X86.HasPOPCNT {
+		return ""
+	}
+
+	name := "avx2"
+	l2Float32 = l2Float32AVX2
+	dotFloat32 = dotFloat32AVX2
+	dotNormsFloat32 = dotNormsFloat32AVX2
+	dotInt8 = dotInt8AVX2
+	sqSumInt8 = sqSumInt8AVX2
+	hammingBytes = hammingAVX2
+
+	if cpu.X86.HasAVX512F && cpu.X86.HasAVX512BW {
+		name = "avx512"
+		l2Float32 = l2Float32AVX512
+		dotFloat32 = dotFloat32AVX512
+		dotNormsFloat32 = dotNormsFloat32AVX512
+		dotInt8 = dotInt8AVX512
+		sqSumInt8 = sqSumInt8AVX512
+		if cpu.X86.HasAVX512VPOPCNTDQ {
+			hammingBytes = hammingAVX512
+		}
+	}
+	return name
+}
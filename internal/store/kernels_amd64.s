@@ -0,0 +1,578 @@
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+// Sums the 8 float32 lanes of a Y register into every lane of its X half
+#define HSUM_PS(y, x, tmp) \
+	VEXTRACTF128 $1, y, tmp; \
+	VADDPS       tmp, x, x; \
+	VHADDPS      x, x, x; \
+	VHADDPS      x, x, x
+
+// Sums the 8 int32 lanes of a Y register into the low lane of its X half
+#define HSUM_EPI32(y, x, tmp) \
+	VEXTRACTI128 $1, y, tmp; \
+	VPADDD       tmp, x, x; \
+	VPSHUFD      $0x4E, x, tmp; \
+	VPADDD       tmp, x, x; \
+	VPSHUFD      $0xB1, x, tmp; \
+	VPADDD       tmp, x, x
+
+// Sums the 4 int64 lanes of a Y register into the low lane of its X half
+#define HSUM_EPI64(y, x, tmp) \
+	VEXTRACTI128 $1, y, tmp; \
+	VPADDQ       tmp, x, x; \
+	VPSHUFD      $0x4E, x, tmp; \
+	VPADDQ       tmp, x, x
+
+// Nibble popcounts for the VPSHUFB based byte popcount
+DATA popcntLUT<>+0(SB)/8, $0x0302020102010100
+DATA popcntLUT<>+8(SB)/8, $0x0403030203020201
+GLOBL popcntLUT<>(SB), RODATA|NOPTR, $16
+
+// func l2Float32AVX2(a, b []float32) float32
+TEXT ·l2Float32AVX2(SB), NOSPLIT, $0-52
+	MOVQ   a_base+0(FP), SI
+	MOVQ   a_len+8(FP), CX
+	MOVQ   b_base+24(FP), DI
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+
+loop:
+	CMPQ        CX, $16
+	JL          reduce
+	VMOVUPS     (SI), Y2
+	VMOVUPS     32(SI), Y3
+	VSUBPS      (DI), Y2, Y2
+	VSUBPS      32(DI), Y3, Y3
+	VFMADD231PS Y2, Y2, Y0
+	VFMADD231PS Y3, Y3, Y1
+	ADDQ        $64, SI
+	ADDQ        $64, DI
+	SUBQ        $16, CX
+	JMP         loop
+
+reduce:
+	VADDPS Y1, Y0, Y0
+	HSUM_PS(Y0, X0, X1)
+
+tail:
+	CMPQ        CX, $0
+	JE          done
+	VMOVSS      (SI), X2
+	VSUBSS      (DI), X2, X2
+	VFMADD231SS X2, X2, X0
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         tail
+
+done:
+	VZEROUPPER
+	MOVSS X0, ret+48(FP)
+	RET
+
+// func dotFloat32AVX2(a, b []float32) float32
+TEXT ·dotFloat32AVX2(SB), NOSPLIT, $0-52
+	MOVQ   a_base+0(FP), SI
+	MOVQ   a_len+8(FP), CX
+	MOVQ   b_base+24(FP), DI
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+
+loop:
+	CMPQ        CX, $16
+	JL          reduce
+	VMOVUPS     (SI), Y2
+	VMOVUPS     32(SI), Y3
+	VFMADD231PS (DI), Y2, Y0
+	VFMADD231PS 32(DI), Y3, Y1
+	ADDQ        $64, SI
+	ADDQ        $64, DI
+	SUBQ        $16, CX
+	JMP         loop
+
+reduce:
+	VADDPS Y1, Y0, Y0
+	HSUM_PS(Y0, X0, X1)
+
+tail:
+	CMPQ        CX, $0
+	JE          done
+	VMOVSS      (SI), X2
+	VFMADD231SS (DI), X2, X0
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         tail
+
+done:
+	VZEROUPPER
+	MOVSS X0, ret+48(FP)
+	RET
+
+// func dotNormsFloat32AVX2(a, b []float32) (dot, na, nb float32)
+TEXT ·dotNormsFloat32AVX2(SB), NOSPLIT, $0-60
+	MOVQ   a_base+0(FP), SI
+	MOVQ   a_len+8(FP), CX
+	MOVQ   b_base+24(FP), DI
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+	VXORPS Y2, Y2, Y2
+
+loop:
+	CMPQ        CX, $8
+	JL          reduce
+	VMOVUPS     (SI), Y3
+	VMOVUPS     (DI), Y4
+	VFMADD231PS Y4, Y3, Y0
+	VFMADD231PS Y3, Y3, Y1
+	VFMADD231PS Y4, Y4, Y2
+	ADDQ        $32, SI
+	ADDQ        $32, DI
+	SUBQ        $8, CX
+	JMP         loop
+
+reduce:
+	HSUM_PS(Y0, X0, X3)
+	HSUM_PS(Y1, X1, X3)
+	HSUM_PS(Y2, X2, X3)
+
+tail:
+	CMPQ        CX, $0
+	JE          done
+	VMOVSS      (SI), X3
+	VMOVSS      (DI), X4
+	VFMADD231SS X4, X3, X0
+	VFMADD231SS X3, X3, X1
+	VFMADD231SS X4, X4, X2
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         tail
+
+done:
+	VZEROUPPER
+	MOVSS X0, dot+48(FP)
+	MOVSS X1, na+52(FP)
+	MOVSS X2, nb+56(FP)
+	RET
+
+// func dotInt8AVX2(a, b []int8) int32
+TEXT ·dotInt8AVX2(SB), NOSPLIT, $0-52
+	MOVQ  a_base+0(FP), SI
+	MOVQ  a_len+8(FP), CX
+	MOVQ  b_base+24(FP), DI
+	VPXOR Y0, Y0, Y0
+	VPXOR Y1, Y1, Y1
+
+loop:
+	CMPQ      CX, $32
+	JL        reduce
+	VPMOVSXBW (SI), Y2
+	VPMOVSXBW (DI), Y3
+	VPMOVSXBW 16(SI), Y4
+	VPMOVSXBW 16(DI), Y5
+	VPMADDWD  Y3, Y2, Y2
+	VPMADDWD  Y5, Y4, Y4
+	VPADDD    Y2, Y0, Y0
+	VPADDD    Y4, Y1, Y1
+	ADDQ      $32, SI
+	ADDQ      $32, DI
+	SUBQ      $32, CX
+	JMP       loop
+
+reduce:
+	VPADDD Y1, Y0, Y0
+	HSUM_EPI32(Y0, X0, X1)
+	VMOVD  X0, AX
+
+tail:
+	CMPQ    CX, $0
+	JE      done
+	MOVBLSX (SI), BX
+	MOVBLSX (DI), DX
+	IMULL   DX, BX
+	ADDL    BX, AX
+	INCQ    SI
+	INCQ    DI
+	DECQ    CX
+	JMP     tail
+
+done:
+	VZEROUPPER
+	MOVL AX, ret+48(FP)
+	RET
+
+// func sqSumInt8AVX2(a []int8) (sq, sum int32)
+TEXT ·sqSumInt8AVX2(SB), NOSPLIT, $0-32
+	MOVQ     a_base+0(FP), SI
+	MOVQ     a_len+8(FP), CX
+	VPXOR    Y0, Y0, Y0
+	VPXOR    Y1, Y1, Y1
+	VPCMPEQW Y15, Y15, Y15
+	VPSRLW   $15, Y15, Y15 // int16 ones, VPMADDWD with it sums pairs
+
+loop:
+	CMPQ      CX, $16
+	JL        reduce
+	VPMOVSXBW (SI), Y2
+	VPMADDWD  Y2, Y2, Y3
+	VPMADDWD  Y15, Y2, Y4
+	VPADDD    Y3, Y0, Y0
+	VPADDD    Y4, Y1, Y1
+	ADDQ      $16, SI
+	SUBQ      $16, CX
+	JMP       loop
+
+reduce:
+	HSUM_EPI32(Y0, X0, X2)
+	HSUM_EPI32(Y1, X1, X2)
+	VMOVD X0, AX
+	VMOVD X1, DX
+
+tail:
+	CMPQ    CX, $0
+	JE      done
+	MOVBLSX (SI), BX
+	ADDL    BX, DX
+	IMULL   BX, BX
+	ADDL    BX, AX
+	INCQ    SI
+	DECQ    CX
+	JMP     tail
+
+done:
+	VZEROUPPER
+	MOVL AX, sq+24(FP)
+	MOVL DX, sum+28(FP)
+	RET
+
+// func hammingAVX2(a, b []byte) int
+TEXT ·hammingAVX2(SB), NOSPLIT, $0-56
+	MOVQ          a_base+0(FP), SI
+	MOVQ          a_len+8(FP), CX
+	MOVQ          b_base+24(FP), DI
+	VPXOR         Y0, Y0, Y0
+	VPXOR         Y13, Y13, Y13
+	VBROADCASTI128 popcntLUT<>(SB), Y14
+	MOVL          $0x0f, AX
+	VMOVD         AX, X15
+	VPBROADCASTB  X15, Y15
+
+loop:
+	CMPQ     CX, $32
+	JL       reduce
+	VMOVDQU  (SI), Y2
+	VPXOR    (DI), Y2, Y2
+	VPAND    Y15, Y2, Y3
+	VPSRLW   $4, Y2, Y2
+	VPAND    Y15, Y2, Y2
+	VPSHUFB  Y3, Y14, Y3
+	VPSHUFB  Y2, Y14, Y2
+	VPADDB   Y2, Y3, Y3
+	VPSADBW  Y13, Y3, Y3
+	VPADDQ   Y3, Y0, Y0
+	ADDQ     $32, SI
+	ADDQ     $32, DI
+	SUBQ     $32, CX
+	JMP      loop
+
+reduce:
+	HSUM_EPI64(Y0, X0, X1)
+	VMOVQ X0, AX
+
+tail:
+	CMPQ    CX, $0
+	JE      done
+	MOVBLZX (SI), BX
+	MOVBLZX (DI), DX
+	XORL    DX, BX
+	POPCNTL BX, BX
+	ADDQ    BX, AX
+	INCQ    SI
+	INCQ    DI
+	DECQ    CX
+	JMP     tail
+
+done:
+	VZEROUPPER
+	MOVQ AX, ret+48(FP)
+	RET
+
+// func l2Float32AVX512(a, b []float32) float32
+TEXT ·l2Float32AVX512(SB), NOSPLIT, $0-52
+	MOVQ   a_base+0(FP), SI
+	MOVQ   a_len+8(FP), CX
+	MOVQ   b_base+24(FP), DI
+	VPXORD Z0, Z0, Z0
+	VPXORD Z1, Z1, Z1
+
+loop:
+	CMPQ        CX, $32
+	JL          reduce
+	VMOVUPS     (SI), Z2
+	VMOVUPS     64(SI), Z3
+	VSUBPS      (DI), Z2, Z2
+	VSUBPS      64(DI), Z3, Z3
+	VFMADD231PS Z2, Z2, Z0
+	VFMADD231PS Z3, Z3, Z1
+	ADDQ        $128, SI
+	ADDQ        $128, DI
+	SUBQ        $32, CX
+	JMP         loop
+
+reduce:
+	VADDPS        Z1, Z0, Z0
+	VEXTRACTF64X4 $1, Z0, Y1
+	VADDPS        Y1, Y0, Y0
+	HSUM_PS(Y0, X0, X1)
+
+tail:
+	CMPQ        CX, $0
+	JE          done
+	VMOVSS      (SI), X2
+	VSUBSS      (DI), X2, X2
+	VFMADD231SS X2, X2, X0
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         tail
+
+done:
+	VZEROUPPER
+	MOVSS X0, ret+48(FP)
+	RET
+
+// func dotFloat32AVX512(a, b []float32) float32
+TEXT ·dotFloat32AVX512(SB), NOSPLIT, $0-52
+	MOVQ   a_base+0(FP), SI
+	MOVQ   a_len+8(FP), CX
+	MOVQ   b_base+24(FP), DI
+	VPXORD Z0, Z0, Z0
+	VPXORD Z1, Z1, Z1
+
+loop:
+	CMPQ        CX, $32
+	JL          reduce
+	VMOVUPS     (SI), Z2
+	VMOVUPS     64(SI), Z3
+	VFMADD231PS (DI), Z2, Z0
+	VFMADD231PS 64(DI), Z3, Z1
+	ADDQ        $128, SI
+	ADDQ        $128, DI
+	SUBQ        $32, CX
+	JMP         loop
+
+reduce:
+	VADDPS        Z1, Z0, Z0
+	VEXTRACTF64X4 $1, Z0, Y1
+	VADDPS        Y1, Y0, Y0
+	HSUM_PS(Y0, X0, X1)
+
+tail:
+	CMPQ        CX, $0
+	JE          done
+	VMOVSS      (SI), X2
+	VFMADD231SS (DI), X2, X0
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         tail
+
+done:
+	VZEROUPPER
+	MOVSS X0, ret+48(FP)
+	RET
+
+// func dotNormsFloat32AVX512(a, b []float32) (dot, na, nb float32)
+TEXT ·dotNormsFloat32AVX512(SB), NOSPLIT, $0-60
+	MOVQ   a_base+0(FP), SI
+	MOVQ   a_len+8(FP), CX
+	MOVQ   b_base+24(FP), DI
+	VPXORD Z0, Z0, Z0
+	VPXORD Z1, Z1, Z1
+	VPXORD Z2, Z2, Z2
+
+loop:
+	CMPQ        CX, $16
+	JL          reduce
+	VMOVUPS     (SI), Z3
+	VMOVUPS     (DI), Z4
+	VFMADD231PS Z4, Z3, Z0
+	VFMADD231PS Z3, Z3, Z1
+	VFMADD231PS Z4, Z4, Z2
+	ADDQ        $64, SI
+	ADDQ        $64, DI
+	SUBQ        $16, CX
+	JMP         loop
+
+reduce:
+	VEXTRACTF64X4 $1, Z0, Y3
+	VADDPS        Y3, Y0, Y0
+	VEXTRACTF64X4 $1, Z1, Y3
+	VADDPS        Y3, Y1, Y1
+	VEXTRACTF64X4 $1, Z2, Y3
+	VADDPS        Y3, Y2, Y2
+	HSUM_PS(Y0, X0, X3)
+	HSUM_PS(Y1, X1, X3)
+	HSUM_PS(Y2, X2, X3)
+
+tail:
+	CMPQ        CX, $0
+	JE          done
+	VMOVSS      (SI), X3
+	VMOVSS      (DI), X4
+	VFMADD231SS X4, X3, X0
+	VFMADD231SS X3, X3, X1
+	VFMADD231SS X4, X4, X2
+	ADDQ        $4, SI
+	ADDQ        $4, DI
+	DECQ        CX
+	JMP         tail
+
+done:
+	VZEROUPPER
+	MOVSS X0, dot+48(FP)
+	MOVSS X1, na+52(FP)
+	MOVSS X2, nb+56(FP)
+	RET
+
+// func dotInt8AVX512(a, b []int8) int32
+TEXT ·dotInt8AVX512(SB), NOSPLIT, $0-52
+	MOVQ   a_base+0(FP), SI
+	MOVQ   a_len+8(FP), CX
+	MOVQ   b_base+24(FP), DI
+	VPXORD Z0, Z0, Z0
+	VPXORD Z1, Z1, Z1
+
+loop:
+	CMPQ      CX, $64
+	JL        reduce
+	VPMOVSXBW (SI), Z2
+	VPMOVSXBW (DI), Z3
+	VPMOVSXBW 32(SI), Z4
+	VPMOVSXBW 32(DI), Z5
+	VPMADDWD  Z3, Z2, Z2
+	VPMADDWD  Z5, Z4, Z4
+	VPADDD    Z2, Z0, Z0
+	VPADDD    Z4, Z1, Z1
+	ADDQ      $64, SI
+	ADDQ      $64, DI
+	SUBQ      $64, CX
+	JMP       loop
+
+reduce:
+	VPADDD        Z1, Z0, Z0
+	VEXTRACTI64X4 $1, Z0, Y1
+	VPADDD        Y1, Y0, Y0
+	HSUM_EPI32(Y0, X0, X1)
+	VMOVD         X0, AX
+
+tail:
+	CMPQ    CX, $0
+	JE      done
+	MOVBLSX (SI), BX
+	MOVBLSX (DI), DX
+	IMULL   DX, BX
+	ADDL    BX, AX
+	INCQ    SI
+	INCQ    DI
+	DECQ    CX
+	JMP     tail
+
+done:
+	VZEROUPPER
+	MOVL AX, ret+48(FP)
+	RET
+
+// func sqSumInt8AVX512(a []int8) (sq, sum int32)
+TEXT ·sqSumInt8AVX512(SB), NOSPLIT, $0-32
+	MOVQ       a_base+0(FP), SI
+	MOVQ       a_len+8(FP), CX
+	VPXORD     Z0, Z0, Z0
+	VPXORD     Z1, Z1, Z1
+	VPTERNLOGD $0xff, Z15, Z15, Z15
+	VPSRLW     $15, Z15, Z15 // int16 ones, VPMADDWD with it sums pairs
+
+loop:
+	CMPQ      CX, $32
+	JL        reduce
+	VPMOVSXBW (SI), Z2
+	VPMADDWD  Z2, Z2, Z3
+	VPMADDWD  Z15, Z2, Z4
+	VPADDD    Z3, Z0, Z0
+	VPADDD    Z4, Z1, Z1
+	ADDQ      $32, SI
+	SUBQ      $32, CX
+	JMP       loop
+
+reduce:
+	VEXTRACTI64X4 $1, Z0, Y2
+	VPADDD        Y2, Y0, Y0
+	VEXTRACTI64X4 $1, Z1, Y2
+	VPADDD        Y2, Y1, Y1
+	HSUM_EPI32(Y0, X0, X2)
+	HSUM_EPI32(Y1, X1, X2)
+	VMOVD         X0, AX
+	VMOVD         X1, DX
+
+tail:
+	CMPQ    CX, $0
+	JE      done
+	MOVBLSX (SI), BX
+	ADDL    BX, DX
+	IMULL   BX, BX
+	ADDL    BX, AX
+	INCQ    SI
+	DECQ    CX
+	JMP     tail
+
+done:
+	VZEROUPPER
+	MOVL AX, sq+24(FP)
+	MOVL DX, sum+28(FP)
+	RET
+
+// func hammingAVX512(a, b []byte) int
+TEXT ·hammingAVX512(SB), NOSPLIT, $0-56
+	MOVQ   a_base+0(FP), SI
+	MOVQ   a_len+8(FP), CX
+	MOVQ   b_base+24(FP), DI
+	VPXORQ Z0, Z0, Z0
+
+loop:
+	CMPQ      CX, $64
+	JL        reduce
+	VMOVDQU64 (SI), Z2
+	VPXORQ    (DI), Z2, Z2
+	VPOPCNTQ  Z2, Z2
+	VPADDQ    Z2, Z0, Z0
+	ADDQ      $64, SI
+	ADDQ      $64, DI
+	SUBQ      $64, CX
+	JMP       loop
+
+reduce:
+	VEXTRACTI64X4 $1, Z0, Y1
+	VPADDQ        Y1, Y0, Y0
+	HSUM_EPI64(Y0, X0, X1)
+	VMOVQ         X0, AX
+
+tail:
+	CMPQ    CX, $0
+	JE      done
+	MOVBLZX (SI), BX
+	MOVBLZX (DI), DX
+	XORL    DX, BX
+	POPCNTL BX, BX
+	ADDQ    BX, AX
+	INCQ    SI
+	INCQ    DI
+	DECQ    CX
+	JMP     tail
+
+done:
+	VZEROUPPER
+	MOVQ AX, ret+48(FP)
+	RET
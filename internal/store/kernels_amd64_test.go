@@ -0,0 +1,42 @@
+//go:build amd64 && !purego
+
+package store
+
+import "golang.org/x/sys/cpu"
+
+func simdKernelSets() []kernelSet {
+	avx2 := cpu.X86.HasAVX2 && cpu.X86.HasFMA && cpu.X86.HasPOPCNT
+	avx512 := avx2 && cpu.X86.HasAVX512F && cpu.X86.HasAVX512BW
+	return []kernelSet{
+		{
+			name:      "avx2",
+			supported: avx2,
+			l2:        l2Float32AVX2,
+			dot:       dotFloat32AVX2,
+			dotNorms:  dotNormsFloat32AVX2,
+			dotInt8:   dotInt8AVX2,
+			sqSum:     sqSumInt8AVX2,
+			hamming:   hammingAVX2,
+		},
+		{
+			name:      "avx512",
+			supported: avx512,
+			l2:        l2Float32AVX512,
+			dot:       dotFloat32AVX512,
+			dotNorms:  dotNormsFloat32AVX512,
+			dotInt8:   dotInt8AVX512,
+			sqSum:     sqSumInt8AVX512,
+			hamming:   hammingAVX2,
+		},
+		{
+			name:      "avx512-vpopcntdq",
+			supported: avx512 && cpu.X86.HasAVX512VPOPCNTDQ,
+			l2:        l2Float32AVX512,
+			dot:       dotFloat32AVX512,
+			dotNorms:  dotNormsFloat32AVX512,
+			dotInt8:   dotInt8AVX512,
+			sqSum:     sqSumInt8AVX512,
+			hamming:   hammingAVX512,
+		},
+	}
+}
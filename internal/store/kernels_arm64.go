@@ -0,0 +1,40 @@
+//go:build arm64 && !purego
+
+package store
+
+import "golang.org/x/sys/cpu"
+
+// Implemented in kernels_arm64.s. Every kernel handles any length, the tail
+// that does not fill a vector register is done with scalar instructions.
+
+//go:noescape
+func l2Float32NEON(a, b []float32) float32
+
+//go:noescape
+func dotFloat32NEON(a, b []float32) float32
+
+//go:noescape
+func dotNormsFloat32NEON(a, b []float32) (dot, na, nb float32)
+
+//go:noescape
+func dotInt8NEON(a, b []int8) int32
+
+//go:noescape
+func sqSumInt8NEON(a []int8) (sq, sum int32)
+
+//go:noescape
+func hammingNEON(a, b []byte) int
+
+func useSIMD() string {
+	if !cpu.ARM64.HasASIMD {
+		return ""
+	}
+
+	l2Float32 = l2Float32NEON
+	dotFloat32 = dotFloat32NEON
+	dotNormsFloat32 = dotNormsFloat32NEON
+	dotInt8 = dotInt8NEON
+	sqSumInt8 = sqSumInt8NEON
+	hammingBytes = hammingNEON
+	return "neon"
+}
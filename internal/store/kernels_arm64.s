@@ -0,0 +1,249 @@
+//go:build arm64 && !purego
+
+#include "textflag.h"
+
+// func l2Float32NEON(a, b []float32) float32
+TEXT ·l2Float32NEON(SB), NOSPLIT, $0-52
+	MOVD a_base+0(FP), R0
+	MOVD a_len+8(FP), R2
+	MOVD b_base+24(FP), R1
+	VEOR V0.B16, V0.B16, V0.B16
+	VEOR V1.B16, V1.B16, V1.B16
+
+loop:
+	CMP    $8, R2
+	BLT    reduce
+	VLD1.P 32(R0), [V2.S4, V3.S4]
+	VLD1.P 32(R1), [V4.S4, V5.S4]
+	VFSUB  V4.S4, V2.S4, V2.S4
+	VFSUB  V5.S4, V3.S4, V3.S4
+	VFMLA  V2.S4, V2.S4, V0.S4
+	VFMLA  V3.S4, V3.S4, V1.S4
+	SUB    $8, R2
+	B      loop
+
+reduce:
+	VFADD  V1.S4, V0.S4, V0.S4
+	VFADDP V0.S4, V0.S4, V0.S4
+	VFADDP V0.S4, V0.S4, V0.S4
+
+tail:
+	CBZ    R2, done
+	FMOVS  (R0), F2
+	FMOVS  (R1), F3
+	FSUBS  F3, F2, F2
+	FMADDS F2, F0, F2, F0
+	ADD    $4, R0
+	ADD    $4, R1
+	SUB    $1, R2
+	B      tail
+
+done:
+	FMOVS F0, ret+48(FP)
+	RET
+
+// func dotFloat32NEON(a, b []float32) float32
+TEXT ·dotFloat32NEON(SB), NOSPLIT, $0-52
+	MOVD a_base+0(FP), R0
+	MOVD a_len+8(FP), R2
+	MOVD b_base+24(FP), R1
+	VEOR V0.B16, V0.B16, V0.B16
+	VEOR V1.B16, V1.B16, V1.B16
+
+loop:
+	CMP    $8, R2
+	BLT    reduce
+	VLD1.P 32(R0), [V2.S4, V3.S4]
+	VLD1.P 32(R1), [V4.S4, V5.S4]
+	VFMLA  V4.S4, V2.S4, V0.S4
+	VFMLA  V5.S4, V3.S4, V1.S4
+	SUB    $8, R2
+	B      loop
+
+reduce:
+	VFADD  V1.S4, V0.S4, V0.S4
+	VFADDP V0.S4, V0.S4, V0.S4
+	VFADDP V0.S4, V0.S4, V0.S4
+
+tail:
+	CBZ    R2, done
+	FMOVS  (R0), F2
+	FMOVS  (R1), F3
+	FMADDS F3, F0, F2, F0
+	ADD    $4, R0
+	ADD    $4, R1
+	SUB    $1, R2
+	B      tail
+
+done:
+	FMOVS F0, ret+48(FP)
+	RET
+
+// func dotNormsFloat32NEON(a, b []float32) (dot, na, nb float32)
+TEXT ·dotNormsFloat32NEON(SB), NOSPLIT, $0-60
+	MOVD a_base+0(FP), R0
+	MOVD a_len+8(FP), R2
+	MOVD b_base+24(FP), R1
+	VEOR V0.B16, V0.B16, V0.B16
+	VEOR V1.B16, V1.B16, V1.B16
+	VEOR V2.B16, V2.B16, V2.B16
+
+loop:
+	CMP    $4, R2
+	BLT    reduce
+	VLD1.P 16(R0), [V3.S4]
+	VLD1.P 16(R1), [V4.S4]
+	VFMLA  V4.S4, V3.S4, V0.S4
+	VFMLA  V3.S4, V3.S4, V1.S4
+	VFMLA  V4.S4, V4.S4, V2.S4
+	SUB    $4, R2
+	B      loop
+
+reduce:
+	VFADDP V0.S4, V0.S4, V0.S4
+	VFADDP V0.S4, V0.S4, V0.S4
+	VFADDP V1.S4, V1.S4, V1.S4
+	VFADDP V1.S4, V1.S4, V1.S4
+	VFADDP V2.S4, V2.S4, V2.S4
+	VFADDP V2.S4, V2.S4, V2.S4
+
+tail:
+	CBZ    R2, done
+	FMOVS  (R0), F3
+	FMOVS  (R1), F4
+	FMADDS F4, F0, F3, F0
+	FMADDS F3, F1, F3, F1
+	FMADDS F4, F2, F4, F2
+	ADD    $4, R0
+	ADD    $4, R1
+	SUB    $1, R2
+	B      tail
+
+done:
+	FMOVS F0, dot+48(FP)
+	FMOVS F1, na+52(FP)
+	FMOVS F2, nb+56(FP)
+	RET
+
+// func dotInt8NEON(a, b []int8) int32
+TEXT ·dotInt8NEON(SB), NOSPLIT, $0-52
+	MOVD a_base+0(FP), R0
+	MOVD a_len+8(FP), R2
+	MOVD b_base+24(FP), R1
+	VEOR V0.B16, V0.B16, V0.B16
+	VEOR V1.B16, V1.B16, V1.B16
+
+loop:
+	CMP     $16, R2
+	BLT     reduce
+	VLD1.P  16(R0), [V2.B16]
+	VLD1.P  16(R1), [V3.B16]
+	VSXTL   V2.B8, V4.H8
+	VSXTL2  V2.B16, V5.H8
+	VSXTL   V3.B8, V6.H8
+	VSXTL2  V3.B16, V7.H8
+	VSMLAL  V6.H4, V4.H4, V0.S4
+	VSMLAL2 V6.H8, V4.H8, V1.S4
+	VSMLAL  V7.H4, V5.H4, V0.S4
+	VSMLAL2 V7.H8, V5.H8, V1.S4
+	SUB     $16, R2
+	B       loop
+
+reduce:
+	VADD  V1.S4, V0.S4, V0.S4
+	VADDV V0.S4, V0
+	VMOV  V0.S[0], R3
+
+tail:
+	CBZ    R2, done
+	MOVB.P 1(R0), R4
+	MOVB.P 1(R1), R5
+	MADDW  R5, R3, R4, R3
+	SUB    $1, R2
+	B      tail
+
+done:
+	MOVW R3, ret+48(FP)
+	RET
+
+// func sqSumInt8NEON(a []int8) (sq, sum int32)
+TEXT ·sqSumInt8NEON(SB), NOSPLIT, $0-32
+	MOVD  a_base+0(FP), R0
+	MOVD  a_len+8(FP), R2
+	VEOR  V0.B16, V0.B16, V0.B16
+	VEOR  V1.B16, V1.B16, V1.B16
+	MOVD  $0x0001000100010001, R7
+	VDUP  R7, V31.D2 // int16 ones, multiply-accumulating with it sums the values
+
+loop:
+	CMP     $16, R2
+	BLT     reduce
+	VLD1.P  16(R0), [V2.B16]
+	VSXTL   V2.B8, V4.H8
+	VSXTL2  V2.B16, V5.H8
+	VSMLAL  V4.H4, V4.H4, V0.S4
+	VSMLAL2 V4.H8, V4.H8, V0.S4
+	VSMLAL  V5.H4, V5.H4, V0.S4
+	VSMLAL2 V5.H8, V5.H8, V0.S4
+	VSMLAL  V31.H4, V4.H4, V1.S4
+	VSMLAL2 V31.H8, V4.H8, V1.S4
+	VSMLAL  V31.H4, V5.H4, V1.S4
+	VSMLAL2 V31.H8, V5.H8, V1.S4
+	SUB     $16, R2
+	B       loop
+
+reduce:
+	VADDV V0.S4, V0
+	VADDV V1.S4, V1
+	VMOV  V0.S[0], R3
+	VMOV  V1.S[0], R6
+
+tail:
+	CBZ    R2, done
+	MOVB.P 1(R0), R4
+	ADDW   R4, R6, R6
+	MADDW  R4, R3, R4, R3
+	SUB    $1, R2
+	B      tail
+
+done:
+	MOVW R3, sq+24(FP)
+	MOVW R6, sum+28(FP)
+	RET
+
+// func hammingNEON(a, b []byte) int
+TEXT ·hammingNEON(SB), NOSPLIT, $0-56
+	MOVD a_base+0(FP), R0
+	MOVD a_len+8(FP), R2
+	MOVD b_base+24(FP), R1
+	MOVD $0, R3
+
+loop:
+	CMP     $16, R2
+	BLT     tail
+	VLD1.P  16(R0), [V2.B16]
+	VLD1.P  16(R1), [V3.B16]
+	VEOR    V3.B16, V2.B16, V2.B16
+	VCNT    V2.B16, V2.B16
+	VUADDLV V2.B16, V2
+	VMOV    V2.H[0], R4
+	ADD     R4, R3, R3
+	SUB     $16, R2
+	B       loop
+
+tail:
+	CBZ     R2, done
+	MOVBU.P 1(R0), R4
+	MOVBU.P 1(R1), R5
+	EOR     R5, R4, R4
+	VMOV    R4, V2.D[0]
+	VCNT    V2.B8, V2.B8
+	VUADDLV V2.B8, V2
+	VMOV    V2.H[0], R4
+	ADD     R4, R3, R3
+	SUB     $1, R2
+	B       tail
+
+done:
+	MOVD R3, ret+48(FP)
+	RET
@@ -0,0 +1,18 @@
+//go:build arm64 && !purego
+
+package store
+
+import "golang.org/x/sys/cpu"
+
+func simdKernelSets() []kernelSet {
+	return []kernelSet{{
+		name:      "neon",
+		supported: cpu.ARM64.HasASIMD,
+		l2:        l2Float32NEON,
+		dot:       dotFloat32NEON,
+		dotNorms:  dotNormsFloat32NEON,
+		dotInt8:   dotInt8NEON,
+		sqSum:     sqSumInt8NEON,
+		hamming:   hammingNEON,
+	}}
+}
@@ -0,0 +1,9 @@
+//go:build purego || !(amd64 || arm64)
+
+package store
+
+// useSIMD keeps the pure Go kernels on platforms without assembly versions
+// and in purego builds
+func useSIMD() string {
+	return ""
+}
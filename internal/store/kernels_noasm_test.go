@@ -0,0 +1,16 @@
+//go:build purego || !(amd64 || arm64)
+
+package store
+
+import "testing"
+
+// simdKernelSets is empty, there is no assembly in this build
+func simdKernelSets() []kernelSet {
+	return nil
+}
+
+func TestKernelsArePureGo(t *testing.T) {
+	if got := Kernels(); got != "go" {
+		t.Fatalf("Kernels() = %q, want go", got)
+	}
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// kernelSet is one family of assembly kernels, checked against the Go versions
+type kernelSet struct {
+	name      string
+	supported bool
+	l2        func(a, b []float32) float32
+	dot       func(a, b []float32) float32
+	dotNorms  func(a, b []float32) (dot, na, nb float32)
+	dotInt8   func(a, b []int8) int32
+	sqSum     func(a []int8) (sq, sum int32)
+	hamming   func(a, b []byte) int
+}
+
+// kernelLengths straddle every register width and unroll factor, the long ones
+// are where float32 rounding drifts apart
+var kernelLengths = []int{
+	0, 1, 2, 3, 4, 5, 7, 8, 9, 15, 16, 17, 31, 32, 33, 63, 64, 65,
+	127, 128, 129, 255, 256, 257, 384, 768, 1000, 1536, 4096, 4994,
+}
+
+// kernelOffsets shift the start of every slice so that loads hit every
+// alignment a 64 byte register can see
+const kernelOffsets = 16
+
+func TestKernelsMatchGo(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, set := range simdKernelSets() {
+		t.Run(set.name, func(t *testing.T) {
+			if !set.supported {
+				t.Skipf("CPU does not support %s", set.name)
+			}
+			for _, n := range kernelLengths {
+				for off := 0; off < kernelOffsets; off++ {
+					fa, fb := randomFloats(rng, off+n), randomFloats(rng, off+n)
+					ia, ib := randomInt8s(rng, off+n), randomInt8s(rng, off+n)
+					ba, bb := randomBytes(rng, off+n), randomBytes(rng, off+n)
+					// Extremes are where int8 kernels overflow
+					if n > 0 {
+						ia[off], ib[off] = -128, -128
+					}
+					compareKernels(t, set, fa[off:], fb[off:], ia[off:], ib[off:], ba[off:], bb[off:])
+				}
+			}
+		})
+	}
+}
+
+func FuzzKernelsMatchGo(f *testing.F) {
+	f.Add([]byte{1, 2, 3}, uint8(0))
+	f.Add(make([]byte, 130), uint8(3))
+	f.Add([]byte{0x80, 0x80, 0x7f, 0x80, 0xff, 0x01, 0x00, 0x80, 0x80}, uint8(1))
+	f.Fuzz(func(t *testing.T, data []byte, off uint8) {
+		// Two equally long halves, each starting at an offset of the buffer
+		n := len(data) / 2
+		shift := min(int(off)%kernelOffsets, n)
+		a, b := data[shift:n], data[n+shift:n+n]
+
+		ia, ib := make([]int8, len(a)), make([]int8, len(b))
+		fa, fb := make([]float32, len(a)), make([]float32, len(b))
+		for i := range a {
+			ia[i], ib[i] = int8(a[i]), int8(b[i])
+			fa[i], fb[i] = float32(ia[i])/16, float32(ib[i])/16
+		}
+		for _, set := range simdKernelSets() {
+			if set.supported {
+				compareKernels(t, set, fa, fb, ia, ib, a, b)
+			}
+		}
+	})
+}
+
+func compareKernels(t *testing.T, set kernelSet, fa, fb []float32, ia, ib []int8, ba, bb []byte) {
+	t.Helper()
+	n := len(fa)
+
+	var l2Mag, dotMag, naMag, nbMag float64
+	for i := range fa {
+		diff := float64(fa[i]) - float64(fb[i])
+		l2Mag += diff * diff
+		dotMag += math.Abs(float64(fa[i]) * float64(fb[i]))
+		naMag += float64(fa[i]) * float64(fa[i])
+		nbMag += float64(fb[i]) * float64(fb[i])
+	}
+
+	if got, want := set.l2(fa, fb), l2Float32Go(fa, fb); !withinRounding(got, want, n, l2Mag) {
+		t.Fatalf("%s l2 n=%d: got %v want %v", set.name, n, got, want)
+	}
+	if got, want := set.dot(fa, fb), dotFloat32Go(fa, fb); !withinRounding(got, want, n, dotMag) {
+		t.Fatalf("%s dot n=%d: got %v want %v", set.name, n, got, want)
+	}
+	d, na, nb := set.dotNorms(fa, fb)
+	wd, wna, wnb := dotNormsFloat32Go(fa, fb)
+	if !withinRounding(d, wd, n, dotMag) || !withinRounding(na, wna, n, naMag) || !withinRounding(nb, wnb, n, nbMag) {
+		t.Fatalf("%s dot/norms n=%d: got %v %v %v want %v %v %v", set.name, n, d, na, nb, wd, wna, wnb)
+	}
+	if got, want := set.dotInt8(ia, ib), dotInt8Go(ia, ib); got != want {
+		t.Fatalf("%s dot int8 n=%d: got %d want %d", set.name, n, got, want)
+	}
+	sq, sum := set.sqSum(ia)
+	wsq, wsum := sqSumInt8Go(ia)
+	if sq != wsq || sum != wsum {
+		t.Fatalf("%s sq/sum int8 n=%d: got %d %d want %d %d", set.name, n, sq, sum, wsq, wsum)
+	}
+	if got, want := set.hamming(ba, bb), hammingGo(ba, bb); got != want {
+		t.Fatalf("%s hamming n=%d: got %d want %d", set.name, n, got, want)
+	}
+}
+
+// withinRounding allows for the different summation order of vector lanes.
+// Both sums carry rounding errors that grow with the number of terms and their
+// magnitude (the sum of the absolute terms), whatever the order they are added in.
+func withinRounding(got, want float32, n int, magnitude float64) bool {
+	const eps = 1.0 / (1 << 23)
+	tol := 2 * eps * math.Sqrt(float64(n+1)) * magnitude
+	return math.Abs(float64(got)-float64(want)) <= tol
+}
+
+func randomFloats(rng *rand.Rand, n int) []float32 {
+	v := make([]float32, n)
+	for i := range v {
+		v[i] = float32(rng.NormFloat64())
+	}
+	return v
+}
+
+func randomInt8s(rng *rand.Rand, n int) []int8 {
+	v := make([]int8, n)
+	for i := range v {
+		v[i] = int8(rng.Intn(256) - 128)
+	}
+	return v
+}
+
+func randomBytes(rng *rand.Rand, n int) []byte {
+	v := make([]byte, n)
+	rng.Read(v)
+	return v
+}
@@ -21,15 +21,9 @@ func divVector(a []float32, n float32) {
 }
 
 func cosineSimilarity(a, b []float32) float32 {
-	var dot, mag1, mag2 float32
-	for i := range a {
-		dot += a[i] * b[i]
-		mag1 += a[i] * a[i]
-		mag2 += b[i] * b[i]
-	}
+	dot, mag1, mag2 := dotNormsFloat32(a, b)
 	if mag1 == 0 || mag2 == 0 {
 		return 0
 	}
-	return dot / (float32(math.Sqrt(float64(mag1)))) * float32(math.Sqrt(float64(mag2)))
-
+	return dot / (float32(math.Sqrt(float64(mag1))) * float32(math.Sqrt(float64(mag2))))
 }
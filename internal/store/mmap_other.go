@@ -0,0 +1,22 @@
+//go:build !unix
+
+package store
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the file into memory on platforms without mmap support,
+// reopening is slower but behaves the same
+func mapFile(f *os.File, size int, writable bool) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(f, 0, int64(size)), b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func unmapFile(b []byte) error {
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package store
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapFile maps the first size bytes of f. A read only mapping is shared with the
+// page cache. A writable one is private: written pages are copied on first write
+// and the file itself is never modified.
+func mapFile(f *os.File, size int, writable bool) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	prot, flags := unix.PROT_READ, unix.MAP_SHARED
+	if writable {
+		prot, flags = unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE
+	}
+	return unix.Mmap(int(f.Fd()), 0, size, prot, flags)
+}
+
+func unmapFile(b []byte) error {
+	if b == nil {
+		return nil
+	}
+	return unix.Munmap(b)
+}
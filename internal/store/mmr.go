@@ -0,0 +1,74 @@
+package store
+
+import "math"
+
+// MMROptions tunes maximal marginal relevance re-ranking
+type MMROptions struct {
+	// Lambda weighs relevance against diversity: 1 ranks by similarity to the
+	// query alone, 0 only by dissimilarity to the results already picked
+	Lambda float32
+	// Candidates is how many merged search results MMR picks from, at least k
+	Candidates int
+}
+
+// SearchMMR diversifies a search with maximal marginal relevance. It fetches a
+// larger candidate set through Search, reads the stored vector of every candidate
+// from its shard and greedily picks the candidate with the best
+//
+//	lambda * sim(query, c) - (1 - lambda) * max sim(c, picked)
+//
+// using cosine similarity. Records keep their search score but are returned in
+// pick order.
+func (c *Cluster) SearchMMR(query []float32, topK int, opts SearchOptions, mmr MMROptions) []VectroRecord {
+	fetch := max(mmr.Candidates, topK)
+	candidates := c.Search(query, fetch, opts)
+
+	records := make([]VectroRecord, 0, len(candidates))
+	vectors := make([][]float32, 0, len(candidates))
+	for _, rec := range candidates {
+		vec, _, ok := c.GetShard(rec.ID).Get(rec.ID)
+		if !ok {
+			continue // deleted since the search
+		}
+		records = append(records, rec)
+		vectors = append(vectors, vec)
+	}
+	return maximalMarginalRelevance(query, records, vectors, topK, mmr.Lambda)
+}
+
+func maximalMarginalRelevance(query []float32, records []VectroRecord, vectors [][]float32, k int, lambda float32) []VectroRecord {
+	relevance := make([]float32, len(records))
+	// Highest similarity of every candidate to the picked ones so far
+	redundancy := make([]float32, len(records))
+	picked := make([]bool, len(records))
+	for i, vec := range vectors {
+		relevance[i] = cosineSimilarity(query, vec)
+		redundancy[i] = float32(math.Inf(-1))
+	}
+
+	output := make([]VectroRecord, 0, min(k, len(records)))
+	for len(output) < k && len(output) < len(records) {
+		best, bestScore := -1, float32(math.Inf(-1))
+		for i := range records {
+			if picked[i] {
+				continue
+			}
+			score := lambda * relevance[i]
+			if len(output) > 0 {
+				score -= (1 - lambda) * redundancy[i]
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		picked[best] = true
+		output = append(output, records[best])
+		for i, vec := range vectors {
+			if !picked[i] {
+				redundancy[i] = max(redundancy[i], cosineSimilarity(vec, vectors[best]))
+			}
+		}
+	}
+	return output
+}
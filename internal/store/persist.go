@@ -0,0 +1,362 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+)
+
+// Paged files hold the arena and the HNSW graph of a checkpoint. A file starts
+// with an 8 byte magic and the length of a gob encoded header, then every page
+// follows at a multiple of fileAlign so it can be used straight from a mapping.
+// Pages are written in host byte order, like the arena keeps them in memory.
+const fileAlign = 64 * 1024 // covers 4K, 16K and 64K OS pages
+
+const (
+	arenaMagic = "VECARENA"
+	hnswMagic  = "VECHNSW1"
+)
+
+func alignUp(n int) int {
+	return (n + fileAlign - 1) / fileAlign * fileAlign
+}
+
+// writePagedFile writes the header and pages to a temporary file and renames it
+// over path, so readers never see a partially written file
+func writePagedFile(path, magic string, header any, pages [][]byte) error {
+	var hdr bytes.Buffer
+	if err := gob.NewEncoder(&hdr).Encode(header); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	prefix := make([]byte, 16)
+	copy(prefix, magic)
+	binary.LittleEndian.PutUint64(prefix[8:], uint64(hdr.Len()))
+	w.Write(prefix)
+	w.Write(hdr.Bytes())
+	if err := writePadding(w, alignUp(16+hdr.Len())-16-hdr.Len()); err != nil {
+		return err
+	}
+	for _, page := range pages {
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+		if err := writePadding(w, alignUp(len(page))-len(page)); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func writePadding(w io.Writer, n int) error {
+	_, err := w.Write(make([]byte, n))
+	return err
+}
+
+// openPagedFile decodes the header of a paged file and maps the whole file.
+// It returns the mapping and the offset of the first page.
+func openPagedFile(path, magic string, header any, writable bool) ([]byte, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	// The mapping stays valid after the file is closed
+	defer f.Close()
+
+	prefix := make([]byte, 16)
+	if _, err := io.ReadFull(f, prefix); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", path, err)
+	}
+	if string(prefix[:8]) != magic {
+		return nil, 0, fmt.Errorf("%s is not a %s file", path, magic)
+	}
+	n := int(binary.LittleEndian.Uint64(prefix[8:]))
+	if err := gob.NewDecoder(io.LimitReader(f, int64(n))).Decode(header); err != nil {
+		return nil, 0, fmt.Errorf("%s: failed to read header: %w", path, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := mapFile(f, int(info.Size()), writable)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to map %s: %w", path, err)
+	}
+	return data, alignUp(16 + n), nil
+}
+
+// nextPage slices the next page of length n out of a mapping
+func nextPage(data []byte, off *int, n int) ([]byte, error) {
+	if *off+n > len(data) {
+		return nil, fmt.Errorf("file truncated at page offset %d", *off)
+	}
+	page := data[*off : *off+n : *off+n]
+	*off += alignUp(n)
+	return page, nil
+}
+
+func uint32Bytes(p []uint32) []byte {
+	if len(p) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&p[0])), 4*len(p))
+}
+
+func bytesUint32(b []byte) []uint32 {
+	if len(b) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*uint32)(unsafe.Pointer(&b[0])), len(b)/4)
+}
+
+type arenaHeader struct {
+	Dim            int
+	CodeSize       int
+	VectorsPerPage int
+	Total          uint32
+	Pages          int
+	Pending        [][]float32
+	Quantizer      []byte // learned quantizer state, e.g. PQ codebooks
+}
+
+// Save writes the arena to a page aligned file that OpenVectorArena can map
+func (a *VectorArena) Save(path string) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	hdr := arenaHeader{
+		Dim:            a.dim,
+		CodeSize:       a.bytesPerVector,
+		VectorsPerPage: a.vectorsPerPage,
+		Total:          a.totalVectors,
+		Pages:          len(a.pages),
+		Pending:        a.pending,
+	}
+	if t, ok := a.quantizer.(trainableQuantizer); ok {
+		state, err := t.marshalState()
+		if err != nil {
+			return err
+		}
+		hdr.Quantizer = state
+	}
+	return writePagedFile(path, arenaMagic, hdr, a.pages)
+}
+
+// OpenVectorArena maps an arena written by Save. Full pages are read straight
+// from the mapping and left to the OS page cache. The partially filled last page
+// and pages still waiting for quantizer training are copied to the heap, Add
+// keeps writing those.
+func OpenVectorArena(path string, q Quantizer) (*VectorArena, error) {
+	var hdr arenaHeader
+	data, off, err := openPagedFile(path, arenaMagic, &hdr, false)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := openArena(hdr, data, off, q)
+	if err != nil {
+		unmapFile(data)
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return a, nil
+}
+
+func openArena(hdr arenaHeader, data []byte, off int, q Quantizer) (*VectorArena, error) {
+	if hdr.CodeSize != q.CodeSize() {
+		return nil, fmt.Errorf("code size %d does not match the quantizer's %d", hdr.CodeSize, q.CodeSize())
+	}
+	if t, ok := q.(trainableQuantizer); ok {
+		if err := t.unmarshalState(hdr.Quantizer); err != nil {
+			return nil, err
+		}
+	}
+
+	a := NewVectorArenaWithQuantizer(hdr.Dim, q)
+	if a.vectorsPerPage != hdr.VectorsPerPage {
+		return nil, fmt.Errorf("%d vectors per page, this build uses %d", hdr.VectorsPerPage, a.vectorsPerPage)
+	}
+
+	pageLen := a.vectorsPerPage * a.bytesPerVector
+	pendingPages := (len(hdr.Pending) + a.vectorsPerPage - 1) / a.vectorsPerPage
+	lastFill := int(hdr.Total) - (hdr.Pages-1)*a.vectorsPerPage
+
+	for i := 0; i < hdr.Pages; i++ {
+		page, err := nextPage(data, &off, pageLen)
+		if err != nil {
+			return nil, err
+		}
+		if i < pendingPages || (i == hdr.Pages-1 && lastFill < a.vectorsPerPage) {
+			page = append([]byte(nil), page...)
+		}
+		a.pages = append(a.pages, page)
+	}
+
+	a.pending = hdr.Pending
+	a.totalVectors = hdr.Total
+	if hdr.Pages > 0 {
+		a.currentPageIdx = hdr.Pages - 1
+		a.currentVecIdx = lastFill
+	}
+	a.mapping = data
+	return a, nil
+}
+
+// Close releases the file mapping of an arena opened with OpenVectorArena,
+// the arena must not be used afterwards
+func (a *VectorArena) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := unmapFile(a.mapping)
+	a.mapping = nil
+	a.pages = nil
+	return err
+}
+
+type hnswFileHeader struct {
+	M, M0       int
+	Entry       uint32
+	MaxLayer    int
+	Levels      []int8   // by arena offset, -1 when not in the graph
+	Upper       []uint32 // first upper layer list of every node
+	Deleted     []uint32
+	Layer0Lists uint32
+	Layer0Pages int
+	UpperLists  uint32
+	UpperPages  int
+}
+
+// Save writes the graph to a page aligned file that OpenHNSWIndex can map.
+// It waits for running inserts.
+func (h *HNSWIndex) Save(path string) error {
+	h.Lock()
+	defer h.Unlock()
+
+	hdr := hnswFileHeader{
+		M:        HNSW_M,
+		M0:       MNSW_M0,
+		Entry:    h.Entry,
+		MaxLayer: h.MaxLayer,
+	}
+	for i := 0; i < h.nodes.size(); i++ {
+		node := h.nodes.get(uint32(i))
+		hdr.Levels = append(hdr.Levels, node.level)
+		hdr.Upper = append(hdr.Upper, node.upper)
+		if node.deleted.Load() {
+			hdr.Deleted = append(hdr.Deleted, uint32(i))
+		}
+	}
+	// Trim the unused tail of the last page
+	for len(hdr.Levels) > 0 && hdr.Levels[len(hdr.Levels)-1] < 0 {
+		hdr.Levels = hdr.Levels[:len(hdr.Levels)-1]
+	}
+	hdr.Upper = hdr.Upper[:len(hdr.Levels)]
+
+	var pages [][]byte
+	for _, slab := range []*adjacencySlab{h.layer0, h.upper} {
+		for _, page := range *slab.pages.Load() {
+			pages = append(pages, uint32Bytes(page))
+		}
+	}
+	hdr.Layer0Lists, hdr.Layer0Pages = h.layer0.lists, len(*h.layer0.pages.Load())
+	hdr.UpperLists, hdr.UpperPages = h.upper.lists, len(*h.upper.pages.Load())
+
+	return writePagedFile(path, hnswMagic, hdr, pages)
+}
+
+// OpenHNSWIndex maps a graph written by Save on top of the arena it was built on.
+// The adjacency pages are mapped copy-on-write: new inserts relink existing nodes
+// in memory and the file is never modified.
+func OpenHNSWIndex(path string, arena *VectorArena) (*HNSWIndex, error) {
+	var hdr hnswFileHeader
+	data, off, err := openPagedFile(path, hnswMagic, &hdr, true)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := openHNSW(hdr, data, off, arena)
+	if err != nil {
+		unmapFile(data)
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return h, nil
+}
+
+func openHNSW(hdr hnswFileHeader, data []byte, off int, arena *VectorArena) (*HNSWIndex, error) {
+	if hdr.M != HNSW_M || hdr.M0 != MNSW_M0 {
+		return nil, fmt.Errorf("graph built with M=%d M0=%d, this build uses M=%d M0=%d", hdr.M, hdr.M0, HNSW_M, MNSW_M0)
+	}
+
+	h := NewHNSWIndex(arena)
+	for _, s := range []struct {
+		slab  *adjacencySlab
+		pages int
+		lists uint32
+	}{
+		{h.layer0, hdr.Layer0Pages, hdr.Layer0Lists},
+		{h.upper, hdr.UpperPages, hdr.UpperLists},
+	} {
+		pages := make([][]uint32, 0, s.pages)
+		for i := 0; i < s.pages; i++ {
+			page, err := nextPage(data, &off, 4*adjacencyListsPerPage*s.slab.stride)
+			if err != nil {
+				return nil, err
+			}
+			pages = append(pages, bytesUint32(page))
+		}
+		s.slab.pages.Store(&pages)
+		s.slab.lists = s.lists
+	}
+
+	for i, level := range hdr.Levels {
+		if level < 0 {
+			continue
+		}
+		node := h.nodes.ensure(uint32(i))
+		node.level = level
+		node.upper = hdr.Upper[i]
+		h.count.Add(1)
+	}
+	for _, idx := range hdr.Deleted {
+		h.Delete(idx)
+	}
+	h.Entry, h.MaxLayer = hdr.Entry, hdr.MaxLayer
+	h.mapping = data
+	return h, nil
+}
+
+// Close releases the file mapping of an index opened with OpenHNSWIndex,
+// the index must not be used afterwards
+func (h *HNSWIndex) Close() error {
+	h.Lock()
+	defer h.Unlock()
+
+	err := unmapFile(h.mapping)
+	h.mapping = nil
+	return err
+}
@@ -0,0 +1,241 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// PQConfig tunes product quantization
+type PQConfig struct {
+	M          int // sub-quantizers, must divide the dimension. 0 picks one per ~16 dimensions
+	Bits       int // bits per sub-quantizer code (1-8), each codebook has 2^Bits centroids
+	TrainSize  int // vectors kept in full precision until the codebooks are trained on them
+	Iterations int // max k-means iterations per sub-space
+	Seed       int64
+}
+
+func DefaultPQConfig() PQConfig {
+	return PQConfig{
+		M:          0,
+		Bits:       8,
+		TrainSize:  10_000,
+		Iterations: 20,
+		Seed:       42,
+	}
+}
+
+// ProductQuantizer splits a vector into M sub-vectors and stores, for each of them,
+// the id of the closest centroid in that sub-space's codebook. A 768 dim vector with
+// M=48 and 8 bits takes 48 bytes instead of the 784 of an int8 code.
+//
+// Distances are asymmetric: the query stays in full precision and Prepare builds a
+// table with its distance to every centroid, so scoring a code is M table lookups.
+//
+// Training and encoding are serialized by the owning VectorArena.
+type ProductQuantizer struct {
+	dim    int
+	m      int
+	dsub   int // dimensions per sub-vector
+	ksub   int // centroids per codebook
+	bits   int
+	config PQConfig
+
+	codebooks []float32 // [m][ksub][dsub] flattened, nil until trained
+}
+
+func NewProductQuantizer(dim int, config PQConfig) (*ProductQuantizer, error) {
+	if config.M == 0 {
+		config.M = defaultPQSubquantizers(dim)
+	}
+	if config.M < 0 || dim%config.M != 0 {
+		return nil, fmt.Errorf("pq: %d sub-quantizers do not divide dimension %d", config.M, dim)
+	}
+	if config.Bits < 1 || config.Bits > 8 {
+		return nil, fmt.Errorf("pq: bits must be between 1 and 8, got %d", config.Bits)
+	}
+	if config.TrainSize <= 0 {
+		return nil, fmt.Errorf("pq: train size must be positive")
+	}
+
+	return &ProductQuantizer{
+		dim:    dim,
+		m:      config.M,
+		dsub:   dim / config.M,
+		ksub:   1 << config.Bits,
+		bits:   config.Bits,
+		config: config,
+	}, nil
+}
+
+// defaultPQSubquantizers picks the largest divisor of dim that gives sub-vectors of at least 16 dimensions
+func defaultPQSubquantizers(dim int) int {
+	for m := dim / 16; m > 1; m-- {
+		if dim%m == 0 {
+			return m
+		}
+	}
+	return 1
+}
+
+func (pq *ProductQuantizer) CodeSize() int {
+	return (pq.m*pq.bits + 7) / 8
+}
+
+func (pq *ProductQuantizer) Trained() bool {
+	return pq.codebooks != nil
+}
+
+func (pq *ProductQuantizer) TrainSize() int {
+	return pq.config.TrainSize
+}
+
+// marshalState encodes the codebooks, nil when untrained
+func (pq *ProductQuantizer) marshalState() ([]byte, error) {
+	if pq.codebooks == nil {
+		return nil, nil
+	}
+	state := make([]byte, 4*len(pq.codebooks))
+	for i, v := range pq.codebooks {
+		binary.LittleEndian.PutUint32(state[4*i:], math.Float32bits(v))
+	}
+	return state, nil
+}
+
+func (pq *ProductQuantizer) unmarshalState(state []byte) error {
+	if len(state) == 0 {
+		pq.codebooks = nil
+		return nil
+	}
+	if len(state) != 4*pq.m*pq.ksub*pq.dsub {
+		return fmt.Errorf("pq: codebooks of %d bytes do not match m=%d bits=%d dim=%d", len(state), pq.m, pq.bits, pq.dim)
+	}
+	codebooks := make([]float32, len(state)/4)
+	for i := range codebooks {
+		codebooks[i] = math.Float32frombits(binary.LittleEndian.Uint32(state[4*i:]))
+	}
+	pq.codebooks = codebooks
+	return nil
+}
+
+// Train runs k-means independently in every sub-space
+func (pq *ProductQuantizer) Train(samples [][]float32) error {
+	if len(samples) == 0 {
+		return fmt.Errorf("pq: no training samples")
+	}
+
+	rng := rand.New(rand.NewSource(pq.config.Seed))
+	codebooks := make([]float32, pq.m*pq.ksub*pq.dsub)
+	sub := make([][]float32, len(samples))
+
+	for m := 0; m < pq.m; m++ {
+		for i, s := range samples {
+			sub[i] = s[m*pq.dsub : (m+1)*pq.dsub]
+		}
+
+		k := pq.ksub
+		if k > len(sub) {
+			k = len(sub)
+		}
+		centroids := kmeans(sub, k, pq.config.Iterations, rng)
+
+		// With fewer samples than centroids the unused entries repeat the first
+		// centroid, nearestCentroid never prefers them over the original
+		book := codebooks[m*pq.ksub*pq.dsub : (m+1)*pq.ksub*pq.dsub]
+		for c := 0; c < pq.ksub; c++ {
+			copy(book[c*pq.dsub:], centroids[c%k])
+		}
+	}
+
+	pq.codebooks = codebooks
+	return nil
+}
+
+// centroid returns centroid c of sub-space m
+func (pq *ProductQuantizer) centroid(m, c int) []float32 {
+	start := (m*pq.ksub + c) * pq.dsub
+	return pq.codebooks[start : start+pq.dsub]
+}
+
+func (pq *ProductQuantizer) Encode(vec []float32, dst []byte) {
+	for i := range dst {
+		dst[i] = 0
+	}
+	for m := 0; m < pq.m; m++ {
+		subvec := vec[m*pq.dsub : (m+1)*pq.dsub]
+		best, bestDist := 0, dist(subvec, pq.centroid(m, 0))
+		for c := 1; c < pq.ksub; c++ {
+			if d := dist(subvec, pq.centroid(m, c)); d < bestDist {
+				best, bestDist = c, d
+			}
+		}
+		pq.putCode(dst, m, best)
+	}
+}
+
+// Decode rebuilds the vector from its centroids
+func (pq *ProductQuantizer) Decode(code []byte) []float32 {
+	out := make([]float32, 0, pq.dim)
+	for m := 0; m < pq.m; m++ {
+		out = append(out, pq.centroid(m, pq.code(code, m))...)
+	}
+	return out
+}
+
+// Prepare builds the asymmetric distance table of the query
+func (pq *ProductQuantizer) Prepare(query []float32) Distancer {
+	table := make([]float32, pq.m*pq.ksub)
+	for m := 0; m < pq.m; m++ {
+		subq := query[m*pq.dsub : (m+1)*pq.dsub]
+		for c := 0; c < pq.ksub; c++ {
+			table[m*pq.ksub+c] = dist(subq, pq.centroid(m, c))
+		}
+	}
+	return &pqDistancer{pq: pq, table: table}
+}
+
+type pqDistancer struct {
+	pq    *ProductQuantizer
+	table []float32
+}
+
+func (d *pqDistancer) Distance(code []byte) float32 {
+	var sum float32
+	ksub := d.pq.ksub
+	if d.pq.bits == 8 {
+		for m, c := range code {
+			sum += d.table[m*ksub+int(c)]
+		}
+		return sum
+	}
+	for m := 0; m < d.pq.m; m++ {
+		sum += d.table[m*ksub+d.pq.code(code, m)]
+	}
+	return sum
+}
+
+// code reads the Bits wide centroid id of sub-space m, codes are packed little endian
+func (pq *ProductQuantizer) code(code []byte, m int) int {
+	if pq.bits == 8 {
+		return int(code[m])
+	}
+	bit := m * pq.bits
+	v := int(code[bit/8]) >> (bit % 8)
+	if bit%8+pq.bits > 8 {
+		v |= int(code[bit/8+1]) << (8 - bit%8)
+	}
+	return v & (pq.ksub - 1)
+}
+
+func (pq *ProductQuantizer) putCode(code []byte, m, c int) {
+	if pq.bits == 8 {
+		code[m] = byte(c)
+		return
+	}
+	bit := m * pq.bits
+	code[bit/8] |= byte(c << (bit % 8))
+	if bit%8+pq.bits > 8 {
+		code[bit/8+1] |= byte(c >> (8 - bit%8))
+	}
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// clusteredVectors draws vectors around a few random centers, like embeddings
+// they have structure for the codebooks to learn
+func clusteredVectors(rng *rand.Rand, n, dim int) [][]float32 {
+	centers := make([][]float32, 16)
+	for i := range centers {
+		centers[i] = make([]float32, dim)
+		for j := range centers[i] {
+			centers[i][j] = rng.Float32()*2 - 1
+		}
+	}
+	vecs := make([][]float32, n)
+	for i := range vecs {
+		c := centers[rng.Intn(len(centers))]
+		vecs[i] = make([]float32, dim)
+		for j := range vecs[i] {
+			vecs[i][j] = c[j] + float32(rng.NormFloat64())*0.1
+		}
+	}
+	return vecs
+}
+
+func TestPQCodesRoundTrip(t *testing.T) {
+	// Every sub-quantizer set to its largest centroid id must read back
+	// unchanged, also when codes straddle byte boundaries
+	for _, bits := range []int{1, 3, 4, 5, 7, 8} {
+		pq, err := NewProductQuantizer(24, PQConfig{M: 12, Bits: bits, TrainSize: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := make([]byte, pq.CodeSize())
+		want := make([]int, pq.m)
+		for m := range want {
+			want[m] = (m*7 + 3) % pq.ksub
+			pq.putCode(code, m, want[m])
+		}
+		for m, c := range want {
+			if got := pq.code(code, m); got != c {
+				t.Fatalf("bits %d: sub-quantizer %d read %d, wrote %d", bits, m, got, c)
+			}
+		}
+	}
+}
+
+// TestPQAsymmetricDistance trains on clustered data and checks the distance
+// tables against exact distances: they must equal the distance to the decoded
+// vector and rank neighbours close to the exact ranking
+func TestPQAsymmetricDistance(t *testing.T) {
+	const dim, n = 64, 2000
+	rng := rand.New(rand.NewSource(1))
+	vecs := clusteredVectors(rng, n, dim)
+
+	tests := []struct {
+		bits      int
+		maxError  float64 // reconstruction error relative to the vector norms
+		minRecall float64
+	}{
+		{bits: 8, maxError: 0.05, minRecall: 0.9},
+		{bits: 4, maxError: 0.1, minRecall: 0.3},
+	}
+	for _, tt := range tests {
+		bits := tt.bits
+		pq, err := NewProductQuantizer(dim, PQConfig{M: 16, Bits: bits, TrainSize: n, Iterations: 20, Seed: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pq.Train(vecs); err != nil {
+			t.Fatal(err)
+		}
+
+		codes := make([][]byte, n)
+		var errSum, normSum float64
+		for i, v := range vecs {
+			codes[i] = make([]byte, pq.CodeSize())
+			pq.Encode(v, codes[i])
+			errSum += float64(l2Float32(v, pq.Decode(codes[i])))
+			normSum += float64(l2Float32(v, make([]float32, dim)))
+		}
+		if rel := errSum / normSum; rel > tt.maxError {
+			t.Errorf("bits %d: reconstruction error is %.3f of the vector norms", bits, rel)
+		}
+
+		const queries, k = 50, 10
+		hits := 0
+		for q := 0; q < queries; q++ {
+			query := clusteredVectors(rng, 1, dim)[0]
+			prepared := pq.Prepare(query)
+
+			exact := make([]Match, n)
+			approx := make([]Match, n)
+			for i, v := range vecs {
+				exact[i] = Match{Index: uint32(i), Score: 1 - l2Float32(query, v)}
+				d := prepared.Distance(codes[i])
+				approx[i] = Match{Index: uint32(i), Score: 1 - d}
+
+				want := l2Float32(query, pq.Decode(codes[i]))
+				if math.Abs(float64(d-want)) > 1e-4*float64(max(want, 1)) {
+					t.Fatalf("bits %d: table distance %v, distance to the decoded vector %v", bits, d, want)
+				}
+			}
+			slices.SortFunc(exact, compareMatches)
+			slices.SortFunc(approx, compareMatches)
+
+			// The true top k should be among the top 4k by table distance
+			candidates := make(map[uint32]bool)
+			for _, m := range approx[:4*k] {
+				candidates[m.Index] = true
+			}
+			for _, m := range exact[:k] {
+				if candidates[m.Index] {
+					hits++
+				}
+			}
+		}
+		recall := float64(hits) / (queries * k)
+		t.Logf("bits %d: recall@%d within %d candidates %.3f", bits, k, 4*k, recall)
+		if recall < tt.minRecall {
+			t.Errorf("bits %d: recall %.3f", bits, recall)
+		}
+	}
+}
+
+// TestPQArenaTraining fills a PQ arena past its train size, vectors are exact
+// until then and encoded by the trained codebooks after
+func TestPQArenaTraining(t *testing.T) {
+	const dim = 32
+	pq, err := NewProductQuantizer(dim, PQConfig{M: 8, Bits: 8, TrainSize: 300, Iterations: 10, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	arena := NewVectorArenaWithQuantizer(dim, pq)
+	vecs := clusteredVectors(rand.New(rand.NewSource(1)), 400, dim)
+
+	for i, v := range vecs[:299] {
+		if _, err := arena.Add(v); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := arena.Get(uint32(i)); !slices.Equal(got, v) {
+			t.Fatalf("untrained vector %d changed", i)
+		}
+	}
+	if pq.Trained() {
+		t.Fatal("trained before the train size")
+	}
+	for _, v := range vecs[299:] {
+		if _, err := arena.Add(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !pq.Trained() {
+		t.Fatal("not trained after the train size")
+	}
+
+	code := make([]byte, pq.CodeSize())
+	for i, v := range vecs {
+		pq.Encode(v, code)
+		got, _ := arena.Get(uint32(i))
+		if !slices.Equal(got, pq.Decode(code)) {
+			t.Fatalf("vector %d is not stored as its code", i)
+		}
+	}
+}
@@ -1,6 +1,189 @@
 package store
 
-import "math"
+import (
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+// QuantizationType selects how a collection encodes vectors in its arena
+type QuantizationType string
+
+const (
+	QuantizationNone   QuantizationType = "none"
+	QuantizationFP16   QuantizationType = "fp16"
+	QuantizationBF16   QuantizationType = "bf16"
+	QuantizationInt8   QuantizationType = "int8"
+	QuantizationPQ     QuantizationType = "pq"
+	QuantizationBinary QuantizationType = "binary"
+)
+
+func ParseQuantizationType(s string) (QuantizationType, error) {
+	switch t := QuantizationType(s); t {
+	case QuantizationNone, QuantizationFP16, QuantizationBF16,
+		QuantizationInt8, QuantizationPQ, QuantizationBinary:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown quantization %q", s)
+	}
+}
+
+// Quantizer turns float32 vectors into the fixed size codes stored in a VectorArena
+type Quantizer interface {
+	CodeSize() int
+	Encode(vec []float32, dst []byte)
+	Decode(code []byte) []float32
+	// Prepare does the per query work once (quantizing, building lookup tables)
+	// so that many codes can be compared against the same query cheaply
+	Prepare(query []float32) Distancer
+}
+
+// Distancer computes the approximate squared Euclidean distance between a prepared query and a code
+type Distancer interface {
+	Distance(code []byte) float32
+}
+
+// trainableQuantizer is implemented by quantizers that have to learn from the data
+// before they can encode, the arena buffers raw vectors until TrainSize is reached
+type trainableQuantizer interface {
+	Quantizer
+	Trained() bool
+	TrainSize() int
+	Train(samples [][]float32) error
+
+	// marshalState and unmarshalState save and restore what Train learned,
+	// they are used when the arena is written to disk
+	marshalState() ([]byte, error)
+	unmarshalState(state []byte) error
+}
+
+// newQuantizer builds the quantizer selected by the config
+func newQuantizer(cfg CollectionConfig, dim int) (Quantizer, error) {
+	switch cfg.Quantization {
+	case QuantizationNone:
+		return NewFloatQuantizer(dim), nil
+	case QuantizationFP16:
+		return NewFloat16Quantizer(dim), nil
+	case QuantizationBF16:
+		return NewBFloat16Quantizer(dim), nil
+	case QuantizationInt8, "":
+		return NewScalarQuantizer(dim), nil
+	case QuantizationPQ:
+		return NewProductQuantizer(dim, cfg.PQ)
+	case QuantizationBinary:
+		return NewBinaryQuantizer(dim), nil
+	default:
+		return nil, fmt.Errorf("unknown quantization %q", cfg.Quantization)
+	}
+}
+
+// FloatQuantizer stores vectors unchanged as float32, distances are exact
+type FloatQuantizer struct {
+	dim int
+}
+
+func NewFloatQuantizer(dim int) *FloatQuantizer {
+	return &FloatQuantizer{dim: dim}
+}
+
+func (f *FloatQuantizer) CodeSize() int {
+	return f.dim * 4
+}
+
+func (f *FloatQuantizer) Encode(vec []float32, dst []byte) {
+	copy(dst, unsafe.Slice((*byte)(unsafe.Pointer(&vec[0])), f.dim*4))
+}
+
+func (f *FloatQuantizer) Decode(code []byte) []float32 {
+	return append([]float32(nil), f.view(code)...)
+}
+
+// view reinterprets a code in place, the result is only valid while the code is
+func (f *FloatQuantizer) view(code []byte) []float32 {
+	return unsafe.Slice((*float32)(unsafe.Pointer(&code[0])), f.dim)
+}
+
+func (f *FloatQuantizer) Prepare(query []float32) Distancer {
+	return &floatDistancer{f: f, query: query}
+}
+
+type floatDistancer struct {
+	f     *FloatQuantizer
+	query []float32
+}
+
+func (d *floatDistancer) Distance(code []byte) float32 {
+	return dist(d.query, d.f.view(code))
+}
+
+// ScalarQuantizer stores each vector as int8 codes followed by its float32 min
+// and max, and the int32 sum of squares and sum of the codes
+type ScalarQuantizer struct {
+	dim int
+}
+
+func NewScalarQuantizer(dim int) *ScalarQuantizer {
+	return &ScalarQuantizer{dim: dim}
+}
+
+func (s *ScalarQuantizer) CodeSize() int {
+	return s.dim + 16
+}
+
+// Encode writes the int8 data, then min, max, sum of squares and sum.
+// Note: This relies on architecture being Little Endian (Standard on x86/ARM)
+func (s *ScalarQuantizer) Encode(vec []float32, dst []byte) {
+	qv := Quantize(vec)
+	sq, sum := sqSumInt8(qv.Data)
+	copy(dst, unsafe.Slice((*byte)(unsafe.Pointer(&qv.Data[0])), s.dim))
+	copy(dst[s.dim:], unsafe.Slice((*byte)(unsafe.Pointer(&qv.Min)), 4))
+	copy(dst[s.dim+4:], unsafe.Slice((*byte)(unsafe.Pointer(&qv.Max)), 4))
+	copy(dst[s.dim+8:], unsafe.Slice((*byte)(unsafe.Pointer(&sq)), 4))
+	copy(dst[s.dim+12:], unsafe.Slice((*byte)(unsafe.Pointer(&sum)), 4))
+}
+
+func (s *ScalarQuantizer) Decode(code []byte) []float32 {
+	qv := s.view(code)
+	return qv.Dequantize()
+}
+
+// view reinterprets a code in place, the result is only valid while the code is
+func (s *ScalarQuantizer) view(code []byte) QuantizedVector {
+	return QuantizedVector{
+		Data: unsafe.Slice((*int8)(unsafe.Pointer(&code[0])), s.dim),
+		Min:  *(*float32)(unsafe.Pointer(&code[s.dim])),
+		Max:  *(*float32)(unsafe.Pointer(&code[s.dim+4])),
+	}
+}
+
+// Prepare quantizes the query and precomputes its half of DistQuantized once
+func (s *ScalarQuantizer) Prepare(query []float32) Distancer {
+	qv := Quantize(query)
+	return &scalarDistancer{s: s, query: qv, terms: newQuantizedTerms(qv)}
+}
+
+type scalarDistancer struct {
+	s     *ScalarQuantizer
+	query QuantizedVector
+	terms quantizedTerms
+}
+
+// terms reads the per vector terms stored after the int8 data
+func (s *ScalarQuantizer) terms(code []byte) quantizedTerms {
+	return makeQuantizedTerms(
+		*(*float32)(unsafe.Pointer(&code[s.dim])),
+		*(*float32)(unsafe.Pointer(&code[s.dim+4])),
+		*(*int32)(unsafe.Pointer(&code[s.dim+8])),
+		*(*int32)(unsafe.Pointer(&code[s.dim+12])),
+	)
+}
+
+// Distance reads the code in place, nothing is allocated and the dot product
+// is the only pass over the data
+func (d *scalarDistancer) Distance(code []byte) float32 {
+	data := unsafe.Slice((*int8)(unsafe.Pointer(&code[0])), d.s.dim)
+	return distQuantizedTerms(d.terms, d.s.terms(code), dotInt8(d.query.Data, data), d.s.dim)
+}
 
 type QuantizedVector struct {
 	Data []int8
@@ -55,36 +238,46 @@ func (q *QuantizedVector) Dequantize() []float32 {
 // natively in int8. This is much faster as integer math is cheaper dompared to floating
 // point math.
 func DistQuantized(q1, q2 QuantizedVector) float32 {
-	var dot, sq1, sq2 int32
+	return distQuantizedTerms(newQuantizedTerms(q1), newQuantizedTerms(q2), dotInt8(q1.Data, q2.Data), len(q1.Data))
+}
 
-	for i := 0; i < len(q1.Data); i++ {
-		v1 := int32(q1.Data[i])
-		v2 := int32(q2.Data[i])
+// quantizedTerms are the parts of DistQuantized that only depend on one vector,
+// a prepared query computes its own once instead of on every comparison
+type quantizedTerms struct {
+	scale float32 // value of one int8 step
+	mid   float32 // value of int8 zero
+	sq    int32   // sum of squares of the int8 data
+	sum   int32   // sum of the int8 data
+}
 
-		dot += v1 * v2
-		sq1 += v1 * v1
-		sq2 += v2 * v2
-	}
+func newQuantizedTerms(q QuantizedVector) quantizedTerms {
+	sq, sum := sqSumInt8(q.Data)
+	return makeQuantizedTerms(q.Min, q.Max, sq, sum)
+}
 
-	s1 := (q1.Max - q1.Min) / 255.0
-	s2 := (q2.Max - q2.Min) / 255.0
+func makeQuantizedTerms(min, max float32, sq, sum int32) quantizedTerms {
+	scale := (max - min) / 255.0
+	return quantizedTerms{
+		scale: scale,
+		mid:   min + 128.0*scale,
+		sq:    sq,
+		sum:   sum,
+	}
+}
 
-	m1 := q1.Min + 128.0*s1
-	m2 := q2.Min + 128.0*s2
+// distQuantizedTerms expands sum((s1*a + m1) - (s2*b + m2))^2 so that only the
+// dot product of the int8 data is left to compute per pair
+func distQuantizedTerms(t1, t2 quantizedTerms, dot int32, dim int) float32 {
+	s1, s2 := t1.scale, t2.scale
+	m1, m2 := t1.mid, t2.mid
 
-	term1 := s1 * s1 * float32(sq1)
-	term2 := s2 * s2 * float32(sq2)
+	term1 := s1 * s1 * float32(t1.sq)
+	term2 := s2 * s2 * float32(t2.sq)
 	term3 := -2.0 * s1 * s2 * float32(dot)
-	term4 := float32(len(q1.Data)) * (m1 - m2) * (m1 - m2)
-
-	var sum1, sum2 int32
-	for i := 0; i < len(q1.Data); i++ {
-		sum1 += int32(q1.Data[i])
-		sum2 += int32(q2.Data[i])
-	}
+	term4 := float32(dim) * (m1 - m2) * (m1 - m2)
 
-	term5 := 2.0 * s1 * (m1 - m2) * float32(sum1)
-	term6 := -2.0 * s2 * (m1 - m2) * float32(sum2)
+	term5 := 2.0 * s1 * (m1 - m2) * float32(t1.sum)
+	term6 := -2.0 * s2 * (m1 - m2) * float32(t2.sum)
 
 	return term1 + term2 + term3 + term4 + term5 + term6
 }
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestScalarDistancerMatchesDistQuantized scores codes with the terms stored in
+// them, the result must match comparing the two quantized vectors directly
+func TestScalarDistancerMatchesDistQuantized(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, dim := range []int{1, 7, 64, 300} {
+		s := NewScalarQuantizer(dim)
+		code := make([]byte, s.CodeSize())
+		for trial := 0; trial < 50; trial++ {
+			vec, query := make([]float32, dim), make([]float32, dim)
+			for i := range vec {
+				vec[i] = float32(rng.NormFloat64())
+				query[i] = float32(rng.NormFloat64())
+			}
+			s.Encode(vec, code)
+
+			qv := Quantize(vec)
+			sq, sum := sqSumInt8(qv.Data)
+			if terms, want := s.terms(code), makeQuantizedTerms(qv.Min, qv.Max, sq, sum); terms != want {
+				t.Fatalf("dim %d: stored terms %+v, want %+v", dim, terms, want)
+			}
+
+			got := s.Prepare(query).Distance(code)
+			want := DistQuantized(Quantize(query), qv)
+			if math.Abs(float64(got-want)) > 1e-5*math.Max(1, float64(want)) {
+				t.Fatalf("dim %d: distance %v, DistQuantized %v", dim, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrRecordNotFound is returned when an example id of a recommendation or
+// the record of a payload update is not stored
+var ErrRecordNotFound = errors.New("record not found")
+
+// RecommendStrategy selects how positive and negative examples become a search
+type RecommendStrategy string
+
+const (
+	// RecommendAverage searches once with the mean of the positive examples,
+	// pushed away from the mean of the negative ones
+	RecommendAverage RecommendStrategy = "average"
+	// RecommendBestScore searches around every positive example and scores each
+	// candidate by its closest positive example. Candidates closer to a negative
+	// example than to every positive one are ranked after all the others.
+	RecommendBestScore RecommendStrategy = "best_score"
+)
+
+func ParseRecommendStrategy(s string) (RecommendStrategy, error) {
+	switch t := RecommendStrategy(s); t {
+	case RecommendAverage, "":
+		return RecommendAverage, nil
+	case RecommendBestScore:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown recommend strategy %q", s)
+	}
+}
+
+// Recommend returns the topK records most like the positive example ids and
+// least like the negative ones. The examples are read from their owning shards
+// and never show up in the results.
+func (c *Cluster) Recommend(positive, negative []string, topK int, strategy RecommendStrategy, opts SearchOptions) ([]VectroRecord, error) {
+	if len(positive) == 0 {
+		return nil, fmt.Errorf("at least one positive example is required")
+	}
+
+	pos, err := c.vectors(positive)
+	if err != nil {
+		return nil, err
+	}
+	neg, err := c.vectors(negative)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude := make(map[string]bool, len(positive)+len(negative))
+	for _, id := range positive {
+		exclude[id] = true
+	}
+	for _, id := range negative {
+		exclude[id] = true
+	}
+	// Fetch enough to still have topK once the examples are dropped
+	fetch := topK + len(exclude)
+
+	var results []VectroRecord
+	switch strategy {
+	case RecommendAverage, "":
+		query := mean(pos)
+		if len(neg) > 0 {
+			avgNeg := mean(neg)
+			for i := range query {
+				query[i] += query[i] - avgNeg[i]
+			}
+		}
+		results = c.Search(query, fetch, opts)
+	case RecommendBestScore:
+		results = c.recommendBestScore(pos, neg, fetch, opts)
+	default:
+		return nil, fmt.Errorf("unknown recommend strategy %q", strategy)
+	}
+
+	output := make([]VectroRecord, 0, topK)
+	for _, rec := range results {
+		if exclude[rec.ID] {
+			continue
+		}
+		output = append(output, rec)
+		if len(output) == topK {
+			break
+		}
+	}
+	return output, nil
+}
+
+func (c *Cluster) recommendBestScore(pos, neg [][]float32, fetch int, opts SearchOptions) []VectroRecord {
+	seen := make(map[string]bool)
+	var candidates []VectroRecord
+	for _, p := range pos {
+		for _, rec := range c.Search(p, fetch, opts) {
+			if !seen[rec.ID] {
+				seen[rec.ID] = true
+				candidates = append(candidates, rec)
+			}
+		}
+	}
+
+	var liked, disliked []VectroRecord
+	for _, rec := range candidates {
+		vec, _, ok := c.GetShard(rec.ID).Get(rec.ID)
+		if !ok {
+			continue // deleted since the search
+		}
+		bestPos, bestNeg := bestScore(vec, pos), bestScore(vec, neg)
+		if bestNeg > bestPos {
+			rec.Score = bestPos - bestNeg
+			disliked = append(disliked, rec)
+		} else {
+			rec.Score = bestPos
+			liked = append(liked, rec)
+		}
+	}
+
+	sortRecords(liked)
+	sortRecords(disliked)
+	return append(liked, disliked...)
+}
+
+// vectors reads the stored vectors of ids from their owning shards
+func (c *Cluster) vectors(ids []string) ([][]float32, error) {
+	out := make([][]float32, 0, len(ids))
+	for _, id := range ids {
+		vec, _, ok := c.GetShard(id).Get(id)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrRecordNotFound, id)
+		}
+		out = append(out, vec)
+	}
+	return out, nil
+}
+
+// bestScore returns the highest score of vec against any of the examples
+func bestScore(vec []float32, examples [][]float32) float32 {
+	best := float32(math.Inf(-1))
+	for _, e := range examples {
+		if s := 1 - dist(vec, e); s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+func mean(vectors [][]float32) []float32 {
+	out := make([]float32, len(vectors[0]))
+	for _, v := range vectors {
+		for i, x := range v {
+			out[i] += x
+		}
+	}
+	for i := range out {
+		out[i] /= float32(len(vectors))
+	}
+	return out
+}
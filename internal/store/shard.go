@@ -1,15 +1,33 @@
 package store
 
 import (
+	"cmp"
+	"fmt"
 	"hash/fnv"
-	"sort"
+	"slices"
+	"strings"
 	"sync"
 )
 
 type ShardHandler interface {
 	Insert(id string, vector []float32, data interface{}) error
-	Search(query []float32, topK int) []VectroRecord
+	// InsertWithSparse inserts a record that also carries a sparse vector
+	InsertWithSparse(id string, vector []float32, sparse *SparseVector, data interface{}) error
+	Search(query []float32, topK int, opts SearchOptions) []VectroRecord
+	// SearchBatch runs every query against the shard, results in query order
+	SearchBatch(queries []BatchQuery) [][]VectroRecord
+	// SearchGroups runs a grouped search against the shard
+	SearchGroups(query []float32, opts SearchOptions, group GroupOptions) []RecordGroup
+	// HybridRankings runs the keyword, sparse and vector searches of a hybrid
+	// search against the shard and returns them unfused
+	HybridRankings(query HybridQuery, fetch int, opts SearchOptions) HybridRankings
 	Delete(id string) error
+	// UpdatePayload replaces the metadata of a record
+	UpdatePayload(id string, data any) error
+	// Get returns the stored vector and metadata of a record
+	Get(id string) ([]float32, []byte, bool)
+	// Export calls fn with every record stored on the shard
+	Export(fn func(rec ExportedRecord) error) error
 }
 
 type Cluster struct {
@@ -41,12 +59,26 @@ func (c *Cluster) GetShardByID(n int) ShardHandler {
 	return c.shards[n]
 }
 
+// NumShards returns the number of shards in the cluster
+func (c *Cluster) NumShards() int {
+	return c.numShards
+}
+
 func (c *Cluster) Insert(id string, vector []float32, data any) error {
 	targetShard := c.GetShard(id)
 	return targetShard.Insert(id, vector, data)
 }
 
-func (c *Cluster) Search(query []float32, topK int) []VectroRecord {
+// InsertWithSparse inserts a record with a sparse vector next to its dense one
+func (c *Cluster) InsertWithSparse(id string, vector []float32, sparse *SparseVector, data any) error {
+	return c.GetShard(id).InsertWithSparse(id, vector, sparse, data)
+}
+
+// Search queries every shard and merges their results. Score thresholds in opts
+// are applied by each shard before merging. For a range search
+// (opts.Radius) each shard returns its matches within the radius and topK caps
+// the merged list.
+func (c *Cluster) Search(query []float32, topK int, opts SearchOptions) []VectroRecord {
 	var wg sync.WaitGroup
 
 	resultCh := make(chan []VectroRecord, c.numShards)
@@ -55,7 +87,7 @@ func (c *Cluster) Search(query []float32, topK int) []VectroRecord {
 		wg.Add(1)
 		go func(s ShardHandler) {
 			defer wg.Done()
-			resultCh <- s.Search(query, topK)
+			resultCh <- s.Search(query, topK, opts)
 		}(shard)
 	}
 
@@ -67,9 +99,7 @@ func (c *Cluster) Search(query []float32, topK int) []VectroRecord {
 		allMatches = append(allMatches, shardResults...)
 	}
 
-	sort.Slice(allMatches, func(i, j int) bool {
-		return allMatches[i].Score > allMatches[j].Score
-	})
+	sortRecords(allMatches)
 
 	if len(allMatches) > topK {
 		return allMatches[:topK]
@@ -77,7 +107,66 @@ func (c *Cluster) Search(query []float32, topK int) []VectroRecord {
 	return allMatches
 }
 
+// SearchBatch queries every shard once with the whole batch and merges the
+// results of each query across shards. The results are in query order.
+func (c *Cluster) SearchBatch(queries []BatchQuery) [][]VectroRecord {
+	var wg sync.WaitGroup
+
+	perShard := make([][][]VectroRecord, c.numShards)
+	for i, shard := range c.shards {
+		wg.Add(1)
+		go func(i int, s ShardHandler) {
+			defer wg.Done()
+			perShard[i] = s.SearchBatch(queries)
+		}(i, shard)
+	}
+	wg.Wait()
+
+	merged := make([][]VectroRecord, len(queries))
+	for q, query := range queries {
+		var all []VectroRecord
+		for _, results := range perShard {
+			if q < len(results) {
+				all = append(all, results[q]...)
+			}
+		}
+		sortRecords(all)
+		if len(all) > query.TopK {
+			all = all[:query.TopK]
+		}
+		merged[q] = all
+	}
+	return merged
+}
+
+// sortRecords orders records by score, highest first. Equal scores are ordered
+// by id so results do not depend on which shard answered first, which keeps
+// paging and caching stable.
+func sortRecords(records []VectroRecord) {
+	slices.SortFunc(records, func(a, b VectroRecord) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
+
+// Export calls fn with every record of the cluster, shard by shard
+func (c *Cluster) Export(fn func(rec ExportedRecord) error) error {
+	for i, s := range c.shards {
+		if err := s.Export(fn); err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
 func (c *Cluster) Delete(id string) error {
 	targetShard := c.GetShard(id)
 	return targetShard.Delete(id)
 }
+
+// UpdatePayload replaces the metadata of a record on its shard
+func (c *Cluster) UpdatePayload(id string, data any) error {
+	return c.GetShard(id).UpdatePayload(id, data)
+}
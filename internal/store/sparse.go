@@ -0,0 +1,170 @@
+package store
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+)
+
+// SparseVector is a sparse embedding such as SPLADE output: the non-zero
+// dimensions and their weights
+type SparseVector struct {
+	Indices []uint32  `json:"indices"`
+	Values  []float32 `json:"values"`
+}
+
+// Normalize validates the vector and returns a copy sorted by index
+func (s SparseVector) Normalize() (SparseVector, error) {
+	if len(s.Indices) != len(s.Values) {
+		return SparseVector{}, fmt.Errorf("sparse vector has %d indices and %d values", len(s.Indices), len(s.Values))
+	}
+
+	order := make([]int, len(s.Indices))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return s.Indices[order[a]] < s.Indices[order[b]] })
+
+	out := SparseVector{Indices: make([]uint32, len(order)), Values: make([]float32, len(order))}
+	for i, j := range order {
+		v := s.Values[j]
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return SparseVector{}, fmt.Errorf("sparse vector value at index %d is not finite", s.Indices[j])
+		}
+		if i > 0 && s.Indices[j] == out.Indices[i-1] {
+			return SparseVector{}, fmt.Errorf("sparse vector index %d is repeated", s.Indices[j])
+		}
+		out.Indices[i], out.Values[i] = s.Indices[j], v
+	}
+	return out, nil
+}
+
+// SparseIndex is an inverted index over sparse vectors scored by dot product.
+// Every dimension keeps a posting list of the documents with a weight in it,
+// a query only walks the lists of its own non-zero dimensions. Documents are
+// keyed by arena offset like the dense indexes.
+type SparseIndex struct {
+	mu       sync.RWMutex
+	postings map[uint32][]sparsePosting
+	vectors  map[uint32]SparseVector // live documents
+}
+
+type sparsePosting struct {
+	Doc   uint32
+	Value float32
+}
+
+type sparseState struct {
+	Vectors map[uint32]SparseVector
+}
+
+func NewSparseIndex() *SparseIndex {
+	return &SparseIndex{
+		postings: make(map[uint32][]sparsePosting),
+		vectors:  make(map[uint32]SparseVector),
+	}
+}
+
+// Add indexes the sparse vector of a document, which must be normalized
+func (s *SparseIndex) Add(doc uint32, vec SparseVector) {
+	if len(vec.Indices) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.vectors[doc]; exists {
+		return
+	}
+	for i, dim := range vec.Indices {
+		s.postings[dim] = append(s.postings[dim], sparsePosting{Doc: doc, Value: vec.Values[i]})
+	}
+	s.vectors[doc] = vec
+}
+
+// Get returns the sparse vector of a document
+func (s *SparseIndex) Get(doc uint32) (SparseVector, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	vec, ok := s.vectors[doc]
+	return vec, ok
+}
+
+// Delete forgets a document. Its postings are skipped at search time until
+// Compact drops them, which happens on every checkpoint.
+func (s *SparseIndex) Delete(doc uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.vectors, doc)
+}
+
+// Search returns the k documents with the highest dot product with the query
+func (s *SparseIndex) Search(query SparseVector, k int) []Match {
+	if len(query.Indices) == 0 || k <= 0 {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scores := make(map[uint32]float32)
+	for i, dim := range query.Indices {
+		for _, p := range s.postings[dim] {
+			if _, live := s.vectors[p.Doc]; live {
+				scores[p.Doc] += query.Values[i] * p.Value
+			}
+		}
+	}
+
+	top := make(MinHeap, 0, k)
+	for doc, score := range scores {
+		top.PushTopK(Match{Index: doc, Score: score}, k)
+	}
+	return top.Sorted()
+}
+
+// Compact drops the postings of deleted documents
+func (s *SparseIndex) Compact() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for dim, list := range s.postings {
+		live := list[:0]
+		for _, p := range list {
+			if _, ok := s.vectors[p.Doc]; ok {
+				live = append(live, p)
+			}
+		}
+		if len(live) == 0 {
+			delete(s.postings, dim)
+		} else {
+			s.postings[dim] = live
+		}
+	}
+}
+
+// Serialize writes the live sparse vectors, LoadSparseIndex rebuilds the postings
+func (s *SparseIndex) Serialize(w io.Writer) error {
+	s.Compact()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(sparseState{Vectors: s.vectors})
+}
+
+func LoadSparseIndex(r io.Reader) (*SparseIndex, error) {
+	var state sparseState
+	if err := gob.NewDecoder(r).Decode(&state); err != nil {
+		return nil, err
+	}
+
+	s := NewSparseIndex()
+	for doc, vec := range state.Vectors {
+		s.Add(doc, vec)
+	}
+	return s, nil
+}
@@ -0,0 +1,254 @@
+package store
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 parameters, the usual defaults
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// TextIndex is an inverted index over the text metadata fields of a collection,
+// scored with BM25. Documents are keyed by arena offset like the vector indexes,
+// VectraDB maps them back to record ids.
+type TextIndex struct {
+	mu     sync.RWMutex
+	fields []string
+
+	postings map[string][]posting
+	lengths  map[uint32]int // tokens per live document
+	total    int64          // tokens over all live documents
+}
+
+type posting struct {
+	Doc  uint32
+	Freq uint32
+}
+
+type textState struct {
+	Fields   []string
+	Postings map[string][]posting
+	Lengths  map[uint32]int
+}
+
+func NewTextIndex(fields []string) *TextIndex {
+	return &TextIndex{
+		fields:   fields,
+		postings: make(map[string][]posting),
+		lengths:  make(map[uint32]int),
+	}
+}
+
+// tokenize lower cases text and splits it on anything but letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// text extracts the indexed fields from JSON metadata. String values and arrays
+// of strings are indexed, anything else is ignored.
+func (t *TextIndex) text(meta []byte) string {
+	var fields map[string]any
+	if err := json.Unmarshal(meta, &fields); err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, name := range t.fields {
+		switch v := fields[name].(type) {
+		case string:
+			b.WriteString(v)
+			b.WriteByte(' ')
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					b.WriteString(s)
+					b.WriteByte(' ')
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// Add indexes the text fields of a document's metadata
+func (t *TextIndex) Add(doc uint32, meta []byte) {
+	tokens := tokenize(t.text(meta))
+	if len(tokens) == 0 {
+		return
+	}
+
+	freqs := make(map[string]uint32)
+	for _, tok := range tokens {
+		freqs[tok]++
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, exists := t.lengths[doc]; exists {
+		return
+	}
+	for term, freq := range freqs {
+		t.postings[term] = append(t.postings[term], posting{Doc: doc, Freq: freq})
+	}
+	t.lengths[doc] = len(tokens)
+	t.total += int64(len(tokens))
+}
+
+// Delete forgets a document. Its postings are skipped at search time until
+// Compact drops them, which happens on every checkpoint.
+func (t *TextIndex) Delete(doc uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if n, exists := t.lengths[doc]; exists {
+		delete(t.lengths, doc)
+		t.total -= int64(n)
+	}
+}
+
+// Update re-indexes a document whose metadata changed from old to meta
+func (t *TextIndex) Update(doc uint32, old, meta []byte) {
+	t.mu.Lock()
+	for _, term := range tokenize(t.text(old)) {
+		list := t.postings[term]
+		i := slices.IndexFunc(list, func(p posting) bool { return p.Doc == doc })
+		if i < 0 {
+			continue
+		}
+		if len(list) == 1 {
+			delete(t.postings, term)
+		} else {
+			t.postings[term] = slices.Delete(list, i, i+1)
+		}
+	}
+	if n, exists := t.lengths[doc]; exists {
+		delete(t.lengths, doc)
+		t.total -= int64(n)
+	}
+	t.mu.Unlock()
+
+	t.Add(doc, meta)
+}
+
+// Search returns the k documents with the highest BM25 score for the query
+func (t *TextIndex) Search(query string, k int) []Match {
+	terms := tokenize(query)
+	if len(terms) == 0 || k <= 0 {
+		return nil
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	n := float64(len(t.lengths))
+	if n == 0 {
+		return nil
+	}
+	avgLen := float64(t.total) / n
+
+	scores := make(map[uint32]float64)
+	seen := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		list := t.postings[term]
+		live := 0
+		for _, p := range list {
+			if _, ok := t.lengths[p.Doc]; ok {
+				live++
+			}
+		}
+		if live == 0 {
+			continue
+		}
+
+		idf := math.Log(1 + (n-float64(live)+0.5)/(float64(live)+0.5))
+		for _, p := range list {
+			length, ok := t.lengths[p.Doc]
+			if !ok {
+				continue
+			}
+			tf := float64(p.Freq)
+			scores[p.Doc] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(length)/avgLen))
+		}
+	}
+
+	top := make(MinHeap, 0, k)
+	for doc, score := range scores {
+		top.PushTopK(Match{Index: doc, Score: float32(score)}, k)
+	}
+	return top.Sorted()
+}
+
+// Compact drops the postings of deleted documents
+func (t *TextIndex) Compact() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for term, list := range t.postings {
+		live := list[:0]
+		for _, p := range list {
+			if _, ok := t.lengths[p.Doc]; ok {
+				live = append(live, p)
+			}
+		}
+		if len(live) == 0 {
+			delete(t.postings, term)
+		} else {
+			t.postings[term] = live
+		}
+	}
+}
+
+// Serialize writes the index, see LoadTextIndex
+func (t *TextIndex) Serialize(w io.Writer) error {
+	t.Compact()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(textState{
+		Fields:   t.fields,
+		Postings: t.postings,
+		Lengths:  t.lengths,
+	})
+}
+
+// LoadTextIndex reads an index written by Serialize. It fails when the index
+// was built over different fields, the caller then rebuilds it.
+func LoadTextIndex(r io.Reader, fields []string) (*TextIndex, error) {
+	var state textState
+	if err := gob.NewDecoder(r).Decode(&state); err != nil {
+		return nil, err
+	}
+	if strings.Join(state.Fields, ",") != strings.Join(fields, ",") {
+		return nil, fmt.Errorf("text index covers fields %v, the collection indexes %v", state.Fields, fields)
+	}
+
+	t := NewTextIndex(fields)
+	if state.Postings != nil {
+		t.postings = state.Postings
+	}
+	if state.Lengths != nil {
+		t.lengths = state.Lengths
+	}
+	for _, n := range t.lengths {
+		t.total += int64(n)
+	}
+	return t, nil
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestTextIndexUpdate changes the text of a document, it must score exactly
+// like a document indexed with the new text from the start
+func TestTextIndexUpdate(t *testing.T) {
+	docs := [][]byte{
+		[]byte(`{"title": "red apple pie"}`),
+		[]byte(`{"title": "green pear"}`),
+		[]byte(`{"title": "apple crumble with pear"}`),
+	}
+	updated := []byte(`{"title": "pear pear tart"}`)
+
+	index := NewTextIndex([]string{"title"})
+	want := NewTextIndex([]string{"title"})
+	for i, doc := range docs {
+		index.Add(uint32(i), doc)
+		if i == 0 {
+			want.Add(uint32(i), updated)
+		} else {
+			want.Add(uint32(i), doc)
+		}
+	}
+	index.Update(0, docs[0], updated)
+
+	for _, query := range []string{"apple", "pear", "red pie", "tart"} {
+		got, exp := index.Search(query, 10), want.Search(query, 10)
+		if !slices.Equal(got, exp) {
+			t.Errorf("%q: got %v want %v", query, got, exp)
+		}
+	}
+}
@@ -0,0 +1,617 @@
+package store
+
+import (
+	"cmp"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// vamanaSectorSize is the unit node records are laid out in. A record never
+// straddles a sector boundary, so reading a node costs one aligned SSD read.
+const vamanaSectorSize = 4096
+
+// vamanaRecordLocks is the number of locks node records are striped over
+const vamanaRecordLocks = 1024
+
+// VamanaConfig tunes the disk resident Vamana (DiskANN) index
+type VamanaConfig struct {
+	R         int     // max out-degree of a node
+	L         int     // candidate list size while inserting
+	Alpha     float32 // pruning slack, above 1 keeps long range edges for fewer hops
+	BeamWidth int     // node records read together per search hop
+	SearchL   int     // candidate list size while searching, raised to k when smaller
+	Path      string  // graph file, set by VectraDB from the storage path
+}
+
+func DefaultVamanaConfig() VamanaConfig {
+	return VamanaConfig{
+		R:         64,
+		L:         100,
+		Alpha:     1.2,
+		BeamWidth: 4,
+		SearchL:   64,
+	}
+}
+
+// VamanaIndex is a DiskANN style graph index for collections larger than RAM.
+// Full precision vectors and neighbour lists live in the graph file, one record
+// per node packed into 4KB sectors. Only the arena's compact codes (ideally PQ)
+// are kept in memory, they steer the beam search and the full vectors read from
+// disk along the way give the exact final ranking.
+//
+// The file is the index data: Serialize only writes the entry point and which
+// offsets are present, so LoadIndex must be pointed at the file as it was then.
+// Inserts keep rewriting the working file, after a checkpoint they first save
+// the sectors they touch to its undo log (StartCheckpoint).
+//
+// Inserts and searches run concurrently. mu only guards the in-memory state,
+// record reads and writes take the lock of the record's stripe instead.
+type VamanaIndex struct {
+	mu     sync.RWMutex
+	arena  *VectorArena
+	config VamanaConfig
+	file   *os.File
+	undo   atomic.Pointer[undoLog] // of the last checkpoint, nil before the first
+
+	dim        int
+	recordSize int // vector, neighbour count, R neighbour slots
+	perSector  int // records per sector, 0 when a record needs several sectors
+
+	entry      uint32
+	count      int
+	added      atomic.Pointer[[]atomic.Uint64] // bitset of offsets in the graph, grown under mu
+	tombstones map[uint32]bool
+
+	records [vamanaRecordLocks]sync.RWMutex // by node id
+	scratch sync.Pool                       // *searchScratch
+}
+
+// vamanaNode is a node record read from the graph file
+type vamanaNode struct {
+	id        uint32
+	dist      float32 // exact distance to the query it was read for
+	vector    []float32
+	neighbors []uint32
+}
+
+type vamanaState struct {
+	Entry      uint32
+	Count      int
+	Added      []uint64
+	Tombstones []uint32
+}
+
+// NewVamanaIndex opens the graph file at config.Path as an empty index. Records
+// left in the file by an earlier run are overwritten as offsets are added again.
+func NewVamanaIndex(arena *VectorArena, config VamanaConfig) (*VamanaIndex, error) {
+	if config.R <= 0 || config.L <= 0 || config.BeamWidth <= 0 {
+		return nil, fmt.Errorf("vamana: R, L and beam width must be positive")
+	}
+	if config.Path == "" {
+		return nil, fmt.Errorf("vamana: no graph file path")
+	}
+	f, err := os.OpenFile(config.Path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("vamana: failed to open graph file: %w", err)
+	}
+	undo, err := openUndoLog(config.Path)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("vamana: failed to open undo log: %w", err)
+	}
+
+	dim := arena.dim
+	recordSize := 4*dim + 4 + 4*config.R
+	v := &VamanaIndex{
+		arena:      arena,
+		config:     config,
+		file:       f,
+		dim:        dim,
+		recordSize: recordSize,
+		perSector:  vamanaSectorSize / recordSize,
+		tombstones: make(map[uint32]bool),
+		scratch:    sync.Pool{New: func() any { return new(searchScratch) }},
+	}
+	v.undo.Store(undo)
+	return v, nil
+}
+
+// offset is where the record of a node starts in the graph file
+func (v *VamanaIndex) offset(id uint32) int64 {
+	if v.perSector > 0 {
+		return int64(id)/int64(v.perSector)*vamanaSectorSize + int64(id)%int64(v.perSector)*int64(v.recordSize)
+	}
+	sectors := (v.recordSize + vamanaSectorSize - 1) / vamanaSectorSize
+	return int64(id) * int64(sectors) * vamanaSectorSize
+}
+
+// isAdded reports whether a node is in the graph, it takes no lock
+func (v *VamanaIndex) isAdded(id uint32) bool {
+	added := v.added.Load()
+	if added == nil {
+		return false
+	}
+	w := int(id / 64)
+	return w < len(*added) && (*added)[w].Load()&(1<<(id%64)) != 0
+}
+
+// markAdded sets the bit of a node, the caller holds mu so a grown copy of the
+// bitset cannot lose a concurrently set bit
+func (v *VamanaIndex) markAdded(id uint32) {
+	added := v.added.Load()
+	if added == nil || int(id/64) >= len(*added) {
+		grown := make([]atomic.Uint64, max(int(id/64)+1, 2*v.addedWords()))
+		if added != nil {
+			for i := range *added {
+				grown[i].Store((*added)[i].Load())
+			}
+		}
+		v.added.Store(&grown)
+		added = &grown
+	}
+	(*added)[id/64].Or(1 << (id % 64))
+}
+
+func (v *VamanaIndex) addedWords() int {
+	if added := v.added.Load(); added != nil {
+		return len(*added)
+	}
+	return 0
+}
+
+// addedBits copies the bitset out for Serialize
+func (v *VamanaIndex) addedBits() []uint64 {
+	added := v.added.Load()
+	if added == nil {
+		return nil
+	}
+	bits := make([]uint64, len(*added))
+	for i := range bits {
+		bits[i] = (*added)[i].Load()
+	}
+	return bits
+}
+
+func (v *VamanaIndex) recordLock(id uint32) *sync.RWMutex {
+	return &v.records[id%vamanaRecordLocks]
+}
+
+// readNode reads and decodes one node record under its stripe lock
+func (v *VamanaIndex) readNode(id uint32) (vamanaNode, error) {
+	lock := v.recordLock(id)
+	lock.RLock()
+	defer lock.RUnlock()
+	return v.readRecord(id)
+}
+
+// readRecord reads and decodes one node record, the caller holds its stripe lock
+func (v *VamanaIndex) readRecord(id uint32) (vamanaNode, error) {
+	buf := make([]byte, v.recordSize)
+	if _, err := v.file.ReadAt(buf, v.offset(id)); err != nil {
+		return vamanaNode{}, fmt.Errorf("vamana: failed to read node %d: %w", id, err)
+	}
+
+	node := vamanaNode{id: id, vector: make([]float32, v.dim)}
+	for i := range node.vector {
+		node.vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	off := 4 * v.dim
+	n := int(binary.LittleEndian.Uint32(buf[off:]))
+	if n > v.config.R {
+		return vamanaNode{}, fmt.Errorf("vamana: node %d has %d neighbours, corrupt record", id, n)
+	}
+	node.neighbors = make([]uint32, n)
+	for i := range node.neighbors {
+		node.neighbors[i] = binary.LittleEndian.Uint32(buf[off+4+4*i:])
+	}
+	return node, nil
+}
+
+// readNodes reads a beam of records at once, the reads are issued concurrently
+// so the SSD sees them together instead of one round trip per node
+func (v *VamanaIndex) readNodes(ids []uint32) ([]vamanaNode, error) {
+	nodes := make([]vamanaNode, len(ids))
+	errs := make([]error, len(ids))
+	if len(ids) == 1 {
+		nodes[0], errs[0] = v.readNode(ids[0])
+		return nodes, errs[0]
+	}
+
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nodes[i], errs[i] = v.readNode(id)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// writeNode writes a whole record under its stripe lock
+func (v *VamanaIndex) writeNode(id uint32, vector []float32, neighbors []uint32) error {
+	buf := make([]byte, v.recordSize)
+	for i, x := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	putNeighbors(buf[4*v.dim:], neighbors)
+
+	lock := v.recordLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+	return v.writeAt(buf, v.offset(id))
+}
+
+// writeNeighbors rewrites only the neighbour list of a record, the caller holds
+// its stripe lock
+func (v *VamanaIndex) writeNeighbors(id uint32, neighbors []uint32) error {
+	buf := make([]byte, 4+4*v.config.R)
+	putNeighbors(buf, neighbors)
+	return v.writeAt(buf, v.offset(id)+int64(4*v.dim))
+}
+
+// writeAt writes to the graph file once the undo log holds what it overwrites
+func (v *VamanaIndex) writeAt(buf []byte, off int64) error {
+	if undo := v.undo.Load(); undo != nil {
+		if err := undo.save(v.file, off, len(buf)); err != nil {
+			return fmt.Errorf("vamana: failed to save sectors to the undo log: %w", err)
+		}
+	}
+	_, err := v.file.WriteAt(buf, off)
+	return err
+}
+
+func putNeighbors(buf []byte, neighbors []uint32) {
+	binary.LittleEndian.PutUint32(buf, uint32(len(neighbors)))
+	for i, n := range neighbors {
+		binary.LittleEndian.PutUint32(buf[4+4*i:], n)
+	}
+}
+
+// beamSearch walks the graph from the entry point keeping the l closest candidates
+// by in-memory code distance. Every hop reads the records of the BeamWidth closest
+// unexpanded candidates together and scores them exactly. It returns every node
+// read, with its exact distance to the query.
+func (v *VamanaIndex) beamSearch(query []float32, entry uint32, l int) ([]vamanaNode, error) {
+	prepared := v.arena.Distancer(query)
+	scratch := v.scratch.Get().(*searchScratch)
+	defer v.scratch.Put(scratch)
+
+	visited := &scratch.visited
+	visited.reset(v.addedWords() * 64)
+	visited.visit(entry)
+
+	entryDist, _ := prepared.Distance(entry)
+	// candidates is sorted closest first, expanded nodes are marked in read
+	candidates := append(scratch.results[:0], nodeDist{id: entry, dist: entryDist})
+	read := make(map[uint32]bool)
+	var expanded []vamanaNode
+
+	beam := scratch.ids[:0]
+	for {
+		beam = beam[:0]
+		for _, c := range candidates {
+			if !read[c.id] {
+				beam = append(beam, c.id)
+				if len(beam) == v.config.BeamWidth {
+					break
+				}
+			}
+		}
+		if len(beam) == 0 {
+			break
+		}
+
+		nodes, err := v.readNodes(beam)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			read[node.id] = true
+			node.dist = dist(query, node.vector)
+			expanded = append(expanded, node)
+
+			for _, friend := range node.neighbors {
+				if !v.isAdded(friend) || !visited.visit(friend) {
+					continue
+				}
+				d, err := prepared.Distance(friend)
+				if err != nil {
+					continue
+				}
+				found := nodeDist{id: friend, dist: d}
+				if len(candidates) >= l && !closer(found, candidates[len(candidates)-1]) {
+					continue
+				}
+				pos := sort.Search(len(candidates), func(i int) bool { return closer(found, candidates[i]) })
+				candidates = slices.Insert(candidates, pos, found)
+				if len(candidates) > l {
+					candidates = candidates[:l]
+				}
+			}
+		}
+	}
+	scratch.results, scratch.ids = candidates, beam
+	return expanded, nil
+}
+
+// robustPrune picks at most R neighbours for a node out of candidates sorted by
+// their distance to it. A candidate is skipped when an already picked neighbour
+// is alpha times closer to it than the node is, which leaves room for long edges.
+func (v *VamanaIndex) robustPrune(self uint32, candidates []vamanaNode) []uint32 {
+	alpha2 := v.config.Alpha * v.config.Alpha // distances are squared
+	picked := make([]vamanaNode, 0, v.config.R)
+	for _, c := range candidates {
+		if c.id == self {
+			continue
+		}
+		keep := true
+		for _, p := range picked {
+			if p.id == c.id || alpha2*dist(p.vector, c.vector) <= c.dist {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			picked = append(picked, c)
+			if len(picked) == v.config.R {
+				break
+			}
+		}
+	}
+
+	ids := make([]uint32, len(picked))
+	for i, p := range picked {
+		ids[i] = p.id
+	}
+	return ids
+}
+
+func sortNodes(nodes []vamanaNode) {
+	slices.SortFunc(nodes, func(a, b vamanaNode) int {
+		if c := cmp.Compare(a.dist, b.dist); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.id, b.id)
+	})
+}
+
+// Add inserts a node: it searches the graph for the new vector, prunes the nodes
+// it read down to R neighbours and links them back. Only the very first node is
+// written under mu, the others search and write while searches and other
+// inserts carry on, and join the graph once their record is on disk.
+func (v *VamanaIndex) Add(vector []float32, idx uint32) {
+	if v.isAdded(idx) {
+		return
+	}
+
+	v.mu.RLock()
+	entry, empty := v.entry, v.count == 0
+	v.mu.RUnlock()
+
+	if empty {
+		v.mu.Lock()
+		if v.count == 0 {
+			if v.writeNode(idx, vector, nil) == nil {
+				v.entry = idx
+				v.markAdded(idx)
+				v.count++
+			}
+			v.mu.Unlock()
+			return
+		}
+		entry = v.entry
+		v.mu.Unlock()
+	}
+
+	visited, err := v.beamSearch(vector, entry, v.config.L)
+	if err != nil {
+		return
+	}
+	sortNodes(visited)
+	neighbors := v.robustPrune(idx, visited)
+	if err := v.writeNode(idx, vector, neighbors); err != nil {
+		return
+	}
+
+	v.mu.Lock()
+	if v.isAdded(idx) {
+		v.mu.Unlock()
+		return
+	}
+	v.markAdded(idx)
+	v.count++
+	v.mu.Unlock()
+
+	// Link them back (Bidirectional)
+	for _, n := range neighbors {
+		v.link(n, idx, vector)
+	}
+}
+
+// link adds idx to the neighbours of n, re-pruning the list when it is full.
+// The other neighbours are compared using their in-memory codes, reading all of
+// their records from disk would cost R reads per backlink. The record of n stays
+// locked from read to write so concurrent backlinks to it are not lost.
+func (v *VamanaIndex) link(n, idx uint32, vector []float32) {
+	lock := v.recordLock(n)
+	lock.Lock()
+	defer lock.Unlock()
+
+	node, err := v.readRecord(n)
+	if err != nil || slices.Contains(node.neighbors, idx) {
+		return
+	}
+	if len(node.neighbors) < v.config.R {
+		v.writeNeighbors(n, append(node.neighbors, idx))
+		return
+	}
+
+	candidates := []vamanaNode{{id: idx, vector: vector, dist: dist(node.vector, vector)}}
+	for _, id := range node.neighbors {
+		vec, err := v.arena.Get(id)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, vamanaNode{id: id, vector: vec, dist: dist(node.vector, vec)})
+	}
+	sortNodes(candidates)
+	v.writeNeighbors(n, v.robustPrune(n, candidates))
+}
+
+// Search runs a beam search and ranks the nodes it read by exact distance. A
+// range search keeps the nodes read whose exact distance is within the radius.
+func (v *VamanaIndex) Search(query []float32, k int, opts SearchOptions) []Match {
+	v.mu.RLock()
+	entry, empty := v.entry, v.count == 0
+	v.mu.RUnlock()
+
+	if empty || k <= 0 {
+		return nil
+	}
+
+	l := v.config.SearchL
+	if opts.Ef > 0 {
+		l = opts.Ef
+	}
+	if l < k {
+		l = k
+	}
+	visited, err := v.beamSearch(query, entry, l)
+	if err != nil {
+		return nil
+	}
+	sortNodes(visited)
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	output := make([]Match, 0, k)
+	for _, node := range visited {
+		if v.tombstones[node.id] || !opts.within(node.dist) {
+			continue
+		}
+		output = append(output, Match{Index: node.id, Score: 1 - node.dist})
+		if len(output) == k {
+			break
+		}
+	}
+	return output
+}
+
+// Vector returns the full precision vector of a node from the graph file
+func (v *VamanaIndex) Vector(idx uint32) ([]float32, error) {
+	if !v.isAdded(idx) {
+		return nil, fmt.Errorf("vamana: node %d is not in the graph", idx)
+	}
+	node, err := v.readNode(idx)
+	return node.vector, err
+}
+
+// Delete tombstones the node, it keeps routing searches through the graph
+func (v *VamanaIndex) Delete(idx uint32) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// The offset may not be added yet when an insert is still in flight
+	v.tombstones[idx] = true
+	return nil
+}
+
+func (v *VamanaIndex) Stats() IndexStats {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return IndexStats{
+		Type:    IndexVamana,
+		Vectors: v.count,
+		Deleted: len(v.tombstones),
+	}
+}
+
+// Serialize flushes the graph file and writes which offsets it holds
+func (v *VamanaIndex) Serialize(w io.Writer) error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if err := v.file.Sync(); err != nil {
+		return err
+	}
+	state := vamanaState{
+		Entry: v.entry,
+		Count: v.count,
+		Added: v.addedBits(),
+	}
+	for off := range v.tombstones {
+		state.Tombstones = append(state.Tombstones, off)
+	}
+	return encodeIndex(w, IndexVamana, state)
+}
+
+func (v *VamanaIndex) load(dec *gob.Decoder) error {
+	var state vamanaState
+	if err := dec.Decode(&state); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.entry = state.Entry
+	v.count = state.Count
+	added := make([]atomic.Uint64, len(state.Added))
+	for i, w := range state.Added {
+		added[i].Store(w)
+	}
+	v.added.Store(&added)
+	for _, off := range state.Tombstones {
+		v.tombstones[off] = true
+	}
+	return nil
+}
+
+// StartCheckpoint flushes the graph file and starts the undo log of the
+// checkpoint named generation, so that opening it later can return the file to
+// its current state. No record may be written meanwhile.
+func (v *VamanaIndex) StartCheckpoint(generation string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.file.Sync(); err != nil {
+		return err
+	}
+	info, err := v.file.Stat()
+	if err != nil {
+		return err
+	}
+	undo, err := createUndoLog(undoLogPath(v.config.Path, generation), info.Size())
+	if err != nil {
+		return err
+	}
+	if old := v.undo.Swap(undo); old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// Close closes the graph file and the undo log
+func (v *VamanaIndex) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if undo := v.undo.Swap(nil); undo != nil {
+		undo.close()
+	}
+	return v.file.Close()
+}
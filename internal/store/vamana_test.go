@@ -0,0 +1,93 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestVamanaCheckpointKeepsGraph reopens a checkpoint after later inserts have
+// rewritten neighbour lists of the working graph file, the reopened collection
+// must search exactly like it did when the checkpoint was taken
+func TestVamanaCheckpointKeepsGraph(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// after runs between the checkpoint and the inserts that follow it
+		after func(t *testing.T, db *VectraDB)
+	}{
+		{"reopen", func(t *testing.T, db *VectraDB) {}},
+		{"checkpoint that failed halfway", func(t *testing.T, db *VectraDB) {
+			// A later checkpoint that started its undo log but never got
+			// switched to, its log must be written back as well
+			if err := db.Index.(*VamanaIndex).StartCheckpoint("checkpoint-99999999999999999999"); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			collection := DefaultCollectionConfig()
+			collection.Index = IndexVamana
+			collection.Vamana.R = 8 // small lists fill up and get re-pruned
+
+			db, err := NewVectraDBWithConfig(stressDim, dir, collection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rng := rand.New(rand.NewSource(1))
+			insert := func(from, to int) {
+				for i := from; i < to; i++ {
+					if err := db.Insert(fmt.Sprintf("vec-%d", i), stressVector(rng), nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			insert(0, 250)
+			if err := db.Checkpoint(1); err != nil {
+				t.Fatal(err)
+			}
+			insert(250, 500)
+			if err := db.Checkpoint(2); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "checkpoint-00000000000000000002", "vamana.graph")); !os.IsNotExist(err) {
+				t.Fatalf("the checkpoint copied the graph file: %v", err)
+			}
+
+			queries := make([][]float32, 20)
+			want := make([][]VectroRecord, len(queries))
+			for i := range queries {
+				queries[i] = stressVector(rng)
+				want[i] = db.Search(queries[i], 10, SearchOptions{})
+			}
+			tc.after(t, db)
+			insert(500, 1000)
+			db.Close()
+
+			// The second reopen checks the undo log was started over
+			for reopen := 0; reopen < 2; reopen++ {
+				db, err = NewVectraDBWithConfig(stressDim, dir, collection)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := db.IndexStats().Vectors; got != 500 {
+					t.Fatalf("reopened with %d vectors, want 500", got)
+				}
+				for i, q := range queries {
+					got := db.Search(q, 10, SearchOptions{})
+					if !slices.EqualFunc(got, want[i], func(a, b VectroRecord) bool { return a.ID == b.ID && a.Score == b.Score }) {
+						t.Fatalf("query %d after reopen: got %v want %v", i, got, want[i])
+					}
+				}
+				insert(1000, 1100)
+				db.Close()
+			}
+			if logs := undoLogs(filepath.Join(dir, "vamana.graph")); len(logs) != 1 {
+				t.Fatalf("undo logs left: %v", logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// undoEntryHeader is the sector number and the length of the bytes saved for it
+const undoEntryHeader = 12
+
+// undoLog keeps the sectors of the graph file as they were at a checkpoint,
+// each one saved before inserts first rewrite it. Opening the checkpoint writes
+// them back, so checkpoints never copy the graph file.
+//
+// Every checkpoint starts a log of its own next to the graph file, named after
+// the checkpoint. The file starts with the size the graph file had, then holds
+// the saved sectors in the order they were first rewritten.
+type undoLog struct {
+	mu    sync.Mutex
+	file  *os.File
+	size  int64          // graph file size at the checkpoint
+	saved map[int64]bool // sectors already in the log
+}
+
+func undoLogPath(graph, generation string) string {
+	return graph + ".undo-" + generation
+}
+
+// undoLogs lists the undo logs of a graph file, newest checkpoint first
+func undoLogs(graph string) []string {
+	logs, _ := filepath.Glob(undoLogPath(graph, "*"))
+	slices.Sort(logs)
+	slices.Reverse(logs)
+	return logs
+}
+
+// createUndoLog starts an empty undo log for a graph file of the given size
+func createUndoLog(path string, size int64) (*undoLog, error) {
+	if err := writeFileAtomic(path, func(f *os.File) error {
+		return binary.Write(f, binary.LittleEndian, size)
+	}); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &undoLog{file: f, size: size, saved: make(map[int64]bool)}, nil
+}
+
+// openUndoLog continues the newest undo log of a graph file, nil when there is
+// none. A sector saved twice is written back oldest last, so the sectors
+// already in the log need not be tracked.
+func openUndoLog(graph string) (*undoLog, error) {
+	logs := undoLogs(graph)
+	if len(logs) == 0 {
+		return nil, nil
+	}
+	size, entries, err := readUndoLog(logs[0])
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(logs[0], os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// Drop an entry torn by a crash, the sector write it guarded never happened
+	end := int64(8)
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		end = last.pos + last.n
+	}
+	if err := f.Truncate(end); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &undoLog{file: f, size: size, saved: make(map[int64]bool)}, nil
+}
+
+// undoEntry locates the saved bytes of a sector in an undo log
+type undoEntry struct {
+	sector int64
+	pos    int64 // of the bytes in the log
+	n      int64
+}
+
+// readUndoLog returns the graph file size an undo log starts from and its
+// complete entries
+func readUndoLog(path string) (int64, []undoEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	var size int64
+	if err := binary.Read(f, binary.LittleEndian, &size); err != nil {
+		return 0, nil, fmt.Errorf("vamana: undo log %s has no header: %w", path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var entries []undoEntry
+	header := make([]byte, undoEntryHeader)
+	for pos := int64(8); ; {
+		if _, err := f.ReadAt(header, pos); err != nil {
+			break
+		}
+		e := undoEntry{
+			sector: int64(binary.LittleEndian.Uint64(header)),
+			pos:    pos + undoEntryHeader,
+			n:      int64(binary.LittleEndian.Uint32(header[8:])),
+		}
+		if e.n > vamanaSectorSize || e.pos+e.n > info.Size() {
+			break
+		}
+		entries = append(entries, e)
+		pos = e.pos + e.n
+	}
+	return size, entries, nil
+}
+
+// save logs the sectors overlapping [off, off+n) of the graph file that existed
+// at the checkpoint and are not in the log yet. The log is synced before it
+// returns, so the rewrite that follows can never reach the disk first.
+func (u *undoLog) save(graph *os.File, off int64, n int) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	end := min(off+int64(n), u.size)
+	var buf []byte
+	var sectors []int64
+	for s := off / vamanaSectorSize; s*vamanaSectorSize < end; s++ {
+		if u.saved[s] {
+			continue
+		}
+		entry := make([]byte, undoEntryHeader+vamanaSectorSize)
+		read, err := graph.ReadAt(entry[undoEntryHeader:], s*vamanaSectorSize)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		binary.LittleEndian.PutUint64(entry, uint64(s))
+		binary.LittleEndian.PutUint32(entry[8:], uint32(read))
+		buf = append(buf, entry[:undoEntryHeader+read]...)
+		sectors = append(sectors, s)
+	}
+	if len(sectors) == 0 {
+		return nil
+	}
+	if _, err := u.file.Write(buf); err != nil {
+		return err
+	}
+	if err := u.file.Sync(); err != nil {
+		return err
+	}
+	for _, s := range sectors {
+		u.saved[s] = true
+	}
+	return nil
+}
+
+func (u *undoLog) close() error {
+	return u.file.Close()
+}
+
+// rollbackGraph returns the graph file to its state at the checkpoint named
+// generation and starts its undo log over. Logs of later checkpoints, left by
+// ones that failed before they were switched to, are written back first. A
+// checkpoint without a log, from before undo logs, keeps the file as it is.
+func rollbackGraph(path, generation string) error {
+	graph, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer graph.Close()
+
+	size := int64(-1)
+	logs := undoLogs(path)
+	for _, log := range logs {
+		gen := strings.TrimPrefix(log, undoLogPath(path, ""))
+		if gen < generation {
+			break
+		}
+		logSize, entries, err := readUndoLog(log)
+		if err != nil {
+			return err
+		}
+		buf := make([]byte, vamanaSectorSize)
+		f, err := os.Open(log)
+		if err != nil {
+			return err
+		}
+		for _, e := range slices.Backward(entries) {
+			_, err := f.ReadAt(buf[:e.n], e.pos)
+			if err == nil {
+				_, err = graph.WriteAt(buf[:e.n], e.sector*vamanaSectorSize)
+			}
+			if err != nil {
+				f.Close()
+				return fmt.Errorf("vamana: failed to roll back sector %d: %w", e.sector, err)
+			}
+		}
+		f.Close()
+		if gen == generation {
+			size = logSize
+		}
+	}
+
+	if size >= 0 {
+		if err := graph.Truncate(size); err != nil {
+			return err
+		}
+	} else if info, err := graph.Stat(); err != nil {
+		return err
+	} else {
+		size = info.Size()
+	}
+	if err := graph.Sync(); err != nil {
+		return err
+	}
+
+	u, err := createUndoLog(undoLogPath(path, generation), size)
+	if err != nil {
+		return err
+	}
+	u.close()
+	removeUndoLogs(path, generation)
+	return nil
+}
+
+// removeUndoLogs deletes the undo logs of a graph file other than the one of
+// the checkpoint named keep
+func removeUndoLogs(graph, keep string) {
+	for _, log := range undoLogs(graph) {
+		if log != undoLogPath(graph, keep) {
+			os.Remove(log)
+		}
+	}
+}